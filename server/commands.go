@@ -0,0 +1,367 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"server/config"
+	"server/handlers"
+	"server/importer"
+	"server/repository"
+	"server/site"
+	"server/storage"
+	"server/utils"
+)
+
+// 执行命令行子命令
+func runCommand(name string, args []string) error {
+	switch name {
+	case "gc":
+		return runImageGC(args)
+	case "migrate-storage":
+		return runMigrateStorage(args)
+	case "placeholders":
+		return runPlaceholders(args)
+	case "exif":
+		return runExif(args)
+	case "watermark":
+		return runWatermark(args)
+	case "sync":
+		return runSync(args)
+	case "build":
+		return runBuild(args)
+	case "import":
+		return runImport(args)
+	default:
+		return fmt.Errorf("未知命令: %s", name)
+	}
+}
+
+// 回收孤立图片: server gc [-execute]
+func runImageGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	execute := fs.Bool("execute", false, "真正删除孤立图片，默认只列出")
+	fs.Parse(args)
+
+	result, err := handlers.CollectImageGarbage(!*execute)
+	if err != nil {
+		return err
+	}
+
+	for _, orphan := range result.Orphans {
+		utils.Logger.Printf("孤立图片: %s (%d 字节)", orphan.Name, orphan.Size)
+	}
+	if result.DryRun {
+		utils.Logger.Printf("共 %d 个孤立图片，%d 字节，使用 -execute 删除", len(result.Orphans), result.TotalSize)
+		return nil
+	}
+
+	utils.Logger.Printf("已删除 %d 个孤立图片，失败 %d 个", result.Removed, len(result.Failed))
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("部分图片删除失败: %v", result.Failed)
+	}
+	return nil
+}
+
+// 为已有图片补充占位信息: server placeholders [-force]
+func runPlaceholders(args []string) error {
+	fs := flag.NewFlagSet("placeholders", flag.ExitOnError)
+	force := fs.Bool("force", false, "重新生成所有图片的占位信息")
+	fs.Parse(args)
+
+	updated, failed, err := handlers.BackfillPlaceholders(*force)
+	if err != nil {
+		return err
+	}
+	utils.Logger.Printf("已生成 %d 个图片的占位信息，失败 %d 个", updated, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d 个图片生成占位信息失败", failed)
+	}
+	return nil
+}
+
+// 为旧照片补充拍摄信息: server exif [-force]
+func runExif(args []string) error {
+	fs := flag.NewFlagSet("exif", flag.ExitOnError)
+	force := fs.Bool("force", false, "重新读取所有照片的拍摄信息")
+	fs.Parse(args)
+
+	updated, failed, err := handlers.BackfillPhotoExif(*force)
+	if err != nil {
+		return err
+	}
+	utils.Logger.Printf("已补充 %d 张照片的拍摄信息，失败 %d 张", updated, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d 张照片保存拍摄信息失败", failed)
+	}
+	return nil
+}
+
+// 修改水印配置后重新生成照片图片: server watermark [-force]
+func runWatermark(args []string) error {
+	fs := flag.NewFlagSet("watermark", flag.ExitOnError)
+	force := fs.Bool("force", false, "重新处理所有照片图片，包括已按当前配置处理过的")
+	fs.Parse(args)
+
+	updated, failed, err := handlers.RewatermarkPhotos(*force)
+	if err != nil {
+		return err
+	}
+	utils.Logger.Printf("已重新生成 %d 个图片，失败 %d 个", updated, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d 个图片处理失败", failed)
+	}
+	return nil
+}
+
+// 在 SQLite 与 markdown 文件之间同步: server sync [-direction import|export|both]
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	direction := fs.String("direction", repository.SyncBoth, "同步方向: import、export 或 both")
+	fs.Parse(args)
+
+	result, err := repository.Sync(*direction)
+	if err != nil {
+		return err
+	}
+	utils.Logger.Printf("文章: 导入 %d 篇，导出 %d 篇，其中删除 %d 篇；照片: 导入 %d 张，导出 %d 张，其中删除 %d 张",
+		result.PostsImported, result.PostsExported, result.PostsRemoved,
+		result.PhotosImported, result.PhotosExported, result.PhotosRemoved)
+	if len(result.Conflicts) > 0 {
+		utils.Logger.Printf("%d 项内容在两侧都有改动，确认以哪一侧为准后使用 -direction import 或 export 再同步一次", len(result.Conflicts))
+	}
+	return nil
+}
+
+// 生成可部署到任意静态托管的站点: server build [-out dir] [-base-url url] [-full]
+func runBuild(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("out", config.SiteOutputDir, "输出目录")
+	baseURL := fs.String("base-url", config.PublicBaseURL, "站点的完整地址，用于订阅源和站点地图，为空时不生成这两类文件")
+	full := fs.Bool("full", false, "忽略上次的生成结果，重新生成所有文件")
+	fs.Parse(args)
+
+	if *baseURL == "" {
+		utils.Logger.Printf("未设置站点地址，不生成订阅源和站点地图")
+	}
+	result, err := site.Build(site.Options{
+		OutDir:      *out,
+		BaseURL:     strings.TrimRight(*baseURL, "/"),
+		Title:       config.SiteTitle,
+		Description: config.SiteDescription,
+		Full:        *full,
+	})
+	if err != nil {
+		return err
+	}
+	utils.Logger.Printf("页面: 写入 %d 个，未变化 %d 个，删除 %d 个；图片: 复制 %d 张，未变化 %d 张",
+		result.Written, result.Unchanged, result.Removed, result.ImagesCopied, result.ImagesSkipped)
+	if len(result.MissingImages) > 0 {
+		utils.Logger.Printf("%d 张被引用的图片不存在: %v", len(result.MissingImages), result.MissingImages)
+	}
+	return nil
+}
+
+// 从其他博客程序导入文章:
+// server import -from dir|export.xml [-format hexo|hugo|jekyll|wordpress] [-uploads dir] [-authors a,b]
+// [-dry-run] [-include-drafts] [-report file] [-redirects file]
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	from := fs.String("from", "", "源站点目录，WordPress 为导出的 WXR 文件")
+	format := fs.String("format", "", "源站点格式: hexo、hugo、jekyll 或 wordpress，默认自动识别")
+	uploads := fs.String("uploads", "", "WordPress 的 wp-content/uploads 目录，文章引用的附件从这里导入")
+	authors := fs.String("authors", "", "只导入这些 WordPress 用户的文章，多个用户名用逗号分隔")
+	dryRun := fs.Bool("dry-run", false, "只生成报告，不写入文章和图片")
+	includeDrafts := fs.Bool("include-drafts", false, "同时导入草稿，草稿发布后才公开显示")
+	reportFile := fs.String("report", "", "导入报告的保存路径（JSON）")
+	redirectsFile := fs.String("redirects", "", "旧地址跳转规则的保存路径，每行为: 旧地址 新地址 301")
+	fs.Parse(args)
+
+	if *from == "" {
+		return fmt.Errorf("请使用 -from 指定源站点目录")
+	}
+	var authorList []string
+	for _, author := range strings.Split(*authors, ",") {
+		if author = strings.TrimSpace(author); author != "" {
+			authorList = append(authorList, author)
+		}
+	}
+	report, err := importer.Import(importer.Options{
+		Source:        *from,
+		Format:        *format,
+		DryRun:        *dryRun,
+		IncludeDrafts: *includeDrafts,
+		Uploads:       *uploads,
+		Authors:       authorList,
+		SaveImage:     handlers.ImportImage,
+		CreatePhoto:   handlers.ImportPhoto,
+	})
+	if report == nil {
+		return err
+	}
+	// 中途失败时也保存已导入部分的报告
+	if writeErr := writeImportReport(report, *reportFile, *redirectsFile); writeErr != nil && err == nil {
+		err = writeErr
+	}
+
+	for _, item := range report.Skipped {
+		utils.Logger.Printf("跳过 %s: %s", item.File, item.Message)
+	}
+	for _, item := range report.Warnings {
+		utils.Logger.Printf("%s: %s", item.File, item.Message)
+	}
+	action := "已导入"
+	if report.DryRun {
+		action = "将导入"
+	}
+	utils.Logger.Printf("%s格式，%s %d 篇文章、%d 张图片、%d 张照片，跳过 %d 篇，%d 条警告，%d 条跳转",
+		report.Format, action, len(report.Imported), report.Images, report.Photos, len(report.Skipped), len(report.Warnings), len(report.Redirects))
+	return err
+}
+
+func writeImportReport(report *importer.Report, reportFile, redirectsFile string) error {
+	if reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(reportFile, data, 0644); err != nil {
+			return err
+		}
+	}
+	if redirectsFile != "" {
+		var b strings.Builder
+		for _, redirect := range report.Redirects {
+			fmt.Fprintf(&b, "%s %s 301\n", redirect.From, redirect.To)
+		}
+		if err := os.WriteFile(redirectsFile, []byte(b.String()), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 在存储后端之间迁移图片: server migrate-storage -from local -to s3 [-delete-source]
+func runMigrateStorage(args []string) error {
+	fs := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	from := fs.String("from", "local", "源存储类型: local 或 s3")
+	to := fs.String("to", "s3", "目标存储类型: local 或 s3")
+	deleteSource := fs.Bool("delete-source", false, "迁移成功后删除源文件")
+	fs.Parse(args)
+
+	if *from == *to {
+		return fmt.Errorf("源存储和目标存储不能相同")
+	}
+
+	for _, bucket := range []string{"images", "originals"} {
+		src, err := storage.New(*from, bucket)
+		if err != nil {
+			return err
+		}
+		dst, err := storage.New(*to, bucket)
+		if err != nil {
+			return err
+		}
+		if err := migrateBucket(bucket, src, dst, *deleteSource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateBucket(bucket string, src, dst storage.Backend, deleteSource bool) error {
+	objects, err := src.List()
+	if err != nil {
+		return fmt.Errorf("读取 %s 文件列表失败: %w", bucket, err)
+	}
+
+	copied, skipped, failed := 0, 0, 0
+	for _, obj := range objects {
+		// 目标中已有内容相同的文件时跳过，便于中断后重新执行；大小不同的是中断时未写完的文件，重新复制
+		if same, err := sameObject(src, dst, obj); err != nil {
+			utils.Logger.Printf("迁移失败 %s/%s: %v", bucket, obj.Key, err)
+			failed++
+			continue
+		} else if same {
+			skipped++
+		} else {
+			if err := copyObject(src, dst, obj); err != nil {
+				utils.Logger.Printf("迁移失败 %s/%s: %v", bucket, obj.Key, err)
+				failed++
+				continue
+			}
+			copied++
+		}
+
+		if deleteSource {
+			if err := src.Delete(obj.Key); err != nil {
+				utils.Logger.Printf("删除源文件失败 %s/%s: %v", bucket, obj.Key, err)
+			}
+		}
+	}
+
+	utils.Logger.Printf("%s: 复制 %d 个，跳过 %d 个，失败 %d 个", bucket, copied, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%s 有 %d 个文件迁移失败", bucket, failed)
+	}
+	return nil
+}
+
+var errObjectConflict = errors.New("目标中已有大小相同但内容不同的文件，保留两边的文件")
+
+// 目标中是否已有与源文件内容相同的文件，大小相同时再比较 sha256
+func sameObject(src, dst storage.Backend, obj storage.Object) (bool, error) {
+	existing, err := dst.Stat(obj.Key)
+	if errors.Is(err, storage.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if existing.Size != obj.Size {
+		return false, nil
+	}
+	srcHash, err := objectHash(src, obj.Key)
+	if err != nil {
+		return false, err
+	}
+	dstHash, err := objectHash(dst, obj.Key)
+	if err != nil {
+		return false, err
+	}
+	if srcHash != dstHash {
+		return false, errObjectConflict
+	}
+	return true, nil
+}
+
+func objectHash(b storage.Backend, key string) (string, error) {
+	r, err := b.Get(key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyObject(src, dst storage.Backend, obj storage.Object) error {
+	r, err := src.Get(obj.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Put(obj.Key, r, obj.Size, mime.TypeByExtension(filepath.Ext(obj.Key)))
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,18 +14,86 @@ var (
 	AllowedOrigins []string
 	MaxAge         time.Duration
 	TimeZone       string
+	PublicBaseURL  string
+	ImageCDNPrefix string
+	TrustedProxies []string
 )
 
 // 目录配置
 var (
-	ContentDir string
-	ImagesDir  string
-	PostsDir   string
+	ContentDir   string
+	ImagesDir    string
+	PostsDir     string
+	OriginalsDir string
+	UploadsDir   string
 )
 
 // 文件配置
 var (
-	PhotosFile string
+	PhotosFile   string
+	MediaFile    string
+	AlbumsFile   string
+	WebhooksFile string
+)
+
+// 静态站点配置
+var (
+	SiteTitle       string
+	SiteDescription string
+	SiteOutputDir   string
+)
+
+// Webhook 投递配置
+var (
+	WebhookTimeout time.Duration
+	// 最多尝试次数，第 n 次失败后等待 WebhookRetryBase * 2^(n-1) 再重试，最长不超过 WebhookRetryMax
+	WebhookMaxAttempts int
+	WebhookRetryBase   time.Duration
+	WebhookRetryMax    time.Duration
+	// 每个 Webhook 保留的已完成投递记录数量
+	WebhookLogSize int
+)
+
+// 存储配置
+var (
+	StorageBackend string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PathStyle    bool
+	S3PublicURL    string
+	S3URLExpiry    time.Duration
+)
+
+// 文章和照片数据配置
+var (
+	DataBackend          string
+	SQLiteFile           string
+	SQLiteMirrorMarkdown bool
+	// 回收站中的内容保留多久后自动永久删除，为 0 时不自动删除
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// 修改文章和照片时是否必须提供 If-Match
+	RequireIfMatch bool
+	// 编辑锁的有效期，以及其他人持有编辑锁时保存文章的处理方式
+	EditLockTTL  time.Duration
+	EditLockMode string
+	// 保留最近多少个内容变化事件，供断线重连的客户端补齐
+	EventHistorySize int
+)
+
+// 其他人持有编辑锁时保存文章的处理方式
+const (
+	EditLockWarn   = "warn"
+	EditLockRefuse = "refuse"
+)
+
+// 文章和照片的存储方式
+const (
+	DataBackendFile   = "file"
+	DataBackendSQLite = "sqlite"
 )
 
 // CORS配置
@@ -36,7 +105,35 @@ var (
 )
 
 // 图片配置
-var AllowedImageTypes map[string]bool
+var (
+	AllowedImageTypes    map[string]bool
+	ImageGCGrace         time.Duration
+	UploadMetadataPolicy string
+	KeepOriginalMetadata bool
+	MaxResumableSize     int64
+	ResumableExpiry      time.Duration
+	UploadWorkers        int
+	MaxBatchFileSize     int64
+	MaxBatchSize         int64
+)
+
+// 水印配置
+var (
+	WatermarkEnabled  bool
+	WatermarkText     string
+	WatermarkImage    string
+	WatermarkFont     string
+	WatermarkPosition string
+	WatermarkOpacity  float64
+	WatermarkScale    float64
+)
+
+// 上传图片的元数据处理策略
+const (
+	MetadataKeep     = "keep"
+	MetadataStripGPS = "strip-gps"
+	MetadataStripAll = "strip-all"
+)
 
 // 初始化函数
 func Init() error {
@@ -50,6 +147,14 @@ func Init() error {
 		return err
 	}
 	TimeZone = getEnvOrDefault("TIMEZONE", "Asia/Shanghai")
+	PublicBaseURL = strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	ImageCDNPrefix = strings.TrimRight(os.Getenv("IMAGE_CDN_PREFIX"), "/")
+	TrustedProxies = nil
+	for _, proxy := range strings.Split(getEnvOrDefault("TRUSTED_PROXIES", "127.0.0.1,::1"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			TrustedProxies = append(TrustedProxies, proxy)
+		}
+	}
 
 	// 检查必要的环境变量
 	if os.Getenv("SECRET_PASSPHRASE") == "" {
@@ -60,14 +165,102 @@ func Init() error {
 	ContentDir = getEnvOrDefault("CONTENT_DIR", "/var/www/innov.ink")
 	ImagesDir = filepath.Join(ContentDir, "images")
 	PostsDir = filepath.Join(ContentDir, "posts")
+	// 保留原始元数据的图片不能放在公开目录中
+	OriginalsDir = getEnvOrDefault("ORIGINALS_DIR", "data/originals")
+	UploadsDir = getEnvOrDefault("UPLOAD_STAGING_DIR", "data/uploads")
 
 	// 加载文件配置
 	PhotosFile = getEnvOrDefault("PHOTOS_FILE", "data/photos.json")
+	MediaFile = getEnvOrDefault("MEDIA_FILE", "data/media.json")
+	AlbumsFile = getEnvOrDefault("ALBUMS_FILE", "data/albums.json")
+	WebhooksFile = getEnvOrDefault("WEBHOOKS_FILE", "data/webhooks.json")
+
+	// 加载静态站点配置
+	SiteTitle = getEnvOrDefault("SITE_TITLE", "Blog")
+	SiteDescription = os.Getenv("SITE_DESCRIPTION")
+	SiteOutputDir = getEnvOrDefault("SITE_OUTPUT_DIR", "data/site")
+
+	// 加载 Webhook 投递配置
+	WebhookTimeout, err = time.ParseDuration(getEnvOrDefault("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil {
+		return err
+	}
+	WebhookRetryBase, err = time.ParseDuration(getEnvOrDefault("WEBHOOK_RETRY_BASE", "30s"))
+	if err != nil {
+		return err
+	}
+	WebhookRetryMax, err = time.ParseDuration(getEnvOrDefault("WEBHOOK_RETRY_MAX", "1h"))
+	if err != nil {
+		return err
+	}
+	if WebhookRetryBase <= 0 || WebhookRetryMax <= 0 {
+		return ErrInvalidWebhookRetry
+	}
+	WebhookMaxAttempts, err = strconv.Atoi(getEnvOrDefault("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || WebhookMaxAttempts < 1 {
+		return ErrInvalidWebhookAttempts
+	}
+	WebhookLogSize, err = strconv.Atoi(getEnvOrDefault("WEBHOOK_LOG_SIZE", "100"))
+	if err != nil || WebhookLogSize < 1 {
+		return ErrInvalidWebhookLogSize
+	}
+
+	// 加载文章和照片数据配置
+	DataBackend = getEnvOrDefault("DATA_BACKEND", DataBackendFile)
+	if DataBackend != DataBackendFile && DataBackend != DataBackendSQLite {
+		return ErrInvalidDataBackend
+	}
+	SQLiteFile = getEnvOrDefault("SQLITE_FILE", "data/mblog.db")
+	SQLiteMirrorMarkdown = getEnvOrDefault("SQLITE_MIRROR_MARKDOWN", "true") == "true"
+	TrashRetention, err = time.ParseDuration(getEnvOrDefault("TRASH_RETENTION", "0"))
+	if err != nil {
+		return err
+	}
+	TrashPurgeInterval, err = time.ParseDuration(getEnvOrDefault("TRASH_PURGE_INTERVAL", "1h"))
+	if err != nil {
+		return err
+	}
+	if TrashPurgeInterval <= 0 {
+		TrashPurgeInterval = time.Hour
+	}
+	RequireIfMatch = getEnvOrDefault("REQUIRE_IF_MATCH", "false") == "true"
+	EditLockTTL, err = time.ParseDuration(getEnvOrDefault("EDIT_LOCK_TTL", "2m"))
+	if err != nil {
+		return err
+	}
+	if EditLockTTL <= 0 {
+		return ErrInvalidEditLockTTL
+	}
+	EditLockMode = getEnvOrDefault("EDIT_LOCK_MODE", EditLockWarn)
+	if EditLockMode != EditLockWarn && EditLockMode != EditLockRefuse {
+		return ErrInvalidEditLockMode
+	}
+	EventHistorySize, err = strconv.Atoi(getEnvOrDefault("EVENT_HISTORY_SIZE", "1000"))
+	if err != nil || EventHistorySize < 0 {
+		return ErrInvalidEventHistorySize
+	}
+
+	// 加载存储配置
+	StorageBackend = getEnvOrDefault("STORAGE_BACKEND", "local")
+	if StorageBackend != "local" && StorageBackend != "s3" {
+		return ErrInvalidStorageBackend
+	}
+	S3Endpoint = os.Getenv("S3_ENDPOINT")
+	S3Region = getEnvOrDefault("S3_REGION", "us-east-1")
+	S3Bucket = os.Getenv("S3_BUCKET")
+	S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	S3SecretKey = os.Getenv("S3_SECRET_KEY")
+	S3PathStyle = getEnvOrDefault("S3_PATH_STYLE", "true") == "true"
+	S3PublicURL = os.Getenv("S3_PUBLIC_URL")
+	S3URLExpiry, err = time.ParseDuration(getEnvOrDefault("S3_URL_EXPIRY", "1h"))
+	if err != nil {
+		return err
+	}
 
 	// 加载CORS配置
-	AllowMethods = strings.Split(getEnvOrDefault("ALLOW_METHODS", "GET,POST,PUT,DELETE,OPTIONS"), ",")
-	AllowHeaders = strings.Split(getEnvOrDefault("ALLOW_HEADERS", "Origin,Content-Type,Authorization"), ",")
-	ExposeHeaders = strings.Split(getEnvOrDefault("EXPOSE_HEADERS", "Content-Length"), ",")
+	AllowMethods = strings.Split(getEnvOrDefault("ALLOW_METHODS", "GET,POST,PUT,PATCH,DELETE,HEAD,OPTIONS"), ",")
+	AllowHeaders = strings.Split(getEnvOrDefault("ALLOW_HEADERS", "Origin,Content-Type,Authorization,Upload-Length,Upload-Offset,Upload-Metadata,Tus-Resumable,If-Match,If-None-Match,X-Edit-Session,Last-Event-ID,X-Passphrase"), ",")
+	ExposeHeaders = strings.Split(getEnvOrDefault("EXPOSE_HEADERS", "Content-Length,Location,Upload-Offset,Upload-Length,Tus-Resumable,ETag,X-Edit-Lock-Warning"), ",")
 	AllowCredentials = getEnvOrDefault("ALLOW_CREDENTIALS", "true") == "true"
 
 	// 加载图片配置
@@ -76,9 +269,72 @@ func Init() error {
 	for _, t := range allowedTypes {
 		AllowedImageTypes[strings.TrimSpace(t)] = true
 	}
+	ImageGCGrace, err = time.ParseDuration(getEnvOrDefault("IMAGE_GC_GRACE", "24h"))
+	if err != nil {
+		return err
+	}
+	UploadMetadataPolicy = getEnvOrDefault("UPLOAD_METADATA_POLICY", MetadataStripGPS)
+	switch UploadMetadataPolicy {
+	case MetadataKeep, MetadataStripGPS, MetadataStripAll:
+	default:
+		return ErrInvalidMetadataPolicy
+	}
+	KeepOriginalMetadata = getEnvOrDefault("KEEP_ORIGINAL_METADATA", "false") == "true"
+	MaxResumableSize, err = strconv.ParseInt(getEnvOrDefault("RESUMABLE_UPLOAD_MAX_SIZE", "104857600"), 10, 64)
+	if err != nil {
+		return err
+	}
+	ResumableExpiry, err = time.ParseDuration(getEnvOrDefault("RESUMABLE_UPLOAD_EXPIRY", "24h"))
+	if err != nil {
+		return err
+	}
+	UploadWorkers, err = strconv.Atoi(getEnvOrDefault("UPLOAD_WORKERS", "4"))
+	if err != nil {
+		return err
+	}
+	if UploadWorkers < 1 {
+		UploadWorkers = 1
+	}
+	MaxBatchFileSize, err = strconv.ParseInt(getEnvOrDefault("BATCH_UPLOAD_MAX_FILE_SIZE", "20971520"), 10, 64)
+	if err != nil {
+		return err
+	}
+	MaxBatchSize, err = strconv.ParseInt(getEnvOrDefault("BATCH_UPLOAD_MAX_SIZE", "209715200"), 10, 64)
+	if err != nil {
+		return err
+	}
+	if MaxBatchFileSize <= 0 || MaxBatchSize <= 0 {
+		return ErrInvalidBatchUploadSize
+	}
+
+	// 加载水印配置
+	WatermarkEnabled = getEnvOrDefault("WATERMARK_ENABLED", "false") == "true"
+	WatermarkText = os.Getenv("WATERMARK_TEXT")
+	WatermarkImage = os.Getenv("WATERMARK_IMAGE")
+	WatermarkFont = os.Getenv("WATERMARK_FONT")
+	WatermarkPosition = getEnvOrDefault("WATERMARK_POSITION", "bottom-right")
+	switch WatermarkPosition {
+	case "top-left", "top-right", "bottom-left", "bottom-right", "center", "tile":
+	default:
+		return ErrInvalidWatermarkPosition
+	}
+	WatermarkOpacity, err = strconv.ParseFloat(getEnvOrDefault("WATERMARK_OPACITY", "0.5"), 64)
+	if err != nil {
+		return err
+	}
+	WatermarkScale, err = strconv.ParseFloat(getEnvOrDefault("WATERMARK_SCALE", "0.2"), 64)
+	if err != nil {
+		return err
+	}
+	if WatermarkScale <= 0 || WatermarkScale > 1 {
+		return ErrInvalidWatermarkScale
+	}
+	if WatermarkEnabled && WatermarkText == "" && WatermarkImage == "" {
+		return ErrMissingWatermark
+	}
 
 	// 创建必要的目录
-	dirs := []string{ImagesDir, PostsDir}
+	dirs := []string{ImagesDir, PostsDir, OriginalsDir, UploadsDir}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return err
@@ -3,5 +3,18 @@ package config
 import "errors"
 
 var (
-	ErrMissingPassphrase = errors.New("SECRET_PASSPHRASE 环境变量未设置")
-) 
\ No newline at end of file
+	ErrMissingPassphrase        = errors.New("SECRET_PASSPHRASE 环境变量未设置")
+	ErrInvalidMetadataPolicy    = errors.New("UPLOAD_METADATA_POLICY 只能是 keep、strip-gps 或 strip-all")
+	ErrInvalidStorageBackend    = errors.New("STORAGE_BACKEND 只能是 local 或 s3")
+	ErrInvalidDataBackend       = errors.New("DATA_BACKEND 只能是 file 或 sqlite")
+	ErrInvalidWatermarkPosition = errors.New("WATERMARK_POSITION 只能是 top-left、top-right、bottom-left、bottom-right、center 或 tile")
+	ErrInvalidWatermarkScale    = errors.New("WATERMARK_SCALE 必须在 0 到 1 之间")
+	ErrMissingWatermark         = errors.New("启用水印时需要设置 WATERMARK_TEXT 或 WATERMARK_IMAGE")
+	ErrInvalidEditLockTTL       = errors.New("EDIT_LOCK_TTL 必须大于 0")
+	ErrInvalidEditLockMode      = errors.New("EDIT_LOCK_MODE 只能是 warn 或 refuse")
+	ErrInvalidEventHistorySize  = errors.New("EVENT_HISTORY_SIZE 必须是非负整数")
+	ErrInvalidWebhookAttempts   = errors.New("WEBHOOK_MAX_ATTEMPTS 必须是正整数")
+	ErrInvalidWebhookLogSize    = errors.New("WEBHOOK_LOG_SIZE 必须是正整数")
+	ErrInvalidWebhookRetry      = errors.New("WEBHOOK_RETRY_BASE 和 WEBHOOK_RETRY_MAX 必须大于 0")
+	ErrInvalidBatchUploadSize   = errors.New("BATCH_UPLOAD_MAX_FILE_SIZE 和 BATCH_UPLOAD_MAX_SIZE 必须是正整数")
+) 
@@ -0,0 +1,202 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/config"
+)
+
+// 内容变化的事件类型
+const (
+	PostCreated   = "post.created"
+	PostUpdated   = "post.updated"
+	PostTrashed   = "post.trashed"
+	PostRestored  = "post.restored"
+	PostDeleted   = "post.deleted"
+	PhotoCreated  = "photo.created"
+	PhotoUpdated  = "photo.updated"
+	PhotoTrashed  = "photo.trashed"
+	PhotoRestored = "photo.restored"
+	PhotoDeleted  = "photo.deleted"
+	ImageUploaded = "image.uploaded"
+)
+
+// 所有事件类型，用于校验订阅条件
+var Types = []string{
+	PostCreated, PostUpdated, PostTrashed, PostRestored, PostDeleted,
+	PhotoCreated, PhotoUpdated, PhotoTrashed, PhotoRestored, PhotoDeleted,
+	ImageUploaded,
+}
+
+// 一次内容变化，ID 形如 "<启动时间>-<序号>"，重启后不会与之前的事件混淆
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// 事件过滤条件，为空时接收全部事件；"post.*" 匹配 post 开头的所有类型
+type Filter []string
+
+func (f Filter) Match(eventType string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, pattern := range f {
+		if pattern == eventType || pattern == "*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 订阅者的缓冲区，写满时断开该订阅者，由其凭 Last-Event-ID 重新连接补齐
+const subscriberBuffer = 64
+
+type subscriber struct {
+	filter Filter
+	ch     chan Event
+}
+
+// 进程内的事件总线，保留最近的事件用于断线续传
+type Bus struct {
+	mu      sync.Mutex
+	epoch   string
+	seq     uint64
+	history []Event
+	size    int
+	subs    map[*subscriber]struct{}
+}
+
+func NewBus(size int) *Bus {
+	return &Bus{
+		epoch: strconv.FormatInt(time.Now().UnixMilli(), 36),
+		size:  size,
+		subs:  make(map[*subscriber]struct{}),
+	}
+}
+
+// 发布事件，不会因为订阅者处理慢而阻塞
+func (b *Bus) Publish(eventType string, data any) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := Event{
+		ID:   b.epoch + "-" + strconv.FormatUint(b.seq, 10),
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+	if b.size > 0 {
+		if len(b.history) >= b.size {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, event)
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(eventType) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return event
+}
+
+// 一个订阅，C 被关闭表示订阅已断开
+type Subscription struct {
+	// 断线期间错过的事件
+	Replay []Event
+	// 为 false 时 Last-Event-ID 已不在缓存中（太旧或来自重启之前），订阅者应重新加载全部数据
+	Complete bool
+	// 订阅时最新的事件 ID
+	LastID string
+	C      <-chan Event
+	Cancel func()
+}
+
+// 订阅事件，lastID 不为空时先补齐其后缓存的事件
+func (b *Bus) Subscribe(filter Filter, lastID string) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscription := &Subscription{Complete: true}
+	if b.seq > 0 {
+		subscription.LastID = b.epoch + "-" + strconv.FormatUint(b.seq, 10)
+	}
+	if lastID != "" {
+		var replay []Event
+		replay, subscription.Complete = b.since(lastID)
+		for _, event := range replay {
+			if filter.Match(event.Type) {
+				subscription.Replay = append(subscription.Replay, event)
+			}
+		}
+	}
+
+	sub := &subscriber{filter: filter, ch: make(chan Event, subscriberBuffer)}
+	b.subs[sub] = struct{}{}
+	subscription.C = sub.ch
+	subscription.Cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[sub]; ok {
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return subscription
+}
+
+// lastID 之后的事件，调用方需持有 b.mu
+func (b *Bus) since(lastID string) ([]Event, bool) {
+	epoch, seqText, ok := strings.Cut(lastID, "-")
+	if !ok || epoch != b.epoch {
+		return nil, false
+	}
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil || seq > b.seq {
+		return nil, false
+	}
+	if seq == b.seq {
+		return nil, true
+	}
+	// 缓存中的事件序号连续，第一个事件之前的都已丢弃
+	if len(b.history) == 0 || seq+1 < b.history[0].seqNumber() {
+		return nil, false
+	}
+	start := int(seq + 1 - b.history[0].seqNumber())
+	return b.history[start:], true
+}
+
+func (e Event) seqNumber() uint64 {
+	_, seqText, _ := strings.Cut(e.ID, "-")
+	seq, _ := strconv.ParseUint(seqText, 10, 64)
+	return seq
+}
+
+// 默认的事件总线
+var Default = NewBus(1000)
+
+// 按配置的缓存大小重新创建默认事件总线，应在处理请求之前调用
+func Init() {
+	Default = NewBus(config.EventHistorySize)
+}
+
+// 在默认事件总线上发布事件
+func Publish(eventType string, data any) Event {
+	return Default.Publish(eventType, data)
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// 发布 n 个事件，返回所有事件 ID
+func publishN(b *Bus, n int) []string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		ids = append(ids, b.Publish(PostUpdated, i).ID)
+	}
+	return ids
+}
+
+func eventIDs(events []Event) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestBusSince(t *testing.T) {
+	// 缓存 3 个，共发布 5 个：ids[0]、ids[1] 已丢弃
+	b := NewBus(3)
+	ids := publishN(b, 5)
+
+	tests := []struct {
+		name     string
+		lastID   string
+		want     []string
+		complete bool
+	}{
+		{"最新事件", ids[4], nil, true},
+		{"缓存中的事件", ids[2], ids[3:], true},
+		{"缓存第一个之前的事件", ids[1], ids[2:], true},
+		{"已丢弃的事件", ids[0], nil, false},
+		{"未来的序号", b.epoch + "-6", nil, false},
+		{"序号 0", b.epoch + "-0", nil, false},
+		{"重启之前的事件", "old-3", nil, false},
+		{"没有分隔符", "abc", nil, false},
+		{"序号无效", b.epoch + "-x", nil, false},
+		{"负数序号", b.epoch + "--1", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, complete := b.since(tt.lastID)
+			if !reflect.DeepEqual(eventIDs(got), tt.want) || complete != tt.complete {
+				t.Errorf("since(%q) = %v, %v; want %v, %v", tt.lastID, eventIDs(got), complete, tt.want, tt.complete)
+			}
+		})
+	}
+}
+
+func TestBusSinceWithoutHistory(t *testing.T) {
+	b := NewBus(0)
+	ids := publishN(b, 2)
+	if got, complete := b.since(ids[1]); got != nil || !complete {
+		t.Errorf("最新事件: %v, %v", eventIDs(got), complete)
+	}
+	if got, complete := b.since(ids[0]); got != nil || complete {
+		t.Errorf("不缓存时: %v, %v", eventIDs(got), complete)
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	b := NewBus(10)
+	first := b.Publish(PostCreated, nil)
+	b.Publish(PhotoCreated, nil)
+	last := b.Publish(PostUpdated, nil)
+
+	sub := b.Subscribe(Filter{"post.*"}, first.ID)
+	defer sub.Cancel()
+	if !sub.Complete || sub.LastID != last.ID {
+		t.Fatalf("Complete = %v, LastID = %q", sub.Complete, sub.LastID)
+	}
+	if got := eventIDs(sub.Replay); !reflect.DeepEqual(got, []string{last.ID}) {
+		t.Errorf("Replay = %v, want %v", got, []string{last.ID})
+	}
+
+	b.Publish(ImageUploaded, nil)
+	next := b.Publish(PostDeleted, nil)
+	if event := <-sub.C; event.ID != next.ID {
+		t.Errorf("收到 %s, want %s", event.ID, next.ID)
+	}
+}
+
+func TestSlowSubscriberDisconnected(t *testing.T) {
+	b := NewBus(0)
+	sub := b.Subscribe(nil, "")
+	publishN(b, subscriberBuffer+1)
+
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("收到 %d 个事件, want %d", n, subscriberBuffer)
+	}
+	// 已断开的订阅可以再次取消
+	sub.Cancel()
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		filter    Filter
+		eventType string
+		want      bool
+	}{
+		{nil, PhotoDeleted, true},
+		{Filter{"*"}, ImageUploaded, true},
+		{Filter{"post.*"}, PostTrashed, true},
+		{Filter{"post.*"}, PhotoTrashed, false},
+		{Filter{"image.uploaded", "photo.created"}, PhotoCreated, true},
+		{Filter{"photo.created"}, PhotoUpdated, false},
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if got := tt.filter.Match(tt.eventType); got != tt.want {
+				t.Errorf("%v.Match(%q) = %v, want %v", tt.filter, tt.eventType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoExif  = errors.New("图片不包含 EXIF 信息")
+	ErrInvalid = errors.New("无效的 EXIF 数据")
+)
+
+// 常用 EXIF 标签
+const (
+	tagMake              = 0x010F
+	tagModel             = 0x0110
+	tagOrientation       = 0x0112
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagGPSIFD            = 0x8825
+	tagExposureTime      = 0x829A
+	tagFNumber           = 0x829D
+	tagISO               = 0x8827
+	tagDateTimeOriginal  = 0x9003
+	tagOffsetTimeOrig    = 0x9011
+	tagFocalLength       = 0x920A
+	tagFocalLength35mm   = 0xA405
+	tagLensMake          = 0xA433
+	tagLensModel         = 0xA434
+	tagGPSLatitudeRef    = 0x0001
+	tagGPSLatitude       = 0x0002
+	tagGPSLongitudeRef   = 0x0003
+	tagGPSLongitude      = 0x0004
+	tagGPSAltitudeRef    = 0x0005
+	tagGPSAltitude       = 0x0006
+	exifDateTimeLayout   = "2006:01:02 15:04:05"
+	exifHeader           = "Exif\x00\x00"
+	maxHeaderSearchBytes = 1 << 20
+)
+
+// 每种数据类型的字节数
+var typeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// 解析后的拍摄信息
+type Info struct {
+	Make            string
+	Model           string
+	LensMake        string
+	LensModel       string
+	FocalLength     float64 // 毫米
+	FocalLength35mm int
+	FNumber         float64
+	ExposureTime    string // 例如 1/250
+	ISO             int
+	DateTaken       string // EXIF 原始格式 2006:01:02 15:04:05
+	OffsetTime      string // 例如 +08:00
+	Latitude        *float64
+	Longitude       *float64
+	Altitude        *float64
+	Orientation     int
+}
+
+// 拍摄时间，EXIF 中没有时区时使用 loc
+func (info *Info) TakenAt(loc *time.Location) (time.Time, bool) {
+	if info.DateTaken == "" {
+		return time.Time{}, false
+	}
+	if info.OffsetTime != "" {
+		if t, err := time.Parse(exifDateTimeLayout+"-07:00", info.DateTaken+info.OffsetTime); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.ParseInLocation(exifDateTimeLayout, info.DateTaken, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// IFD 中的一个条目，valueOffset 为值在 TIFF 数据中的绝对位置
+type entry struct {
+	tag         uint16
+	typ         uint16
+	count       uint32
+	entryOffset int
+	valueOffset int
+}
+
+// TIFF 结构的 EXIF 数据
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// 解析 JPEG、TIFF 或内嵌 EXIF 块的图片（如 HEIC）中的拍摄信息
+func Parse(data []byte) (*Info, error) {
+	start, end, err := locateTIFF(data)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTIFF(data[start:end])
+	if err != nil {
+		return nil, err
+	}
+
+	ifd0, err := t.readIFD(int(t.order.Uint32(t.data[4:8])))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagMake:
+			info.Make = t.ascii(e)
+		case tagModel:
+			info.Model = t.ascii(e)
+		case tagOrientation:
+			info.Orientation = t.uint(e)
+		case tagDateTime:
+			if info.DateTaken == "" {
+				info.DateTaken = t.ascii(e)
+			}
+		case tagExifIFD:
+			sub, err := t.readIFD(t.uint(e))
+			if err != nil {
+				continue
+			}
+			t.fillExif(info, sub)
+		case tagGPSIFD:
+			sub, err := t.readIFD(t.uint(e))
+			if err != nil {
+				continue
+			}
+			t.fillGPS(info, sub)
+		}
+	}
+	return info, nil
+}
+
+func (t *tiff) fillExif(info *Info, entries []entry) {
+	for _, e := range entries {
+		switch e.tag {
+		case tagExposureTime:
+			num, den := t.rational(e, 0)
+			info.ExposureTime = formatExposure(num, den)
+		case tagFNumber:
+			info.FNumber = round(t.float(e, 0), 1)
+		case tagISO:
+			info.ISO = t.uint(e)
+		case tagDateTimeOriginal:
+			info.DateTaken = t.ascii(e)
+		case tagOffsetTimeOrig:
+			info.OffsetTime = t.ascii(e)
+		case tagFocalLength:
+			info.FocalLength = round(t.float(e, 0), 1)
+		case tagFocalLength35mm:
+			info.FocalLength35mm = t.uint(e)
+		case tagLensMake:
+			info.LensMake = t.ascii(e)
+		case tagLensModel:
+			info.LensModel = t.ascii(e)
+		}
+	}
+}
+
+func (t *tiff) fillGPS(info *Info, entries []entry) {
+	var latRef, lonRef string
+	var lat, lon *float64
+	var alt *float64
+	altBelowSea := false
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = t.ascii(e)
+		case tagGPSLongitudeRef:
+			lonRef = t.ascii(e)
+		case tagGPSLatitude:
+			lat = t.degrees(e)
+		case tagGPSLongitude:
+			lon = t.degrees(e)
+		case tagGPSAltitudeRef:
+			altBelowSea = t.uint(e) == 1
+		case tagGPSAltitude:
+			v := round(t.float(e, 0), 1)
+			alt = &v
+		}
+	}
+
+	if lat == nil || lon == nil {
+		return
+	}
+	if strings.EqualFold(latRef, "S") {
+		*lat = -*lat
+	}
+	if strings.EqualFold(lonRef, "W") {
+		*lon = -*lon
+	}
+	// 0,0 通常表示设备未定位成功
+	if *lat == 0 && *lon == 0 {
+		return
+	}
+	info.Latitude, info.Longitude = lat, lon
+	if alt != nil && altBelowSea {
+		*alt = -*alt
+	}
+	info.Altitude = alt
+}
+
+// 找到 TIFF 数据在文件中的范围
+func locateTIFF(data []byte) (int, int, error) {
+	if isTIFFHeader(data) {
+		return 0, len(data), nil
+	}
+
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xD8 {
+		start, end, err := findJPEGExif(data)
+		if err == nil {
+			return start, end, nil
+		}
+		if err != ErrNoExif {
+			return 0, 0, err
+		}
+	}
+
+	// HEIC 等容器格式中 EXIF 块以 "Exif\0\0" 开头
+	limit := len(data)
+	if limit > maxHeaderSearchBytes {
+		limit = maxHeaderSearchBytes
+	}
+	for from := 0; from < limit; {
+		i := bytes.Index(data[from:limit], []byte(exifHeader))
+		if i < 0 {
+			break
+		}
+		start := from + i + len(exifHeader)
+		if isTIFFHeader(data[start:]) {
+			return start, len(data), nil
+		}
+		from = start
+	}
+	return 0, 0, ErrNoExif
+}
+
+// 在 JPEG 的 APP1 段中查找 EXIF，返回 TIFF 数据的范围
+func findJPEGExif(data []byte) (int, int, error) {
+	for _, seg := range jpegSegments(data) {
+		if seg.marker != 0xE1 {
+			continue
+		}
+		payload := data[seg.start:seg.end]
+		if bytes.HasPrefix(payload, []byte(exifHeader)) {
+			return seg.start + len(exifHeader), seg.end, nil
+		}
+	}
+	return 0, 0, ErrNoExif
+}
+
+func isTIFFHeader(data []byte) bool {
+	return len(data) >= 8 &&
+		(bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")))
+}
+
+func newTIFF(data []byte) (*tiff, error) {
+	if !isTIFFHeader(data) {
+		return nil, ErrInvalid
+	}
+	t := &tiff{data: data, order: binary.LittleEndian}
+	if data[0] == 'M' {
+		t.order = binary.BigEndian
+	}
+	return t, nil
+}
+
+func (t *tiff) readIFD(offset int) ([]entry, error) {
+	if offset < 8 || offset+2 > len(t.data) {
+		return nil, ErrInvalid
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	if offset+2+n*12 > len(t.data) {
+		return nil, ErrInvalid
+	}
+
+	entries := make([]entry, 0, n)
+	for i := 0; i < n; i++ {
+		pos := offset + 2 + i*12
+		e := entry{
+			tag:         t.order.Uint16(t.data[pos:]),
+			typ:         t.order.Uint16(t.data[pos+2:]),
+			count:       t.order.Uint32(t.data[pos+4:]),
+			entryOffset: pos,
+			valueOffset: pos + 8,
+		}
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		total := size * int(e.count)
+		if e.count > uint32(len(t.data)) || total < 0 {
+			continue
+		}
+		if total > 4 {
+			e.valueOffset = int(t.order.Uint32(t.data[pos+8:]))
+		}
+		if e.valueOffset+total > len(t.data) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// 条目值占用的字节数
+func (e entry) size() int {
+	return typeSizes[e.typ] * int(e.count)
+}
+
+func (t *tiff) ascii(e entry) string {
+	b := t.data[e.valueOffset : e.valueOffset+e.size()]
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (t *tiff) uint(e entry) int {
+	if e.count == 0 {
+		return 0
+	}
+	switch e.typ {
+	case 1, 7:
+		return int(t.data[e.valueOffset])
+	case 3:
+		return int(t.order.Uint16(t.data[e.valueOffset:]))
+	case 4, 9:
+		return int(t.order.Uint32(t.data[e.valueOffset:]))
+	}
+	return 0
+}
+
+func (t *tiff) rational(e entry, i int) (int64, int64) {
+	if (e.typ != 5 && e.typ != 10) || uint32(i) >= e.count {
+		return 0, 0
+	}
+	pos := e.valueOffset + i*8
+	if e.typ == 10 {
+		return int64(int32(t.order.Uint32(t.data[pos:]))), int64(int32(t.order.Uint32(t.data[pos+4:])))
+	}
+	return int64(t.order.Uint32(t.data[pos:])), int64(t.order.Uint32(t.data[pos+4:]))
+}
+
+func (t *tiff) float(e entry, i int) float64 {
+	num, den := t.rational(e, i)
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// GPS 度分秒转换为十进制度数
+func (t *tiff) degrees(e entry) *float64 {
+	if e.count < 3 {
+		return nil
+	}
+	v := t.float(e, 0) + t.float(e, 1)/60 + t.float(e, 2)/3600
+	v = round(v, 6)
+	return &v
+}
+
+func formatExposure(num, den int64) string {
+	if num <= 0 || den <= 0 {
+		return ""
+	}
+	if num >= den {
+		return fmt.Sprintf("%g", round(float64(num)/float64(den), 1))
+	}
+	return fmt.Sprintf("1/%d", int64(math.Round(float64(den)/float64(num))))
+}
+
+func round(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
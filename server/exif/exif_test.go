@@ -0,0 +1,295 @@
+package exif
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 测试用的 IFD 条目，value 为按字节序编码后的值
+type testTag struct {
+	id    uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// 按指定字节序生成 TIFF 数据
+type tiffBuilder struct {
+	order binary.ByteOrder
+}
+
+func (b tiffBuilder) ascii(id uint16, s string) testTag {
+	return testTag{id, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func (b tiffBuilder) short(id uint16, v uint16) testTag {
+	value := make([]byte, 2)
+	b.order.PutUint16(value, v)
+	return testTag{id, 3, 1, value}
+}
+
+func (b tiffBuilder) long(id uint16, v uint32) testTag {
+	value := make([]byte, 4)
+	b.order.PutUint32(value, v)
+	return testTag{id, 4, 1, value}
+}
+
+func (b tiffBuilder) rational(id uint16, pairs ...uint32) testTag {
+	value := make([]byte, 4*len(pairs))
+	for i, v := range pairs {
+		b.order.PutUint32(value[4*i:], v)
+	}
+	return testTag{id, 5, uint32(len(pairs) / 2), value}
+}
+
+// 先写入 Exif 和 GPS 子目录，再写入指向它们的 IFD0
+func (b tiffBuilder) build(ifd0, exifIFD, gps []testTag) []byte {
+	data := []byte("II*\x00\x00\x00\x00\x00")
+	if b.order == binary.BigEndian {
+		data = []byte("MM\x00*\x00\x00\x00\x00")
+	}
+	if exifIFD != nil {
+		ifd0 = append(ifd0, b.long(tagExifIFD, uint32(len(data))))
+		data = b.writeIFD(data, exifIFD)
+	}
+	if gps != nil {
+		ifd0 = append(ifd0, b.long(tagGPSIFD, uint32(len(data))))
+		data = b.writeIFD(data, gps)
+	}
+	b.order.PutUint32(data[4:], uint32(len(data)))
+	return b.writeIFD(data, ifd0)
+}
+
+func (b tiffBuilder) writeIFD(data []byte, tags []testTag) []byte {
+	offset := len(data)
+	extraStart := offset + 2 + 12*len(tags) + 4
+	ifd := make([]byte, extraStart-offset)
+	b.order.PutUint16(ifd, uint16(len(tags)))
+	var extra []byte
+	for i, tag := range tags {
+		pos := 2 + 12*i
+		b.order.PutUint16(ifd[pos:], tag.id)
+		b.order.PutUint16(ifd[pos+2:], tag.typ)
+		b.order.PutUint32(ifd[pos+4:], tag.count)
+		if len(tag.value) <= 4 {
+			copy(ifd[pos+8:], tag.value)
+		} else {
+			b.order.PutUint32(ifd[pos+8:], uint32(extraStart+len(extra)))
+			extra = append(extra, tag.value...)
+		}
+	}
+	return append(append(data, ifd...), extra...)
+}
+
+// 把 TIFF 数据放入 JPEG 的 APP1 段
+func wrapJPEG(tiffData []byte) []byte {
+	payload := append([]byte(exifHeader), tiffData...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	out = append(out, payload...)
+	out = append(out, 0xFF, 0xDA, 0x00, 0x08, 1, 1, 0, 0, 0x3F, 0)
+	return append(out, 0x12, 0x34, 0xFF, 0xD9)
+}
+
+func fullTIFF(order binary.ByteOrder) []byte {
+	b := tiffBuilder{order}
+	return b.build(
+		[]testTag{
+			b.ascii(tagMake, "Apple"),
+			b.ascii(tagModel, "iPhone 15"),
+			b.short(tagOrientation, 6),
+			b.ascii(tagDateTime, "2024:11:04 09:00:00"),
+		},
+		[]testTag{
+			b.rational(tagExposureTime, 1, 250),
+			b.rational(tagFNumber, 28, 10),
+			b.short(tagISO, 400),
+			b.ascii(tagDateTimeOriginal, "2024:11:03 11:05:18"),
+			b.ascii(tagOffsetTimeOrig, "+08:00"),
+			b.rational(tagFocalLength, 55, 10),
+			b.short(tagFocalLength35mm, 26),
+			b.ascii(tagLensMake, "Apple"),
+			b.ascii(tagLensModel, "iPhone 15 back camera"),
+		},
+		[]testTag{
+			b.ascii(tagGPSLatitudeRef, "N"),
+			b.rational(tagGPSLatitude, 31, 1, 14, 1, 2250, 100),
+			b.ascii(tagGPSLongitudeRef, "E"),
+			b.rational(tagGPSLongitude, 121, 1, 28, 1, 0, 1),
+			testTag{tagGPSAltitudeRef, 1, 1, []byte{0}},
+			b.rational(tagGPSAltitude, 105, 10),
+		},
+	)
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+func equalFloatPtr(a, b *float64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func TestParse(t *testing.T) {
+	le, be := tiffBuilder{binary.LittleEndian}, tiffBuilder{binary.BigEndian}
+	full := Info{
+		Make: "Apple", Model: "iPhone 15", LensMake: "Apple", LensModel: "iPhone 15 back camera",
+		FocalLength: 5.5, FocalLength35mm: 26, FNumber: 2.8, ExposureTime: "1/250", ISO: 400,
+		DateTaken: "2024:11:03 11:05:18", OffsetTime: "+08:00",
+		Latitude: floatPtr(31.239583), Longitude: floatPtr(121.466667), Altitude: floatPtr(10.5),
+		Orientation: 6,
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Info
+		wantErr error
+	}{
+		{name: "JPEG 小端", data: wrapJPEG(fullTIFF(binary.LittleEndian)), want: full},
+		{name: "JPEG 大端", data: wrapJPEG(fullTIFF(binary.BigEndian)), want: full},
+		{name: "TIFF 文件", data: fullTIFF(binary.LittleEndian), want: full},
+		{
+			name: "容器格式中的 EXIF 块",
+			data: append([]byte("\x00\x00\x00\x18ftypheic....Exif\x00\x00"), fullTIFF(binary.BigEndian)...),
+			want: full,
+		},
+		{
+			name: "南纬西经和海平面以下",
+			data: be.build(nil, nil, []testTag{
+				be.ascii(tagGPSLatitudeRef, "S"),
+				be.rational(tagGPSLatitude, 33, 1, 51, 1, 54, 1),
+				be.ascii(tagGPSLongitudeRef, "W"),
+				be.rational(tagGPSLongitude, 151, 1, 12, 1, 36, 1),
+				testTag{tagGPSAltitudeRef, 1, 1, []byte{1}},
+				be.rational(tagGPSAltitude, 3, 1),
+			}),
+			want: Info{Latitude: floatPtr(-33.865), Longitude: floatPtr(-151.21), Altitude: floatPtr(-3)},
+		},
+		{
+			name: "坐标为 0,0 时视为未定位",
+			data: le.build(nil, nil, []testTag{
+				le.rational(tagGPSLatitude, 0, 1, 0, 1, 0, 1),
+				le.rational(tagGPSLongitude, 0, 1, 0, 1, 0, 1),
+			}),
+			want: Info{},
+		},
+		{
+			name: "没有原始拍摄时间时使用修改时间",
+			data: le.build([]testTag{le.ascii(tagDateTime, "2020:01:02 03:04:05")}, []testTag{le.rational(tagExposureTime, 2, 1)}, nil),
+			want: Info{DateTaken: "2020:01:02 03:04:05", ExposureTime: "2"},
+		},
+		{
+			name: "值超出数据范围的条目被忽略",
+			data: le.build([]testTag{le.ascii(tagModel, "X"), {tagMake, 2, 1000, []byte("abcdefgh")}}, nil, nil),
+			want: Info{Model: "X"},
+		},
+		{name: "没有 EXIF 的 JPEG", data: []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}, wantErr: ErrNoExif},
+		{name: "PNG", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00IEND"), wantErr: ErrNoExif},
+		{name: "IFD 位置超出数据范围", data: []byte("II*\x00\xff\x00\x00\x00"), wantErr: ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotPlain, wantPlain := *got, tt.want
+			gotPlain.Latitude, gotPlain.Longitude, gotPlain.Altitude = nil, nil, nil
+			wantPlain.Latitude, wantPlain.Longitude, wantPlain.Altitude = nil, nil, nil
+			if gotPlain != wantPlain {
+				t.Errorf("Parse = %+v\nwant %+v", gotPlain, wantPlain)
+			}
+			if !equalFloatPtr(got.Latitude, tt.want.Latitude) || !equalFloatPtr(got.Longitude, tt.want.Longitude) || !equalFloatPtr(got.Altitude, tt.want.Altitude) {
+				t.Errorf("定位 = %v,%v,%v", got.Latitude, got.Longitude, got.Altitude)
+			}
+		})
+	}
+}
+
+func TestTakenAt(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	tests := []struct {
+		name string
+		info Info
+		want string
+		ok   bool
+	}{
+		{"使用 EXIF 中的时区", Info{DateTaken: "2024:11:03 11:05:18", OffsetTime: "-05:00"}, "2024-11-03T11:05:18-05:00", true},
+		{"没有时区时使用默认时区", Info{DateTaken: "2024:11:03 11:05:18"}, "2024-11-03T11:05:18+08:00", true},
+		{"时区无法解析时使用默认时区", Info{DateTaken: "2024:11:03 11:05:18", OffsetTime: "Z"}, "2024-11-03T11:05:18+08:00", true},
+		{"没有拍摄时间", Info{}, "", false},
+		{"时间格式无效", Info{DateTaken: "0000:00:00 00:00:00"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.info.TakenAt(loc)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got.Format(time.RFC3339) != tt.want {
+				t.Errorf("TakenAt = %s, want %s", got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatExposure(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		want     string
+	}{
+		{1, 250, "1/250"},
+		{10, 2500, "1/250"},
+		{3, 1000, "1/333"},
+		{2, 1, "2"},
+		{13, 10, "1.3"},
+		{1, 1, "1"},
+		{0, 1, ""},
+		{1, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := formatExposure(tt.num, tt.den); got != tt.want {
+			t.Errorf("formatExposure(%d, %d) = %q, want %q", tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	data := wrapJPEG(fullTIFF(binary.BigEndian))
+
+	stripped, err := StripGPS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Parse(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Latitude != nil || info.Longitude != nil || info.Make != "Apple" || info.ISO != 400 {
+		t.Errorf("StripGPS 后: %+v", info)
+	}
+
+	stripped, err = StripAll(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(stripped); !errors.Is(err, ErrNoExif) {
+		t.Errorf("StripAll 后 Parse err = %v", err)
+	}
+
+	if got := Orientation(data); got != 6 {
+		t.Errorf("Orientation = %d, want 6", got)
+	}
+	if got := Orientation(ResetOrientation(data)); got != 1 {
+		t.Errorf("ResetOrientation 后 Orientation = %d, want 1", got)
+	}
+	if got := Orientation(data); got != 6 {
+		t.Errorf("ResetOrientation 修改了原数据")
+	}
+}
@@ -0,0 +1,46 @@
+package exif
+
+// JPEG 段，start/end 为段内容（不含标记和长度）在文件中的范围
+type segment struct {
+	marker byte
+	offset int // 段标记 0xFF 所在位置
+	start  int
+	end    int
+}
+
+// 列出 JPEG 在图像数据（SOS）之前的所有段
+func jpegSegments(data []byte) []segment {
+	var segments []segment
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		// 填充字节
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		// 没有长度字段的标记
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			pos += 2
+			continue
+		}
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segments = append(segments, segment{
+			marker: marker,
+			offset: pos,
+			start:  pos + 4,
+			end:    pos + 2 + length,
+		})
+		if marker == 0xDA {
+			break
+		}
+		pos += 2 + length
+	}
+	return segments
+}
@@ -0,0 +1,259 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	iccHeader    = []byte("ICC_PROFILE\x00")
+	mpfHeader    = []byte("MPF\x00")
+)
+
+// 移除图片中的 GPS 定位信息，保留其他拍摄信息
+func StripGPS(data []byte) ([]byte, error) {
+	return strip(data, false)
+}
+
+// 移除图片中的全部元数据，保留颜色配置
+func StripAll(data []byte) ([]byte, error) {
+	return strip(data, true)
+}
+
+func strip(data []byte, all bool) ([]byte, error) {
+	switch {
+	case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xD8:
+		return stripJPEG(data, all)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data, all)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebP(data, all)
+	}
+	return data, nil
+}
+
+// 读取 JPEG 的方向标签，没有时返回 1
+func Orientation(data []byte) int {
+	info, err := Parse(data)
+	if err != nil || info.Orientation < 1 || info.Orientation > 8 {
+		return 1
+	}
+	return info.Orientation
+}
+
+// 将 JPEG 中的方向标签重置为 1，用于像素已经旋转过的图片
+func ResetOrientation(data []byte) []byte {
+	start, end, err := findJPEGExif(data)
+	if err != nil {
+		return data
+	}
+	out := append([]byte(nil), data...)
+	t, err := newTIFF(out[start:end])
+	if err != nil {
+		return data
+	}
+	entries, err := t.readIFD(int(t.order.Uint32(t.data[4:8])))
+	if err != nil {
+		return data
+	}
+	for _, e := range entries {
+		if e.tag == tagOrientation && e.typ == 3 && e.count == 1 {
+			t.order.PutUint16(t.data[e.valueOffset:], 1)
+		}
+	}
+	return out
+}
+
+// 把 src 中的 EXIF 和 ICC 段复制到重新编码后的 dst 中
+func CopyJPEGMetadata(src, dst []byte) []byte {
+	if len(dst) < 2 {
+		return dst
+	}
+	var kept []byte
+	for _, seg := range jpegSegments(src) {
+		payload := src[seg.start:seg.end]
+		if (seg.marker == 0xE1 && bytes.HasPrefix(payload, []byte(exifHeader))) ||
+			(seg.marker == 0xE2 && bytes.HasPrefix(payload, iccHeader)) {
+			kept = append(kept, src[seg.offset:seg.end]...)
+		}
+	}
+	out := make([]byte, 0, len(dst)+len(kept))
+	out = append(out, dst[:2]...)
+	out = append(out, kept...)
+	return append(out, dst[2:]...)
+}
+
+func stripJPEG(data []byte, all bool) ([]byte, error) {
+	segments := jpegSegments(data)
+	if len(segments) == 0 || segments[len(segments)-1].marker != 0xDA {
+		return nil, ErrInvalid
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	for _, seg := range segments[:len(segments)-1] {
+		payload := data[seg.start:seg.end]
+		switch {
+		case seg.marker == 0xE1 && bytes.HasPrefix(payload, []byte(exifHeader)):
+			if all {
+				continue
+			}
+			raw := append([]byte(nil), data[seg.offset:seg.end]...)
+			if t, err := newTIFF(raw[4+len(exifHeader):]); err == nil {
+				t.blankGPS()
+			}
+			out = append(out, raw...)
+		case seg.marker == 0xE1:
+			// XMP 中同样可能包含定位信息
+			continue
+		case seg.marker == 0xE2 && bytes.HasPrefix(payload, mpfHeader):
+			// 多图格式的附加图片在主图之后，会一起被截掉
+			continue
+		case all && seg.marker == 0xE2 && !bytes.HasPrefix(payload, iccHeader):
+			continue
+		case all && (seg.marker == 0xFE || (seg.marker >= 0xE3 && seg.marker <= 0xEF && seg.marker != 0xEE)):
+			continue
+		default:
+			out = append(out, data[seg.offset:seg.end]...)
+		}
+	}
+
+	sos := segments[len(segments)-1]
+	return append(out, data[sos.offset:jpegEnd(data, sos.end)]...), nil
+}
+
+// 找到主图 EOI 之后的位置，之后的附加数据（如多图格式的其他图片）会被丢弃
+func jpegEnd(data []byte, from int) int {
+	for i := from; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		switch next := data[i+1]; {
+		case next == 0xD9:
+			return i + 2
+		case next == 0x00 || next == 0xFF || (next >= 0xD0 && next <= 0xD7):
+			continue
+		default:
+			// 渐进式 JPEG 的后续扫描段
+			if i+3 < len(data) {
+				length := int(data[i+2])<<8 | int(data[i+3])
+				if length >= 2 {
+					i += 1 + length
+				}
+			}
+		}
+	}
+	return len(data)
+}
+
+// 清空 GPS 目录中的所有条目和数据
+func (t *tiff) blankGPS() {
+	ifd0, err := t.readIFD(int(t.order.Uint32(t.data[4:8])))
+	if err != nil {
+		return
+	}
+	for _, e := range ifd0 {
+		if e.tag != tagGPSIFD {
+			continue
+		}
+		offset := t.uint(e)
+		entries, err := t.readIFD(offset)
+		if err != nil {
+			return
+		}
+		for _, g := range entries {
+			if g.size() > 4 {
+				zero(t.data[g.valueOffset : g.valueOffset+g.size()])
+			}
+		}
+		n := int(t.order.Uint16(t.data[offset:]))
+		zero(t.data[offset+2 : offset+2+n*12])
+		t.order.PutUint16(t.data[offset:], 0)
+	}
+}
+
+func stripPNG(data []byte, all bool) ([]byte, error) {
+	out := append([]byte(nil), pngSignature...)
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrInvalid
+		}
+		typ := string(data[pos+4 : pos+8])
+		body := data[pos+8 : pos+8+length]
+
+		drop := false
+		switch typ {
+		case "eXIf":
+			drop = true
+		case "iTXt":
+			drop = all || bytes.HasPrefix(body, []byte("XML:com.adobe.xmp\x00"))
+		case "tEXt", "zTXt", "tIME":
+			drop = all
+		}
+		if !drop {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+		if typ == "IEND" {
+			break
+		}
+	}
+	return out, nil
+}
+
+func stripWebP(data []byte, all bool) ([]byte, error) {
+	out := append([]byte(nil), data[:12]...)
+	vp8x := -1
+	pos := 12
+	for pos+8 <= len(data) {
+		fourcc := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || pos+8+size > len(data) {
+			return nil, ErrInvalid
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+
+		switch {
+		case fourcc == "XMP ", fourcc == "EXIF" && all:
+			pos = end
+			continue
+		case fourcc == "EXIF":
+			chunk := append([]byte(nil), data[pos:end]...)
+			body := chunk[8 : 8+size]
+			body = bytes.TrimPrefix(body, []byte(exifHeader))
+			if t, err := newTIFF(body); err == nil {
+				t.blankGPS()
+			}
+			out = append(out, chunk...)
+			pos = end
+			continue
+		case fourcc == "VP8X":
+			vp8x = len(out) + 8
+		}
+		out = append(out, data[pos:end]...)
+		pos = end
+	}
+
+	// 更新 VP8X 中的 EXIF/XMP 标志位
+	if vp8x >= 0 && vp8x < len(out) {
+		out[vp8x] &^= 0x04
+		if all {
+			out[vp8x] &^= 0x08
+		}
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,649 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"server/models"
+	"server/repository"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errAlbumNotFound = errors.New("相册不存在")
+
+// 请求内容不合法，错误信息直接返回给客户端
+type albumRequestError string
+
+func (e albumRequestError) Error() string { return string(e) }
+
+// 相册及其照片数量、封面和子相册
+type AlbumItem struct {
+	models.Album
+	PhotoCount int           `json:"photo_count"`
+	Cover      *models.Photo `json:"cover,omitempty"`
+	Children   []*AlbumItem  `json:"children,omitempty"`
+}
+
+// 获取相册列表，tree=true 时按层级嵌套返回；visibility 按实际可见性过滤，上级相册不可见时子相册也不可见。
+// 没有口令的请求只列出公开相册
+func HandleGetAlbums(c *gin.Context) {
+	albumsData, err := readAlbumsData()
+	if err != nil {
+		utils.Logger.Printf("读取相册数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+	photoList, err := repository.Photos.List()
+	if err != nil {
+		utils.Logger.Printf("读取照片数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+
+	albums := albumIndex(albumsData.Albums)
+	photos := photoIndex(photoList)
+	visibility := c.Query("visibility")
+	if !isOwner(c) {
+		if visibility != "" && visibility != models.AlbumPublic {
+			c.JSON(http.StatusOK, gin.H{"albums": []*AlbumItem{}})
+			return
+		}
+		visibility = models.AlbumPublic
+	}
+
+	items := make(map[string]*AlbumItem)
+	list := []*AlbumItem{}
+	for _, album := range sortAlbums(albumsData.Albums) {
+		if visibility != "" && albums.visibility(album.ID) != visibility {
+			continue
+		}
+		item := buildAlbumItem(c, album, photos)
+		items[album.ID] = item
+		list = append(list, item)
+	}
+
+	if c.Query("tree") != "true" {
+		c.JSON(http.StatusOK, gin.H{"albums": list})
+		return
+	}
+
+	roots := []*AlbumItem{}
+	for _, item := range list {
+		if parent, ok := items[item.ParentID]; ok {
+			parent.Children = append(parent.Children, item)
+		} else {
+			roots = append(roots, item)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"albums": roots})
+}
+
+// 获取单个相册，包含按顺序排列的照片、子相册和上级相册路径。
+// 没有口令时私密相册返回 404，不公开列出的相册可以通过 ID 访问，但不列出其中不公开的子相册
+func HandleGetAlbumById(c *gin.Context) {
+	albumsData, err := readAlbumsData()
+	if err != nil {
+		utils.Logger.Printf("读取相册数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+	photoList, err := repository.Photos.List()
+	if err != nil {
+		utils.Logger.Printf("读取照片数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+
+	albums := albumIndex(albumsData.Albums)
+	owner := isOwner(c)
+	album, ok := albums[c.Param("id")]
+	if !ok || (!owner && albums.visibility(album.ID) == models.AlbumPrivate) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "相册不存在"})
+		return
+	}
+	photos := photoIndex(photoList)
+
+	albumPhotos := []models.Photo{}
+	for _, id := range album.PhotoIDs {
+		if photo, ok := photos[id]; ok {
+			albumPhotos = append(albumPhotos, presentPhoto(c, photo))
+		}
+	}
+
+	children := []*AlbumItem{}
+	for _, child := range sortAlbums(albumsData.Albums) {
+		if child.ParentID == album.ID && (owner || child.Visibility == models.AlbumPublic) {
+			children = append(children, buildAlbumItem(c, child, photos))
+		}
+	}
+
+	path := []gin.H{}
+	for _, ancestor := range albums.ancestors(album.ID) {
+		path = append([]gin.H{{"id": ancestor.ID, "title": ancestor.Title}}, path...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"album":                buildAlbumItem(c, album, photos),
+		"photos":               albumPhotos,
+		"children":             children,
+		"path":                 path,
+		"effective_visibility": albums.visibility(album.ID),
+	})
+}
+
+// 新建相册
+func HandleCreateAlbum(c *gin.Context) {
+	var req models.AlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	var album models.Album
+	err := updateAlbumsData(func(albumsData *models.AlbumsData) error {
+		now := time.Now()
+		album = models.Album{
+			ID:        uuid.New().String(),
+			PhotoIDs:  []string{},
+			CreatedAt: now,
+		}
+		if err := applyAlbumRequest(&album, req, albumsData); err != nil {
+			return err
+		}
+		if req.SortOrder == nil {
+			album.SortOrder = nextAlbumSortOrder(albumsData, album.ParentID)
+		}
+		album.UpdatedAt = now
+		albumsData.Albums = append(albumsData.Albums, album)
+		return nil
+	})
+	if err != nil {
+		respondAlbumError(c, err, "保存失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, album)
+}
+
+// 更新相册信息
+func HandleUpdateAlbum(c *gin.Context) {
+	var req models.AlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	id := c.Param("id")
+	var album models.Album
+	err := updateAlbumsData(func(albumsData *models.AlbumsData) error {
+		i := findAlbum(albumsData, id)
+		if i < 0 {
+			return errAlbumNotFound
+		}
+		album = albumsData.Albums[i]
+		parentChanged := req.ParentID != album.ParentID
+		if err := applyAlbumRequest(&album, req, albumsData); err != nil {
+			return err
+		}
+		// 移动到新的父相册时排在最后
+		if parentChanged && req.SortOrder == nil {
+			album.SortOrder = nextAlbumSortOrder(albumsData, album.ParentID)
+		}
+		album.UpdatedAt = time.Now()
+		albumsData.Albums[i] = album
+		return nil
+	})
+	if err != nil {
+		respondAlbumError(c, err, "保存失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, album)
+}
+
+// 删除相册，子相册移动到上一级，照片本身不受影响
+func HandleDeleteAlbum(c *gin.Context) {
+	id := c.Param("id")
+	err := updateAlbumsData(func(albumsData *models.AlbumsData) error {
+		i := findAlbum(albumsData, id)
+		if i < 0 {
+			return errAlbumNotFound
+		}
+		deleted := albumsData.Albums[i]
+		albumsData.Albums = append(albumsData.Albums[:i], albumsData.Albums[i+1:]...)
+
+		next := nextAlbumSortOrder(albumsData, deleted.ParentID)
+		for _, child := range sortAlbums(albumsData.Albums) {
+			if child.ParentID != id {
+				continue
+			}
+			j := findAlbum(albumsData, child.ID)
+			albumsData.Albums[j].ParentID = deleted.ParentID
+			albumsData.Albums[j].SortOrder = next
+			albumsData.Albums[j].UpdatedAt = time.Now()
+			next++
+		}
+		return nil
+	})
+	if err != nil {
+		respondAlbumError(c, err, "删除失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 设置相册中的照片及顺序，拖拽排序后提交完整列表
+func HandleSetAlbumPhotos(c *gin.Context) {
+	updateAlbumPhotos(c, func(album *models.Album, photoIDs []string) {
+		album.PhotoIDs = photoIDs
+	})
+}
+
+// 向相册添加照片，已在相册中的照片保持原位置
+func HandleAddAlbumPhotos(c *gin.Context) {
+	updateAlbumPhotos(c, func(album *models.Album, photoIDs []string) {
+		album.PhotoIDs = uniqueStrings(append(album.PhotoIDs, photoIDs...))
+	})
+}
+
+// 从相册移除照片
+func HandleRemoveAlbumPhoto(c *gin.Context) {
+	id, photoID := c.Param("id"), c.Param("photoId")
+	err := updateAlbumsData(func(albumsData *models.AlbumsData) error {
+		i := findAlbum(albumsData, id)
+		if i < 0 {
+			return errAlbumNotFound
+		}
+		album := &albumsData.Albums[i]
+		album.PhotoIDs = removeString(album.PhotoIDs, photoID)
+		if album.CoverPhotoID == photoID {
+			album.CoverPhotoID = ""
+		}
+		album.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		respondAlbumError(c, err, "保存失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "移除成功"})
+}
+
+// 调整同一父相册下子相册的顺序
+func HandleReorderAlbums(c *gin.Context) {
+	var req models.AlbumOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	err := updateAlbumsData(func(albumsData *models.AlbumsData) error {
+		ids := uniqueStrings(req.AlbumIDs)
+		for _, id := range ids {
+			i := findAlbum(albumsData, id)
+			if i < 0 {
+				return albumRequestError("相册不存在: " + id)
+			}
+			if albumsData.Albums[i].ParentID != req.ParentID {
+				return albumRequestError("相册不属于同一个父相册: " + id)
+			}
+		}
+
+		// 未列出的相册排在后面，保持原有顺序
+		order := make(map[string]int, len(ids))
+		for i, id := range ids {
+			order[id] = i
+		}
+		next := len(ids)
+		for _, album := range sortAlbums(albumsData.Albums) {
+			if album.ParentID != req.ParentID {
+				continue
+			}
+			i := findAlbum(albumsData, album.ID)
+			if pos, ok := order[album.ID]; ok {
+				albumsData.Albums[i].SortOrder = pos
+			} else {
+				albumsData.Albums[i].SortOrder = next
+				next++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondAlbumError(c, err, "保存失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "排序已保存"})
+}
+
+// 辅助函数
+func updateAlbumPhotos(c *gin.Context, apply func(album *models.Album, photoIDs []string)) {
+	var req models.AlbumPhotosRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	photoList, err := repository.Photos.List()
+	if err != nil {
+		utils.Logger.Printf("读取照片数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+	photos := photoIndex(photoList)
+	photoIDs := uniqueStrings(req.PhotoIDs)
+	for _, id := range photoIDs {
+		if _, ok := photos[id]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "照片不存在: " + id})
+			return
+		}
+	}
+
+	id := c.Param("id")
+	var album models.Album
+	err = updateAlbumsData(func(albumsData *models.AlbumsData) error {
+		i := findAlbum(albumsData, id)
+		if i < 0 {
+			return errAlbumNotFound
+		}
+		apply(&albumsData.Albums[i], photoIDs)
+		// 封面照片被移出相册时清空
+		if cover := albumsData.Albums[i].CoverPhotoID; cover != "" && !containsString(albumsData.Albums[i].PhotoIDs, cover) {
+			albumsData.Albums[i].CoverPhotoID = ""
+		}
+		albumsData.Albums[i].UpdatedAt = time.Now()
+		album = albumsData.Albums[i]
+		return nil
+	})
+	if err != nil {
+		respondAlbumError(c, err, "保存失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, album)
+}
+
+// 校验请求并写入相册字段
+func applyAlbumRequest(album *models.Album, req models.AlbumRequest, albumsData *models.AlbumsData) error {
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		return albumRequestError("相册标题不能为空")
+	}
+
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = models.AlbumPublic
+	}
+	switch visibility {
+	case models.AlbumPublic, models.AlbumUnlisted, models.AlbumPrivate:
+	default:
+		return albumRequestError("可见性只能是 public、unlisted 或 private")
+	}
+
+	if req.ParentID != "" {
+		albums := albumIndex(albumsData.Albums)
+		if _, ok := albums[req.ParentID]; !ok {
+			return albumRequestError("父相册不存在")
+		}
+		if req.ParentID == album.ID {
+			return albumRequestError("不能把相册设为自己的子相册")
+		}
+		for _, ancestor := range albums.ancestors(req.ParentID) {
+			if ancestor.ID == album.ID {
+				return albumRequestError("不能把相册移动到自己的子相册下")
+			}
+		}
+	}
+
+	if req.CoverPhotoID != "" && !containsString(album.PhotoIDs, req.CoverPhotoID) {
+		return albumRequestError("封面照片必须在相册中")
+	}
+
+	album.Title = title
+	album.Description = strings.TrimSpace(req.Description)
+	album.CoverPhotoID = req.CoverPhotoID
+	album.ParentID = req.ParentID
+	album.Visibility = visibility
+	if req.SortOrder != nil {
+		album.SortOrder = *req.SortOrder
+	}
+	return nil
+}
+
+func buildAlbumItem(c *gin.Context, album models.Album, photos map[string]models.Photo) *AlbumItem {
+	item := &AlbumItem{Album: album}
+	if item.PhotoIDs == nil {
+		item.PhotoIDs = []string{}
+	}
+
+	// 未设置封面或封面照片在回收站中时使用第一张照片
+	coverID := album.CoverPhotoID
+	if _, ok := photos[coverID]; !ok {
+		coverID = ""
+	}
+	for _, id := range album.PhotoIDs {
+		if _, ok := photos[id]; !ok {
+			continue
+		}
+		item.PhotoCount++
+		if coverID == "" {
+			coverID = id
+		}
+	}
+	if cover, ok := photos[coverID]; ok {
+		cover = presentPhoto(c, cover)
+		item.Cover = &cover
+	}
+	return item
+}
+
+// 按父相册、排序值和创建时间排序
+func sortAlbums(albums []models.Album) []models.Album {
+	sorted := append([]models.Album(nil), albums...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ParentID != sorted[j].ParentID {
+			return sorted[i].ParentID < sorted[j].ParentID
+		}
+		if sorted[i].SortOrder != sorted[j].SortOrder {
+			return sorted[i].SortOrder < sorted[j].SortOrder
+		}
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+	return sorted
+}
+
+func nextAlbumSortOrder(albumsData *models.AlbumsData, parentID string) int {
+	next := 0
+	for _, album := range albumsData.Albums {
+		if album.ParentID == parentID && album.SortOrder >= next {
+			next = album.SortOrder + 1
+		}
+	}
+	return next
+}
+
+func findAlbum(albumsData *models.AlbumsData, id string) int {
+	for i, album := range albumsData.Albums {
+		if album.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+type albumMap map[string]models.Album
+
+func albumIndex(albums []models.Album) albumMap {
+	index := make(albumMap, len(albums))
+	for _, album := range albums {
+		index[album.ID] = album
+	}
+	return index
+}
+
+// 从父相册开始向上的所有上级相册
+func (m albumMap) ancestors(id string) []models.Album {
+	var result []models.Album
+	seen := map[string]bool{id: true}
+	for parentID := m[id].ParentID; parentID != "" && !seen[parentID]; parentID = m[parentID].ParentID {
+		parent, ok := m[parentID]
+		if !ok {
+			break
+		}
+		seen[parentID] = true
+		result = append(result, parent)
+	}
+	return result
+}
+
+// 实际可见性取相册和所有上级相册中最严格的一个
+func (m albumMap) visibility(id string) string {
+	rank := map[string]int{models.AlbumPublic: 0, models.AlbumUnlisted: 1, models.AlbumPrivate: 2}
+	visibility := m[id].Visibility
+	for _, ancestor := range m.ancestors(id) {
+		if rank[ancestor.Visibility] > rank[visibility] {
+			visibility = ancestor.Visibility
+		}
+	}
+	return visibility
+}
+
+// 回收站中的照片不计入，相册中暂时不显示，恢复后重新出现
+func photoIndex(photos []models.Photo) map[string]models.Photo {
+	index := make(map[string]models.Photo, len(photos))
+	for _, photo := range photos {
+		if !photo.Deleted {
+			index[photo.ID] = photo
+		}
+	}
+	return index
+}
+
+// 同一请求中只读取一次相册数据
+func requestAlbumsData(c *gin.Context) models.AlbumsData {
+	if v, ok := c.Get("albumsData"); ok {
+		return v.(models.AlbumsData)
+	}
+	albumsData, err := readAlbumsData()
+	if err != nil {
+		utils.Logger.Printf("读取相册数据失败: %v", err)
+	}
+	c.Set("albumsData", albumsData)
+	return albumsData
+}
+
+// 照片所在的相册，includePrivate 为 false 时不包含私密相册
+func photoAlbumIDs(albumsData models.AlbumsData, photoID string, includePrivate bool) []string {
+	albums := albumIndex(albumsData.Albums)
+	var ids []string
+	for _, album := range albumsData.Albums {
+		if !includePrivate && albums.visibility(album.ID) == models.AlbumPrivate {
+			continue
+		}
+		if containsString(album.PhotoIDs, photoID) {
+			ids = append(ids, album.ID)
+		}
+	}
+	return ids
+}
+
+// 只在私密相册中的照片，不在任何相册中的照片不算
+func privatePhotoIDs(albumsData models.AlbumsData) map[string]bool {
+	albums := albumIndex(albumsData.Albums)
+	private := make(map[string]bool)
+	visible := make(map[string]bool)
+	for _, album := range albumsData.Albums {
+		for _, id := range album.PhotoIDs {
+			if albums.visibility(album.ID) == models.AlbumPrivate {
+				private[id] = true
+			} else {
+				visible[id] = true
+			}
+		}
+	}
+	for id := range visible {
+		delete(private, id)
+	}
+	return private
+}
+
+// 照片删除后从所有相册中移除
+func removePhotoFromAlbums(photoID string) error {
+	return updateAlbumsData(func(albumsData *models.AlbumsData) error {
+		for i := range albumsData.Albums {
+			album := &albumsData.Albums[i]
+			album.PhotoIDs = removeString(album.PhotoIDs, photoID)
+			if album.CoverPhotoID == photoID {
+				album.CoverPhotoID = ""
+			}
+		}
+		return nil
+	})
+}
+
+func respondAlbumError(c *gin.Context, err error, message string) {
+	var reqErr albumRequestError
+	switch {
+	case errors.As(err, &reqErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": reqErr.Error()})
+	case errors.Is(err, errAlbumNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "相册不存在"})
+	default:
+		utils.Logger.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+func uniqueStrings(values []string) []string {
+	result := []string{}
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(values []string, target string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != target {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// 读取相册数据，文件不存在时返回空数据
+func readAlbumsData() (models.AlbumsData, error) {
+	albumsData, err := repository.Albums.Read()
+	if albumsData.Albums == nil {
+		albumsData.Albums = []models.Album{}
+	}
+	return albumsData, err
+}
+
+// 串行执行相册数据的读取、修改和保存
+func updateAlbumsData(fn func(*models.AlbumsData) error) error {
+	return repository.Albums.Update(fn)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"os"
 
@@ -25,4 +26,10 @@ func ValidatePassphrase(c *gin.Context) {
 			false: "验证失败",
 		}[isValid],
 	})
-} 
\ No newline at end of file
+}
+
+// 请求头 X-Passphrase 中带有正确口令时可以查看私密和不公开列出的内容
+func isOwner(c *gin.Context) bool {
+	passphrase := c.GetHeader("X-Passphrase")
+	return passphrase != "" && subtle.ConstantTimeCompare([]byte(passphrase), []byte(os.Getenv("SECRET_PASSPHRASE"))) == 1
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"server/config"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量上传中单个文件的处理结果
+type BatchUploadResult struct {
+	Index    int    `json:"index"`
+	Filename string `json:"filename"`
+	Success  bool   `json:"success"`
+	ImageURL string `json:"imageUrl,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// 暂存到磁盘、等待处理的文件
+type batchUploadJob struct {
+	index    int
+	filename string
+	tempPath string
+}
+
+// 批量上传图片，multipart 逐个读取并暂存到磁盘，由固定数量的 worker 并发处理；
+// createPhoto=true 时用上传成功的图片新建照片
+func HandleBatchUpload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxBatchSize)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		results = []BatchUploadResult{}
+		wg      sync.WaitGroup
+	)
+	setResult := func(result BatchUploadResult) {
+		mu.Lock()
+		results[result.Index] = result
+		mu.Unlock()
+	}
+
+	jobs := make(chan batchUploadJob)
+	for i := 0; i < config.UploadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				setResult(processBatchUpload(c, job))
+			}
+		}()
+	}
+
+	fields := make(map[string]string)
+	var readErr error
+	tooLarge := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			tooLarge = isMaxBytesError(err)
+			break
+		}
+
+		if part.FileName() == "" {
+			value, _ := io.ReadAll(io.LimitReader(part, 64<<10))
+			fields[part.FormName()] = string(value)
+			part.Close()
+			continue
+		}
+
+		mu.Lock()
+		index := len(results)
+		results = append(results, BatchUploadResult{Index: index, Filename: part.FileName()})
+		mu.Unlock()
+
+		tempPath, err := stageBatchPart(part, config.MaxBatchFileSize)
+		fileTooLarge := errors.Is(err, errBatchFileTooLarge)
+		if fileTooLarge {
+			// 跳过这个文件的剩余内容，继续读取后面的文件
+			_, err = io.Copy(io.Discard, part)
+		}
+		part.Close()
+		if isMaxBytesError(err) {
+			// 整个请求超过大小限制，之后的内容无法再读取
+			setResult(BatchUploadResult{Index: index, Filename: part.FileName(), Error: "文件过大"})
+			readErr = err
+			tooLarge = true
+			break
+		}
+		if fileTooLarge {
+			setResult(BatchUploadResult{Index: index, Filename: part.FileName(), Error: "文件过大"})
+			continue
+		}
+		if err != nil {
+			utils.Logger.Printf("暂存上传文件失败 %s: %v", part.FileName(), err)
+			setResult(BatchUploadResult{Index: index, Filename: part.FileName(), Error: "读取文件失败"})
+			continue
+		}
+		jobs <- batchUploadJob{index: index, filename: part.FileName(), tempPath: tempPath}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if readErr != nil {
+		utils.Logger.Printf("读取批量上传请求失败: %v", readErr)
+	}
+	if len(results) == 0 && !tooLarge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有上传任何文件"})
+		return
+	}
+
+	succeeded := 0
+	var urls []string
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+			urls = append(urls, result.Path)
+		}
+	}
+
+	response := gin.H{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	}
+	// 整个请求超过大小限制时之后的文件没有读取，已上传的文件照常返回并新建照片
+	status := http.StatusOK
+	if tooLarge {
+		status = http.StatusRequestEntityTooLarge
+		response["error"] = "请求超过大小限制，之后的文件未上传"
+	} else if readErr != nil {
+		response["error"] = "请求未完整接收，部分文件可能缺失"
+	}
+
+	if fields["createPhoto"] == "true" && len(urls) > 0 {
+		photo, err := createPhoto(PhotoRequest{
+			URLs:        urls,
+			Title:       fields["title"],
+			Description: fields["description"],
+			Category:    fields["category"],
+			Created:     fields["created"],
+		})
+		if err != nil {
+			utils.Logger.Printf("保存照片失败: %v", err)
+			response["photoError"] = "保存照片失败"
+		} else {
+			response["photo"] = presentPhoto(c, photo)
+		}
+	}
+
+	c.JSON(status, response)
+}
+
+var errBatchFileTooLarge = errors.New("文件过大")
+
+// 把上传的文件写入暂存目录，避免整个请求缓存在内存中
+func stageBatchPart(part io.Reader, limit int64) (string, error) {
+	f, err := os.CreateTemp(config.UploadsDir, "batch-*.part")
+	if err != nil {
+		return "", err
+	}
+	written, err := io.Copy(f, io.LimitReader(part, limit+1))
+	if err == nil && written > limit {
+		err = errBatchFileTooLarge
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func isMaxBytesError(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func processBatchUpload(c *gin.Context, job batchUploadJob) BatchUploadResult {
+	defer os.Remove(job.tempPath)
+
+	result := BatchUploadResult{Index: job.index, Filename: job.filename}
+	data, err := os.ReadFile(job.tempPath)
+	if err != nil {
+		result.Error = "读取文件失败"
+		return result
+	}
+
+	filename, err := saveImage(job.filename, data)
+	if err != nil {
+		utils.Logger.Printf("保存文件失败 %s: %v", job.filename, err)
+		result.Error = "保存文件失败"
+		if errors.Is(err, errUnsupportedImageType) {
+			result.Error = "不支持的文件类型"
+		}
+		return result
+	}
+
+	result.Success = true
+	result.ImageURL = imageURL(c, filename)
+	result.Path = imagePath(filename)
+	return result
+}
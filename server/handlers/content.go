@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"server/config"
+	"server/storage"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 提供 /content 下的静态文件，图片从存储后端读取
+func HandleServeContent(c *gin.Context) {
+	filePath := c.Param("filepath")
+	if name, ok := strings.CutPrefix(filePath, "/images/"); ok {
+		serveImage(c, name)
+		return
+	}
+	c.FileFromFS(filePath, gin.Dir(config.ContentDir, false))
+}
+
+// 本地存储直接返回文件，其他存储跳转到存储服务的访问地址
+func serveImage(c *gin.Context, name string) {
+	if local, ok := storage.Images.(*storage.Local); ok {
+		p, err := local.Path(name)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.File(p)
+		return
+	}
+
+	u, err := storage.Images.URL(name, config.S3URLExpiry)
+	if err != nil {
+		utils.Logger.Printf("获取图片地址失败 %s: %v", name, err)
+		c.Status(http.StatusNotFound)
+		return
+	}
+	// 签名地址过期前浏览器可以缓存跳转
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(config.S3URLExpiry.Seconds()/2)))
+	c.Redirect(http.StatusFound, u)
+}
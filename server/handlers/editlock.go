@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 编辑会话由客户端生成，每个编辑页面使用不同的值
+const editSessionHeader = "X-Edit-Session"
+
+// 编辑锁只保存在内存中，重启后由编辑页面重新获取
+var editLocks = struct {
+	sync.Mutex
+	items map[string]models.EditLock
+}{items: make(map[string]models.EditLock)}
+
+// 获取文章的编辑锁，其他会话持有未过期的锁时返回 423，force 为 true 时强制接管
+func HandleAcquireEditLock(c *gin.Context) {
+	id := c.Param("id")
+	session := c.GetHeader(editSessionHeader)
+	if session == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 " + editSessionHeader + " 请求头"})
+		return
+	}
+	var req models.EditLockRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+			return
+		}
+	}
+	if _, err := repository.Posts.Get(id); err != nil {
+		respondPostError(c, err, "读取文章失败")
+		return
+	}
+
+	editLocks.Lock()
+	defer editLocks.Unlock()
+	now := time.Now()
+	lock, held := activeEditLock(id, now)
+	if held && lock.Session != session && !req.Force {
+		c.JSON(http.StatusLocked, gin.H{"error": "文章正在被其他人编辑", "lock": lock})
+		return
+	}
+	if !held || lock.Session != session {
+		lock = models.EditLock{PostID: id, Session: session, AcquiredAt: now}
+	}
+	if req.Holder != "" {
+		lock.Holder = req.Holder
+	}
+	lock.ExpiresAt = now.Add(config.EditLockTTL)
+	editLocks.items[id] = lock
+
+	c.JSON(http.StatusOK, lock)
+}
+
+// 续期编辑锁，锁已过期或被其他会话接管时返回 409
+func HandleRenewEditLock(c *gin.Context) {
+	id := c.Param("id")
+	session := c.GetHeader(editSessionHeader)
+
+	editLocks.Lock()
+	defer editLocks.Unlock()
+	now := time.Now()
+	lock, held := activeEditLock(id, now)
+	if !held || lock.Session != session {
+		response := gin.H{"error": "没有持有这篇文章的编辑锁"}
+		if held {
+			response["lock"] = lock
+		}
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+	lock.ExpiresAt = now.Add(config.EditLockTTL)
+	editLocks.items[id] = lock
+
+	c.JSON(http.StatusOK, lock)
+}
+
+// 释放编辑锁，只能释放自己持有的锁
+func HandleReleaseEditLock(c *gin.Context) {
+	id := c.Param("id")
+	session := c.GetHeader(editSessionHeader)
+
+	editLocks.Lock()
+	defer editLocks.Unlock()
+	lock, held := activeEditLock(id, time.Now())
+	if held && lock.Session != session {
+		c.JSON(http.StatusConflict, gin.H{"error": "编辑锁由其他会话持有", "lock": lock})
+		return
+	}
+	delete(editLocks.items, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "编辑锁已释放"})
+}
+
+// 查看文章当前由谁编辑
+func HandleGetEditLock(c *gin.Context) {
+	editLocks.Lock()
+	lock, held := activeEditLock(c.Param("id"), time.Now())
+	editLocks.Unlock()
+
+	if !held {
+		c.JSON(http.StatusOK, gin.H{"locked": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"locked": true,
+		"lock":   lock,
+		"mine":   lock.Session == c.GetHeader(editSessionHeader),
+	})
+}
+
+// 返回未过期的编辑锁，过期的锁顺便清除；调用方需持有 editLocks
+func activeEditLock(id string, now time.Time) (models.EditLock, bool) {
+	lock, ok := editLocks.items[id]
+	if !ok {
+		return models.EditLock{}, false
+	}
+	if !now.Before(lock.ExpiresAt) {
+		delete(editLocks.items, id)
+		return models.EditLock{}, false
+	}
+	return lock, true
+}
+
+// 其他会话持有编辑锁时保存文章
+type editLockError struct {
+	Lock models.EditLock
+}
+
+func (e *editLockError) Error() string { return "文章正在被其他人编辑" }
+
+// 保存文章前检查编辑锁：refuse 模式下返回 editLockError，
+// warn 模式下放行并返回需要提示的锁
+func checkEditLock(c *gin.Context, id string) (*models.EditLock, error) {
+	editLocks.Lock()
+	lock, held := activeEditLock(id, time.Now())
+	editLocks.Unlock()
+
+	if !held || lock.Session == c.GetHeader(editSessionHeader) {
+		return nil, nil
+	}
+	if config.EditLockMode == config.EditLockRefuse {
+		return nil, &editLockError{Lock: lock}
+	}
+	c.Header("X-Edit-Lock-Warning", "locked")
+	return &lock, nil
+}
+
+// 其他会话持有编辑锁时返回 423，返回 true 表示已响应
+func respondEditLock(c *gin.Context, err error) bool {
+	var lErr *editLockError
+	if !errors.As(err, &lErr) {
+		return false
+	}
+	c.JSON(http.StatusLocked, gin.H{"error": lErr.Error(), "lock": lErr.Lock})
+	return true
+}
+
+// 文章被永久删除后编辑锁也不再需要
+func dropEditLock(id string) {
+	editLocks.Lock()
+	delete(editLocks.items, id)
+	editLocks.Unlock()
+}
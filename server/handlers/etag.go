@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"server/config"
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errPreconditionRequired = errors.New("修改前需要提供 If-Match 请求头")
+
+// If-Match 与当前版本不一致，Current 为当前保存的内容
+type preconditionError struct {
+	ETag    string
+	Current any
+}
+
+func (e *preconditionError) Error() string { return "内容已被修改，版本不匹配" }
+
+// 以保存的内容计算 ETag，内容不变时 ETag 不变
+func entityETag(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// 检查写请求的 If-Match，应在读取到当前内容后、修改之前调用
+func checkIfMatch(c *gin.Context, current any) error {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if config.RequireIfMatch {
+			return errPreconditionRequired
+		}
+		return nil
+	}
+	etag := entityETag(current)
+	if !etagListMatch(header, etag, false) {
+		return &preconditionError{ETag: etag, Current: current}
+	}
+	return nil
+}
+
+// 读取请求带有 If-None-Match 且内容未变化时返回 304，返回 true 表示已响应
+func notModified(c *gin.Context, current any) bool {
+	etag := entityETag(current)
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && etagListMatch(header, etag, true) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// If-Match 使用强比较，If-None-Match 使用弱比较，* 匹配任何版本
+func etagListMatch(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// 版本不匹配时返回 412 和当前内容，缺少 If-Match 时返回 428；返回 true 表示已响应
+func respondPrecondition(c *gin.Context, err error) bool {
+	var pErr *preconditionError
+	switch {
+	case errors.As(err, &pErr):
+		c.Header("ETag", pErr.ETag)
+		response := gin.H{"error": pErr.Error(), "etag": pErr.ETag}
+		switch current := pErr.Current.(type) {
+		case models.Post:
+			response["current"] = presentPost(c, postResponse(current))
+		case models.Photo:
+			response["current"] = presentPhoto(c, current)
+		}
+		c.JSON(http.StatusPreconditionFailed, response)
+		return true
+	case errors.Is(err, errPreconditionRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
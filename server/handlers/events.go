@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/events"
+	"server/models"
+	"server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 连接空闲时定期发送注释，避免被代理断开
+const eventHeartbeatInterval = 15 * time.Second
+
+// 以 Server-Sent Events 推送内容变化。
+// types 参数按类型过滤，如 types=post.*,image.uploaded；断线重连时按 Last-Event-ID 补发错过的事件，
+// 错过的事件已无法补齐时先发送 reset 事件，客户端应重新加载数据
+func HandleEvents(c *gin.Context) {
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		// EventSource 无法自定义请求头时可以用参数传递
+		lastID = c.Query("last_event_id")
+	}
+
+	sub := events.Default.Subscribe(filter, lastID)
+	defer sub.Cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !sub.Complete {
+		writeSSE(c, sub.LastID, "reset", gin.H{"last_event_id": sub.LastID})
+	}
+	for _, event := range sub.Replay {
+		writeSSE(c, event.ID, event.Type, event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// 处理太慢被断开，客户端重连后按 Last-Event-ID 补齐
+				return
+			}
+			writeSSE(c, event.ID, event.Type, event)
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeSSE(c *gin.Context, id, eventType string, data any) {
+	payload, _ := json.Marshal(data)
+	if id != "" {
+		fmt.Fprintf(c.Writer, "id: %s\n", id)
+	}
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", eventType, payload)
+}
+
+// 解析 types 参数，可以重复或用逗号分隔；"post.*" 表示所有文章事件
+func parseEventFilter(c *gin.Context) (events.Filter, error) {
+	var filter events.Filter
+	for _, value := range c.QueryArray("types") {
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if !knownEventPattern(pattern) {
+				return nil, fmt.Errorf("未知的事件类型: %s", pattern)
+			}
+			filter = append(filter, pattern)
+		}
+	}
+	return filter, nil
+}
+
+func knownEventPattern(pattern string) bool {
+	for _, eventType := range events.Types {
+		if (events.Filter{pattern}).Match(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// 文章事件只携带摘要信息，客户端需要时再读取全文
+func publishPostEvent(eventType string, post models.Post) {
+	// 草稿不公开，修改时不通知订阅者
+	if repository.IsDraft(post) {
+		return
+	}
+	events.Publish(eventType, gin.H{
+		"id":       post.ID,
+		"title":    post.Title,
+		"category": post.Category,
+		"updated":  post.Updated,
+	})
+}
+
+func publishPhotoEvent(eventType string, photo models.Photo) {
+	events.Publish(eventType, gin.H{
+		"id":       photo.ID,
+		"title":    photo.Title,
+		"category": photo.Category,
+		"urls":     photoURLs(photo.Images),
+	})
+}
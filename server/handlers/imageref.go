@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"server/config"
+	"server/repository"
+	"server/storage"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 图片引用来源
+type ImageRef struct {
+	Type    string `json:"type"` // post 或 photo
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Deleted bool   `json:"deleted"`
+}
+
+// 图片文件名 -> 引用该图片的文章和照片
+type imageRefIndex map[string][]ImageRef
+
+// 未被引用的图片
+type OrphanImage struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// 图片回收结果
+type ImageGCResult struct {
+	DryRun    bool          `json:"dryRun"`
+	Orphans   []OrphanImage `json:"orphans"`
+	TotalSize int64         `json:"totalSize"`
+	Removed   int           `json:"removed"`
+	Failed    []string      `json:"failed"`
+}
+
+var (
+	markdownImageRegex = regexp.MustCompile(`!\[.*?\]\((.*?)\)`)
+	htmlImageRegex     = regexp.MustCompile(`<img[^>]+src=["']([^"']+)["']`)
+)
+
+// 提取 markdown 内容中引用的图片文件名
+func extractImageNames(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, u := range extractImageURLs(content) {
+		name := imageFileName(u)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// 提取 markdown 内容中引用的图片地址
+func extractImageURLs(content string) []string {
+	var urls []string
+	for _, re := range []*regexp.Regexp{markdownImageRegex, htmlImageRegex} {
+		for _, match := range re.FindAllStringSubmatch(content, -1) {
+			if len(match) < 2 {
+				continue
+			}
+			// 去掉 ![alt](url "title") 中的标题部分
+			fields := strings.Fields(match[1])
+			if len(fields) == 0 {
+				continue
+			}
+			urls = append(urls, strings.Trim(fields[0], "<>"))
+		}
+	}
+	return urls
+}
+
+// 从图片地址解析出图片目录中的文件名，无法解析时返回空字符串
+func imageFileName(rawURL string) string {
+	rawURL = strings.Trim(strings.TrimSpace(rawURL), "<>")
+	if rawURL == "" || strings.HasPrefix(rawURL, "data:") {
+		return ""
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	name, err := url.PathUnescape(path.Base(u.Path))
+	if err != nil {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == ".." || name == "/" || strings.ContainsAny(name, `/\`) {
+		return ""
+	}
+	return name
+}
+
+// 扫描所有文章和照片，建立图片引用索引
+func buildImageRefIndex() (imageRefIndex, error) {
+	index := make(imageRefIndex)
+
+	for _, deleted := range []bool{false, true} {
+		posts, err := repository.Posts.List(deleted)
+		if err != nil {
+			return nil, fmt.Errorf("读取文章失败: %w", err)
+		}
+		for _, post := range posts {
+			ref := ImageRef{Type: "post", ID: post.ID, Title: post.Title, Deleted: post.Deleted}
+			for _, name := range extractImageNames(post.Content) {
+				index[name] = append(index[name], ref)
+			}
+		}
+	}
+
+	photoList, err := repository.Photos.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, photo := range photoList {
+		ref := ImageRef{Type: "photo", ID: photo.ID, Title: photo.Title, Deleted: photo.Deleted}
+		for _, u := range photoURLs(photo.Images) {
+			if name := imageFileName(u); name != "" {
+				index[name] = append(index[name], ref)
+			}
+		}
+	}
+
+	return index, nil
+}
+
+// 返回除 exclude 以外引用该图片的来源
+func (index imageRefIndex) refsExcept(name string, exclude ImageRef) []ImageRef {
+	var refs []ImageRef
+	for _, ref := range index[name] {
+		if ref.Type == exclude.Type && ref.ID == exclude.ID {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// 查找图片目录中未被任何文章或照片引用的文件
+func findOrphanImages(index imageRefIndex) ([]OrphanImage, error) {
+	objects, err := storage.Images.List()
+	if err != nil {
+		return nil, fmt.Errorf("读取图片列表失败: %w", err)
+	}
+
+	// 刚上传但尚未保存到文章中的图片不算孤立图片
+	cutoff := time.Now().Add(-config.ImageGCGrace)
+
+	orphans := []OrphanImage{}
+	for _, obj := range objects {
+		if len(index[obj.Key]) > 0 || obj.ModTime.After(cutoff) {
+			continue
+		}
+		orphans = append(orphans, OrphanImage{
+			Name:    obj.Key,
+			Size:    obj.Size,
+			ModTime: obj.ModTime,
+		})
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Name < orphans[j].Name
+	})
+	return orphans, nil
+}
+
+// 回收孤立图片，dryRun 为 true 时只列出不删除
+func CollectImageGarbage(dryRun bool) (*ImageGCResult, error) {
+	index, err := buildImageRefIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	orphans, err := findOrphanImages(index)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImageGCResult{DryRun: dryRun, Orphans: orphans, Failed: []string{}}
+	for _, orphan := range orphans {
+		result.TotalSize += orphan.Size
+		if dryRun {
+			continue
+		}
+		if err := removeImage(orphan.Name); err != nil {
+			utils.Logger.Printf("删除孤立图片失败 %s: %v", orphan.Name, err)
+			result.Failed = append(result.Failed, orphan.Name)
+			continue
+		}
+		utils.Logger.Printf("已删除孤立图片: %s", orphan.Name)
+		result.Removed++
+	}
+
+	return result, nil
+}
+
+// 图片回收，默认只预览，execute=true 时真正删除
+func HandleImageGC(c *gin.Context) {
+	dryRun := c.Query("execute") != "true"
+
+	result, err := CollectImageGarbage(dryRun)
+	if err != nil {
+		utils.Logger.Printf("图片回收失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "图片回收失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/models"
+	"server/repository"
+	"server/storage"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
+)
+
+// 媒体库中的图片
+type MediaItem struct {
+	ID         string     `json:"id"`
+	URL        string     `json:"url"`
+	Size       int64      `json:"size"`
+	Width      int        `json:"width"`
+	Height     int        `json:"height"`
+	UploadedAt time.Time  `json:"uploadedAt"`
+	Alt        string     `json:"alt"`
+	Caption    string     `json:"caption"`
+	Refs       []ImageRef `json:"refs"`
+
+	Placeholder *models.ImagePlaceholder `json:"placeholder,omitempty"`
+}
+
+// 获取媒体库图片列表
+func HandleGetMedia(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	keyword := strings.ToLower(c.Query("q"))
+
+	objects, err := storage.Images.List()
+	if err != nil {
+		utils.Logger.Printf("读取图片列表失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取媒体库失败"})
+		return
+	}
+
+	var entries []storage.Object
+	for _, obj := range objects {
+		if keyword != "" && !strings.Contains(strings.ToLower(obj.Key), keyword) {
+			continue
+		}
+		entries = append(entries, obj)
+	}
+
+	// 最新上传的排在前面
+	sort.Slice(entries, func(i, j int) bool {
+		return imageUploadedAt(entries[i]).After(imageUploadedAt(entries[j]))
+	})
+
+	index, err := buildImageRefIndex()
+	if err != nil {
+		utils.Logger.Printf("检查图片引用失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取媒体库失败"})
+		return
+	}
+	mediaData, err := readMediaData()
+	if err != nil {
+		utils.Logger.Printf("读取媒体数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取媒体库失败"})
+		return
+	}
+
+	items := []MediaItem{}
+	start := (page - 1) * pageSize
+	for i := start; i < len(entries) && i < start+pageSize; i++ {
+		items = append(items, buildMediaItem(c, entries[i], index, mediaData))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":    items,
+		"total":    len(entries),
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// 获取单个媒体库图片
+func HandleGetMediaById(c *gin.Context) {
+	obj, ok := statMedia(c)
+	if !ok {
+		return
+	}
+
+	index, err := buildImageRefIndex()
+	if err != nil {
+		utils.Logger.Printf("检查图片引用失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片失败"})
+		return
+	}
+	mediaData, err := readMediaData()
+	if err != nil {
+		utils.Logger.Printf("读取媒体数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildMediaItem(c, obj, index, mediaData))
+}
+
+// 更新图片的替代文本和说明
+func HandleUpdateMedia(c *gin.Context) {
+	obj, ok := statMedia(c)
+	if !ok {
+		return
+	}
+
+	var req models.MediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	err := updateMediaData(func(mediaData *models.MediaData) error {
+		meta := mediaData.Items[obj.Key]
+		meta.Alt = strings.TrimSpace(req.Alt)
+		meta.Caption = strings.TrimSpace(req.Caption)
+		meta.UpdatedAt = time.Now()
+		mediaData.Items[obj.Key] = meta
+		return nil
+	})
+	if err != nil {
+		utils.Logger.Printf("保存媒体数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// 删除媒体库图片，仍被引用时拒绝删除
+func HandleDeleteMedia(c *gin.Context) {
+	obj, ok := statMedia(c)
+	if !ok {
+		return
+	}
+
+	index, err := buildImageRefIndex()
+	if err != nil {
+		utils.Logger.Printf("检查图片引用失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查图片引用失败"})
+		return
+	}
+	if refs := index[obj.Key]; len(refs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "图片仍被引用，无法删除",
+			"refs":  refs,
+		})
+		return
+	}
+
+	if err := removeImage(obj.Key); err != nil {
+		utils.Logger.Printf("删除图片失败 %s: %v", obj.Key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 辅助函数
+func statMedia(c *gin.Context) (storage.Object, bool) {
+	id := c.Param("id")
+	if imageFileName(id) != id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的图片ID"})
+		return storage.Object{}, false
+	}
+
+	obj, err := storage.Images.Stat(id)
+	if err == storage.ErrNotExist {
+		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
+		return obj, false
+	}
+	if err != nil {
+		utils.Logger.Printf("读取图片信息失败 %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取图片失败"})
+		return obj, false
+	}
+	return obj, true
+}
+
+func buildMediaItem(c *gin.Context, obj storage.Object, index imageRefIndex, mediaData models.MediaData) MediaItem {
+	name := obj.Key
+	item := MediaItem{
+		ID:         name,
+		URL:        imageURL(c, name),
+		Size:       obj.Size,
+		UploadedAt: imageUploadedAt(obj),
+		Refs:       index[name],
+	}
+	if item.Refs == nil {
+		item.Refs = []ImageRef{}
+	}
+	if meta, ok := mediaData.Items[name]; ok {
+		item.Alt = meta.Alt
+		item.Caption = meta.Caption
+		item.Placeholder = meta.Placeholder
+	}
+
+	if r, err := storage.Images.Get(name); err == nil {
+		if cfg, _, err := image.DecodeConfig(r); err == nil {
+			item.Width, item.Height = cfg.Width, cfg.Height
+		}
+		r.Close()
+	}
+	return item
+}
+
+// 上传的文件名以纳秒时间戳开头，否则使用文件修改时间
+func imageUploadedAt(obj storage.Object) time.Time {
+	if prefix, _, ok := strings.Cut(obj.Key, "-"); ok {
+		if nanos, err := strconv.ParseInt(prefix, 10, 64); err == nil && len(prefix) >= 18 {
+			return time.Unix(0, nanos)
+		}
+	}
+	return obj.ModTime
+}
+
+// 删除图片文件、保留的原始图片及其元数据
+func removeImage(name string) error {
+	if err := storage.Images.Delete(name); err != nil {
+		return err
+	}
+	if err := storage.Originals.Delete(name); err != nil {
+		return err
+	}
+
+	return updateMediaData(func(mediaData *models.MediaData) error {
+		delete(mediaData.Items, name)
+		return nil
+	})
+}
+
+// 读取媒体元数据，文件不存在时返回空数据
+func readMediaData() (models.MediaData, error) {
+	mediaData, err := repository.Media.Read()
+	if mediaData.Items == nil {
+		mediaData.Items = map[string]models.MediaMeta{}
+	}
+	return mediaData, err
+}
+
+// 串行执行媒体元数据的读取、修改和保存，避免并发上传时互相覆盖
+func updateMediaData(fn func(*models.MediaData) error) error {
+	return repository.Media.Update(func(mediaData *models.MediaData) error {
+		if mediaData.Items == nil {
+			mediaData.Items = map[string]models.MediaMeta{}
+		}
+		return fn(mediaData)
+	})
+}
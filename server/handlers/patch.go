@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"server/events"
+	"server/jsonpatch"
+	"server/models"
+	"server/repository"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type patchError string
+
+func (e patchError) Error() string { return string(e) }
+
+var errPhotoChanged = errors.New("照片已被修改")
+
+// PATCH 时可以修改的文章字段，content 为不含 frontmatter 的正文
+type postPatchDoc struct {
+	Title    string   `json:"title"`
+	Category string   `json:"category"`
+	Summary  string   `json:"summary"`
+	Content  string   `json:"content"`
+	Tags     []string `json:"tags"`
+	Created  string   `json:"created"`
+	Draft    bool     `json:"draft"`
+}
+
+// PATCH 时可以修改的照片字段
+type photoPatchDoc struct {
+	Images      []models.PhotoImage `json:"images"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Category    string              `json:"category"`
+	Tags        []string            `json:"tags"`
+	Created     string              `json:"created"`
+}
+
+// 部分更新文章，支持 JSON Merge Patch 和 JSON Patch
+func HandlePatchPost(c *gin.Context) {
+	patch, ok := readPatch(c)
+	if !ok {
+		return
+	}
+
+	otherLock, err := checkEditLock(c, c.Param("id"))
+	if respondEditLock(c, err) {
+		return
+	}
+
+	now := time.Now().In(loadTimeZone()).Format("2006-01-02 15:04")
+	post, err := repository.Posts.Update(c.Param("id"), func(post *models.Post) error {
+		if err := checkIfMatch(c, *post); err != nil {
+			return err
+		}
+		doc := postPatchDoc{
+			Title:    post.Title,
+			Category: post.Category,
+			Summary:  post.Summary,
+			Content:  post.Content,
+			Tags:     post.Tags,
+			Created:  post.Created,
+			Draft:    repository.IsDraft(*post),
+		}
+		var result postPatchDoc
+		if err := applyPatch(c.ContentType(), doc, patch, &result); err != nil {
+			return err
+		}
+		if result.Title == "" || result.Content == "" {
+			return patchError("标题和内容不能为空")
+		}
+
+		post.Title = result.Title
+		post.Category = result.Category
+		post.Summary = result.Summary
+		post.Content = repository.ExtractMainContent(relativizeImageURLs(result.Content, requestHosts(c)...))
+		post.Tags = result.Tags
+		post.Created = result.Created
+		post.Updated = now
+		repository.SetDraft(post, result.Draft)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
+			return
+		}
+		respondPatchError(c, err, "更新文章失败")
+		return
+	}
+
+	publishPostEvent(events.PostUpdated, post)
+
+	response := presentPost(c, postResponse(post))
+	if otherLock != nil {
+		response["warning"] = "文章正在被其他人编辑，保存可能覆盖对方的修改"
+		response["lock"] = otherLock
+	}
+	c.Header("ETag", entityETag(post))
+	c.JSON(http.StatusOK, response)
+}
+
+// 部分更新照片，支持 JSON Merge Patch 和 JSON Patch
+func HandlePatchPhoto(c *gin.Context) {
+	patch, ok := readPatch(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+
+	// 先在当前数据上试用补丁，图片有变化时在写锁之外处理新图片
+	current, err := repository.Photos.Get(id)
+	if err == nil {
+		err = checkIfMatch(c, current)
+	}
+	if err != nil {
+		respondPhotoError(c, err, "读取数据失败")
+		return
+	}
+	preview, err := patchPhoto(c, current, patch)
+	if err != nil {
+		respondPatchError(c, err, "保存失败")
+		return
+	}
+	urls := photoURLs(preview.Images)
+	imagesChanged := !reflect.DeepEqual(urls, photoURLs(current.Images))
+	var photoExif map[string]models.PhotoExif
+	if imagesChanged {
+		watermarkPhotoImages(urls)
+		photoExif = extractPhotoExif(urls)
+	}
+
+	photo, err := repository.Photos.Update(id, func(photo *models.Photo) error {
+		if err := checkIfMatch(c, *photo); err != nil {
+			return err
+		}
+		result, err := patchPhoto(c, *photo, patch)
+		if err != nil {
+			return err
+		}
+		resultURLs := photoURLs(result.Images)
+		if !reflect.DeepEqual(resultURLs, photoURLs(photo.Images)) {
+			// 处理图片期间照片被其他请求修改
+			if !imagesChanged || !reflect.DeepEqual(resultURLs, urls) {
+				return errPhotoChanged
+			}
+			result.Exif = photoExif
+		}
+		fillPhotoImageSizes(result.Images)
+		if result.Created == "" {
+			result.Created = earliestDateTaken(result.Exif)
+		}
+		result.UpdatedAt = time.Now()
+		*photo = result
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondPhotoError(c, err, "保存失败")
+			return
+		}
+		respondPatchError(c, err, "保存失败")
+		return
+	}
+	publishPhotoEvent(events.PhotoUpdated, photo)
+
+	c.Header("ETag", entityETag(photo))
+	c.JSON(http.StatusOK, presentPhoto(c, photo))
+}
+
+// 对照片的可修改字段应用补丁并校验结果，返回修改后的照片
+func patchPhoto(c *gin.Context, photo models.Photo, patch []byte) (models.Photo, error) {
+	doc := photoPatchDoc{
+		Images:      photo.Images,
+		Title:       photo.Title,
+		Description: photo.Description,
+		Category:    photo.Category,
+		Tags:        photo.Tags,
+		Created:     photo.Created,
+	}
+	var result photoPatchDoc
+	if err := applyPatch(c.ContentType(), doc, patch, &result); err != nil {
+		return photo, err
+	}
+
+	images, err := photoRequestImages(PhotoRequest{Images: result.Images}, nil, requestHosts(c)...)
+	if err != nil {
+		return photo, err
+	}
+	photo.Images = images
+	photo.Title = result.Title
+	photo.Description = result.Description
+	photo.Category = result.Category
+	photo.Tags = normalizeTags(result.Tags)
+	photo.Created = result.Created
+	return photo, nil
+}
+
+// 读取补丁内容，Content-Type 决定补丁格式
+func readPatch(c *gin.Context) ([]byte, bool) {
+	switch c.ContentType() {
+	case jsonpatch.MergePatchType, jsonpatch.JSONPatchType:
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Content-Type 应为 " + jsonpatch.MergePatchType + " 或 " + jsonpatch.JSONPatchType,
+		})
+		return nil, false
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求失败"})
+		return nil, false
+	}
+	return patch, true
+}
+
+// 把 doc 序列化后应用补丁，再严格解析到 result 中，补丁不能添加未知字段
+func applyPatch(contentType string, doc any, patch []byte, result any) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if contentType == jsonpatch.JSONPatchType {
+		data, err = jsonpatch.Apply(data, patch)
+	} else {
+		data, err = jsonpatch.MergePatch(data, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(result); err != nil {
+		return patchError("修改后的内容无效: " + err.Error())
+	}
+	return nil
+}
+
+// 补丁无效或结果校验失败时返回 400，test 操作不通过或数据已变化时返回 409
+func respondPatchError(c *gin.Context, err error, message string) {
+	if respondPrecondition(c, err) {
+		return
+	}
+	var pErr patchError
+	var reqErr photoRequestError
+	switch {
+	case errors.Is(err, jsonpatch.ErrTestFailed), errors.Is(err, errPhotoChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, jsonpatch.ErrInvalidPatch), errors.Is(err, jsonpatch.ErrPathNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.As(err, &pErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": pErr.Error()})
+	case errors.As(err, &reqErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": reqErr.Error()})
+	default:
+		utils.Logger.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
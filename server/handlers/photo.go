@@ -1,24 +1,28 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
-	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"server/config"
+	"server/events"
 	"server/models"
+	"server/repository"
+	"server/utils"
 )
 
 // 修改请求结构体
 type PhotoRequest struct {
+	Images []models.PhotoImage `json:"images"`
+	// 旧客户端只提交图片地址列表，未提交 images 时使用
 	URLs        []string `json:"urls"`
 	Title       string   `json:"title"`
 	Description string   `json:"description"`
 	Category    string   `json:"category"`
+	Tags        []string `json:"tags"`
 	Created     string   `json:"created"`
 }
 
@@ -30,134 +34,163 @@ func HandleSavePhotos(c *gin.Context) {
 		return
 	}
 
-	photosData := models.PhotosData{Photos: []models.Photo{}}
-	photosFile := config.PhotosFile
-
-	if _, err := os.Stat("data"); os.IsNotExist(err) {
-		os.Mkdir("data", 0755)
+	photo, err := createPhoto(newPhotos, requestHosts(c)...)
+	if err != nil {
+		respondPhotoError(c, err, "保存失败")
+		return
 	}
 
-	if data, err := os.ReadFile(photosFile); err == nil {
-		json.Unmarshal(data, &photosData)
-	}
+	c.JSON(http.StatusOK, presentPhoto(c, photo))
+}
 
+// 新建照片并写入照片数据文件
+func createPhoto(newPhotos PhotoRequest, requestHosts ...string) (models.Photo, error) {
+	images, err := photoRequestImages(newPhotos, nil, requestHosts...)
+	if err != nil {
+		return models.Photo{}, err
+	}
+	urls := photoURLs(images)
+	watermarkPhotoImages(urls)
+	fillPhotoImageSizes(images)
 	photo := models.Photo{
 		ID:          uuid.New().String(),
-		URLs:        newPhotos.URLs,
+		Images:      images,
 		Title:       newPhotos.Title,
 		Description: newPhotos.Description,
 		Category:    newPhotos.Category,
+		Tags:        normalizeTags(newPhotos.Tags),
 		Created:     newPhotos.Created,
 		UpdatedAt:   time.Now(),
+		Exif:        extractPhotoExif(urls),
 	}
-
-	photosData.Photos = append(photosData.Photos, photo)
-
-	jsonData, err := json.MarshalIndent(photosData, "", "    ")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
-		return
+	if photo.Created == "" {
+		photo.Created = earliestDateTaken(photo.Exif)
 	}
 
-	if err := os.WriteFile(photosFile, jsonData, 0644); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
-		return
+	if err := repository.Photos.Create(photo); err != nil {
+		return photo, err
 	}
+	publishPhotoEvent(events.PhotoCreated, photo)
+	return photo, nil
+}
 
-	c.JSON(http.StatusOK, photo)
+// 导入其他博客程序中的图片集，按新建照片的流程处理
+func ImportPhoto(photo models.Photo) error {
+	_, err := createPhoto(PhotoRequest{
+		Images:      photo.Images,
+		Title:       photo.Title,
+		Description: photo.Description,
+		Category:    photo.Category,
+		Tags:        photo.Tags,
+		Created:     photo.Created,
+	})
+	return err
 }
 
-// 获取照片列表
+// 获取照片列表，支持搜索、筛选、排序和游标分页
 func HandleGetPhotos(c *gin.Context) {
-	photosData := models.PhotosData{Photos: []models.Photo{}}
-	photosFile := config.PhotosFile
-
-	if data, err := os.ReadFile(photosFile); err == nil {
-		if err := json.Unmarshal(data, &photosData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
-			return
-		}
+	query, err := parsePhotoQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	category := c.Query("category")
-	if category != "" && category != "all" {
-		filteredPhotos := []models.Photo{}
-		for _, photo := range photosData.Photos {
-			if photo.Category == category {
-				filteredPhotos = append(filteredPhotos, photo)
-			}
-		}
-		photosData.Photos = filteredPhotos
+	photos, err := repository.Photos.List()
+	if err != nil {
+		utils.Logger.Printf("读取照片数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
 	}
 
-	sort.Slice(photosData.Photos, func(i, j int) bool {
-		return photosData.Photos[i].Created > photosData.Photos[j].Created
-	})
+	page, err := query.apply(photos, requestAlbumsData(c), isOwner(c))
+	if err != nil {
+		respondAlbumError(c, err, "读取数据失败")
+		return
+	}
+	for i, photo := range page.Photos {
+		page.Photos[i] = presentPhoto(c, photo)
+	}
 
-	c.JSON(http.StatusOK, photosData)
+	c.JSON(http.StatusOK, page)
 }
 
-// 删除照片
+// 软删除照片，移入回收站
 func HandleDeletePhoto(c *gin.Context) {
-	id := c.Param("id")
-	photosFile := config.PhotosFile
-
-	photosData := models.PhotosData{Photos: []models.Photo{}}
-	if data, err := os.ReadFile(photosFile); err == nil {
-		json.Unmarshal(data, &photosData)
+	if err := setPhotoDeleted(c, c.Param("id"), true); err != nil {
+		respondPhotoError(c, err, "删除失败")
+		return
 	}
 
-	found := false
-	newPhotos := []models.Photo{}
-	for _, photo := range photosData.Photos {
-		if photo.ID != id {
-			newPhotos = append(newPhotos, photo)
-		} else {
-			found = true
-		}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 获取回收站中的照片，支持与照片列表相同的查询参数
+func HandleGetTrashPhotos(c *gin.Context) {
+	query, err := parsePhotoQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	query.Deleted = true
 
-	if !found {
-		c.JSON(http.StatusNotFound, gin.H{"error": "照片不存在"})
+	photos, err := repository.Photos.List()
+	if err != nil {
+		utils.Logger.Printf("读取照片数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回收站照片失败"})
 		return
 	}
 
-	photosData.Photos = newPhotos
-	jsonData, err := json.MarshalIndent(photosData, "", "    ")
+	page, err := query.apply(photos, requestAlbumsData(c), isOwner(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		respondAlbumError(c, err, "获取回收站照片失败")
+		return
+	}
+	for i, photo := range page.Photos {
+		page.Photos[i] = presentTrashPhoto(presentPhoto(c, photo))
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// 恢复照片
+func HandleRestorePhoto(c *gin.Context) {
+	if err := setPhotoDeleted(c, c.Param("id"), false); err != nil {
+		respondPhotoError(c, err, "恢复失败")
 		return
 	}
 
-	if err := os.WriteFile(photosFile, jsonData, 0644); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+	c.JSON(http.StatusOK, gin.H{"message": "照片已恢复"})
+}
+
+// 永久删除照片，同时删除不再被其他文章或照片引用的图片
+func HandlePermanentDeletePhoto(c *gin.Context) {
+	err := purgePhoto(c.Param("id"), func(photo models.Photo) error {
+		return checkIfMatch(c, photo)
+	})
+	if err != nil {
+		respondPhotoError(c, err, "删除照片失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+	c.JSON(http.StatusOK, gin.H{"message": "照片已永久删除"})
 }
 
 // 获取单个照片
 func HandleGetPhotoById(c *gin.Context) {
-	id := c.Param("id")
-	photosFile := config.PhotosFile
-
-	photosData := models.PhotosData{Photos: []models.Photo{}}
-	if data, err := os.ReadFile(photosFile); err == nil {
-		if err := json.Unmarshal(data, &photosData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
-			return
-		}
+	photo, err := repository.Photos.Get(c.Param("id"))
+	if err == nil && !isOwner(c) && privatePhotoIDs(requestAlbumsData(c))[photo.ID] {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		respondPhotoError(c, err, "读取数据失败")
+		return
 	}
 
-	for _, photo := range photosData.Photos {
-		if photo.ID == id {
-			c.JSON(http.StatusOK, photo)
-			return
-		}
+	if notModified(c, photo) {
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{"error": "照片不存在"})
+	c.JSON(http.StatusOK, presentPhoto(c, photo))
 }
 
 // 更新照片
@@ -169,48 +202,146 @@ func HandleUpdatePhoto(c *gin.Context) {
 		return
 	}
 
-	photosFile := config.PhotosFile
-	photosData := models.PhotosData{Photos: []models.Photo{}}
-	
-	if data, err := os.ReadFile(photosFile); err == nil {
-		if err := json.Unmarshal(data, &photosData); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
-			return
+	existing, err := repository.Photos.Get(id)
+	if err == nil {
+		err = checkIfMatch(c, existing)
+	}
+	if err != nil {
+		respondPhotoError(c, err, "读取数据失败")
+		return
+	}
+	images, err := photoRequestImages(updatePhoto, existing.Images, requestHosts(c)...)
+	if err != nil {
+		respondPhotoError(c, err, "保存失败")
+		return
+	}
+
+	// 处理图片比较耗时，放在写锁之外
+	urls := photoURLs(images)
+	watermarkPhotoImages(urls)
+	photoExif := extractPhotoExif(urls)
+
+	photo, err := repository.Photos.Update(id, func(photo *models.Photo) error {
+		if err := checkIfMatch(c, *photo); err != nil {
+			return err
 		}
+		// 以最新数据为准沿用图片说明等信息
+		images, err := photoRequestImages(updatePhoto, photo.Images, requestHosts(c)...)
+		if err != nil {
+			return err
+		}
+		fillPhotoImageSizes(images)
+		*photo = models.Photo{
+			ID:          id,
+			Images:      images,
+			Title:       updatePhoto.Title,
+			Description: updatePhoto.Description,
+			Category:    updatePhoto.Category,
+			Tags:        normalizeTags(updatePhoto.Tags),
+			Created:     updatePhoto.Created,
+			UpdatedAt:   time.Now(),
+			Exif:        photoExif,
+			Deleted:     photo.Deleted,
+			DeletedAt:   photo.DeletedAt,
+		}
+		if photo.Created == "" {
+			photo.Created = earliestDateTaken(photo.Exif)
+		}
+		return nil
+	})
+	if err != nil {
+		respondPhotoError(c, err, "保存失败")
+		return
 	}
+	publishPhotoEvent(events.PhotoUpdated, photo)
 
-	found := false
-	for i, photo := range photosData.Photos {
-		if photo.ID == id {
-			photosData.Photos[i] = models.Photo{
-				ID:          id,
-				URLs:        updatePhoto.URLs,
-				Title:       updatePhoto.Title,
-				Description: updatePhoto.Description,
-				Category:    updatePhoto.Category,
-				Created:     updatePhoto.Created,
-				UpdatedAt:   time.Now(),
-			}
-			found = true
-			break
+	c.Header("ETag", entityETag(photo))
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+func setPhotoDeleted(c *gin.Context, id string, deleted bool) error {
+	photo, err := repository.Photos.Update(id, func(photo *models.Photo) error {
+		if err := checkIfMatch(c, *photo); err != nil {
+			return err
+		}
+		photo.Deleted = deleted
+		photo.DeletedAt = nil
+		if deleted {
+			now := time.Now()
+			photo.DeletedAt = &now
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if deleted {
+		publishPhotoEvent(events.PhotoTrashed, photo)
+	} else {
+		publishPhotoEvent(events.PhotoRestored, photo)
 	}
+	return nil
+}
 
-	if !found {
-		c.JSON(http.StatusNotFound, gin.H{"error": "照片不存在"})
-		return
+// 删除照片记录、相册中的引用和只被这张照片使用的图片
+func purgePhoto(id string, check func(models.Photo) error) error {
+	photo, err := repository.Photos.Get(id)
+	if err != nil {
+		return err
 	}
 
-	jsonData, err := json.MarshalIndent(photosData, "", "    ")
+	index, err := buildImageRefIndex()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
-		return
+		return fmt.Errorf("检查图片引用失败: %w", err)
 	}
 
-	if err := os.WriteFile(photosFile, jsonData, 0644); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
-		return
+	if _, err := repository.Photos.Delete(id, check); err != nil {
+		return err
+	}
+	if err := removePhotoFromAlbums(id); err != nil {
+		utils.Logger.Printf("从相册中移除照片失败 %s: %v", id, err)
 	}
+	publishPhotoEvent(events.PhotoDeleted, photo)
 
-	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
-} 
\ No newline at end of file
+	self := ImageRef{Type: "photo", ID: id}
+	for _, name := range photoImageNames(photoURLs(photo.Images)) {
+		if refs := index.refsExcept(name, self); len(refs) > 0 {
+			utils.Logger.Printf("图片 %s 仍被 %d 处引用，保留", name, len(refs))
+			continue
+		}
+		if err := removeImage(name); err != nil {
+			utils.Logger.Printf("删除图片失败 %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// 去掉重复和空白的标签
+func normalizeTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		result = append(result, splitTags(tag)...)
+	}
+	if result = uniqueStrings(result); len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// 版本不匹配时返回 412，请求无效时返回 400，照片不存在时返回 404，其他错误记录日志后返回 500
+func respondPhotoError(c *gin.Context, err error, message string) {
+	if respondPrecondition(c, err) {
+		return
+	}
+	var reqErr photoRequestError
+	if errors.As(err, &reqErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reqErr.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "照片不存在"})
+		return
+	}
+	utils.Logger.Printf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"server/config"
+	"server/exif"
+	"server/models"
+	"server/repository"
+	"server/storage"
+	"server/utils"
+)
+
+// 读取照片中每张本地图片的拍摄信息
+func extractPhotoExif(urls []string) map[string]models.PhotoExif {
+	result := make(map[string]models.PhotoExif)
+	for _, u := range urls {
+		name := imageFileName(u)
+		if name == "" {
+			continue
+		}
+		info, err := readImageExif(name)
+		if err != nil {
+			if err != exif.ErrNoExif && err != storage.ErrNotExist {
+				utils.Logger.Printf("解析图片 EXIF 失败 %s: %v", name, err)
+			}
+			continue
+		}
+		if photoExif, ok := toPhotoExif(info); ok {
+			result[u] = photoExif
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// 为没有拍摄信息的旧照片补充并保存，force 为 true 时重新读取所有照片
+func BackfillPhotoExif(force bool) (updated, failed int, err error) {
+	photos, err := repository.Photos.List()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, photo := range photos {
+		if !force && photo.Exif != nil {
+			continue
+		}
+		photoExif := extractPhotoExif(photoURLs(photo.Images))
+		if photoExif == nil && photo.Exif == nil {
+			continue
+		}
+		_, err := repository.Photos.Update(photo.ID, func(photo *models.Photo) error {
+			photo.Exif = photoExif
+			return nil
+		})
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			utils.Logger.Printf("保存照片拍摄信息失败 %s: %v", photo.ID, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	return updated, failed, nil
+}
+
+// 保留原图时公开图片去掉了元数据，优先从原图读取
+func readImageExif(name string) (*exif.Info, error) {
+	if config.KeepOriginalMetadata {
+		data, err := storage.ReadAll(storage.Originals, name)
+		if err == nil {
+			return exif.Parse(data)
+		}
+		if !errors.Is(err, storage.ErrNotExist) {
+			return nil, err
+		}
+	}
+	data, err := storage.ReadAll(storage.Images, name)
+	if err != nil {
+		return nil, err
+	}
+	return exif.Parse(data)
+}
+
+func toPhotoExif(info *exif.Info) (models.PhotoExif, bool) {
+	lens := info.LensModel
+	if lens != "" && info.LensMake != "" && !strings.HasPrefix(lens, info.LensMake) {
+		lens = info.LensMake + " " + lens
+	}
+
+	photoExif := models.PhotoExif{
+		Make:            info.Make,
+		Model:           info.Model,
+		Lens:            lens,
+		FocalLength:     info.FocalLength,
+		FocalLength35mm: info.FocalLength35mm,
+		Aperture:        info.FNumber,
+		ShutterSpeed:    info.ExposureTime,
+		ISO:             info.ISO,
+		Latitude:        info.Latitude,
+		Longitude:       info.Longitude,
+		Altitude:        info.Altitude,
+	}
+	if taken, ok := info.TakenAt(loadTimeZone()); ok {
+		photoExif.DateTaken = taken.In(loadTimeZone()).Format("2006-01-02 15:04:05")
+	}
+
+	return photoExif, photoExif != (models.PhotoExif{})
+}
+
+// 使用最早的拍摄日期作为照片的创建日期
+func earliestDateTaken(photoExif map[string]models.PhotoExif) string {
+	earliest := ""
+	for _, e := range photoExif {
+		if e.DateTaken != "" && (earliest == "" || e.DateTaken < earliest) {
+			earliest = e.DateTaken
+		}
+	}
+	if earliest == "" {
+		return ""
+	}
+	return earliest[:len("2006-01-02")]
+}
+
+func loadTimeZone() *time.Location {
+	loc, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return time.FixedZone("CST", 8*3600)
+	}
+	return loc
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/events"
+	"server/models"
+	"server/repository"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type photoRequestError string
+
+func (e photoRequestError) Error() string { return string(e) }
+
+// 调整照片中图片的顺序
+func HandleReorderPhotoImages(c *gin.Context) {
+	var req models.PhotoImageOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	photo, err := repository.Photos.Update(c.Param("id"), func(photo *models.Photo) error {
+		if err := checkIfMatch(c, *photo); err != nil {
+			return err
+		}
+		if len(req.Order) != len(photo.Images) {
+			return photoRequestError("排序需要包含所有图片")
+		}
+		images := make([]models.PhotoImage, len(req.Order))
+		used := make([]bool, len(req.Order))
+		for i, index := range req.Order {
+			if index < 0 || index >= len(photo.Images) || used[index] {
+				return photoRequestError("无效的图片序号: " + strconv.Itoa(index))
+			}
+			used[index] = true
+			images[i] = photo.Images[index]
+		}
+		photo.Images = images
+		photo.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		respondPhotoError(c, err, "保存失败")
+		return
+	}
+	publishPhotoEvent(events.PhotoUpdated, photo)
+
+	c.Header("ETag", entityETag(photo))
+	c.JSON(http.StatusOK, presentPhoto(c, photo))
+}
+
+// 修改照片中单张图片的说明、替代文本、焦点或封面
+func HandleUpdatePhotoImage(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的图片序号"})
+		return
+	}
+	var req models.PhotoImageUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	photo, err := repository.Photos.Update(c.Param("id"), func(photo *models.Photo) error {
+		if err := checkIfMatch(c, *photo); err != nil {
+			return err
+		}
+		if index < 0 || index >= len(photo.Images) {
+			return photoRequestError("图片不存在: " + strconv.Itoa(index))
+		}
+		image := &photo.Images[index]
+		if req.Caption != nil {
+			image.Caption = *req.Caption
+		}
+		if req.Alt != nil {
+			image.Alt = *req.Alt
+		}
+		if req.FocalPoint != nil {
+			image.FocalPoint = req.FocalPoint
+		}
+		if req.IsCover != nil {
+			// 只能有一张封面
+			if *req.IsCover {
+				for i := range photo.Images {
+					photo.Images[i].IsCover = false
+				}
+			}
+			image.IsCover = *req.IsCover
+		}
+		if err := validatePhotoImages(photo.Images); err != nil {
+			return err
+		}
+		photo.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		respondPhotoError(c, err, "保存失败")
+		return
+	}
+	publishPhotoEvent(events.PhotoUpdated, photo)
+
+	c.Header("ETag", entityETag(photo))
+	c.JSON(http.StatusOK, presentPhoto(c, photo))
+}
+
+// 根据请求生成图片列表；只提交地址列表时，沿用 previous 中同一地址的说明等信息
+func photoRequestImages(req PhotoRequest, previous []models.PhotoImage, requestHosts ...string) ([]models.PhotoImage, error) {
+	var images []models.PhotoImage
+	if len(req.Images) > 0 {
+		images = append(images, req.Images...)
+		for i := range images {
+			images[i].URL = relativizeImageURLs(strings.TrimSpace(images[i].URL), requestHosts...)
+		}
+	} else {
+		existing := make(map[string]models.PhotoImage, len(previous))
+		for _, image := range previous {
+			existing[image.URL] = image
+		}
+		for _, u := range relativizeImageURLList(req.URLs, requestHosts...) {
+			image, ok := existing[u]
+			if !ok {
+				image = models.PhotoImage{URL: u}
+			}
+			images = append(images, image)
+		}
+	}
+
+	if err := validatePhotoImages(images); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func validatePhotoImages(images []models.PhotoImage) error {
+	seen := make(map[string]bool, len(images))
+	covers := 0
+	for _, image := range images {
+		if image.URL == "" {
+			return photoRequestError("图片地址不能为空")
+		}
+		if seen[image.URL] {
+			return photoRequestError("图片重复: " + image.URL)
+		}
+		seen[image.URL] = true
+		if fp := image.FocalPoint; fp != nil && (fp.X < 0 || fp.X > 1 || fp.Y < 0 || fp.Y > 1) {
+			return photoRequestError("焦点坐标应在 0 到 1 之间")
+		}
+		if image.IsCover {
+			covers++
+		}
+	}
+	if covers > 1 {
+		return photoRequestError("只能设置一张封面")
+	}
+	return nil
+}
+
+// 本站图片的宽高以媒体元数据为准
+func fillPhotoImageSizes(images []models.PhotoImage) {
+	mediaData, err := readMediaData()
+	if err != nil {
+		utils.Logger.Printf("读取媒体数据失败: %v", err)
+		return
+	}
+	for i := range images {
+		if width, height, ok := localImageSize(mediaData, images[i].URL); ok {
+			images[i].Width, images[i].Height = width, height
+		}
+	}
+}
+
+func localImageSize(mediaData models.MediaData, u string) (width, height int, ok bool) {
+	if !strings.HasPrefix(u, imagePathPrefix) {
+		return 0, 0, false
+	}
+	meta, found := mediaData.Items[imageFileName(u)]
+	if !found || meta.Placeholder == nil {
+		return 0, 0, false
+	}
+	return meta.Placeholder.Width, meta.Placeholder.Height, true
+}
+
+// 照片中所有图片的地址
+func photoURLs(images []models.PhotoImage) []string {
+	urls := make([]string, len(images))
+	for i, image := range images {
+		urls[i] = image.URL
+	}
+	return urls
+}
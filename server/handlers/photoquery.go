@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxPhotoPageSize = 200
+
+	photoSortCreated = "created"
+	photoSortUpdated = "updated"
+	photoSortTaken   = "taken"
+	// 按相册筛选且未指定排序时使用相册中的照片顺序
+	photoSortAlbum = "album"
+)
+
+// 照片列表的查询条件
+type photoQuery struct {
+	Keyword   string
+	Category  string
+	Tags      []string
+	Album     string
+	Camera    string
+	TakenFrom string
+	TakenTo   string
+	Sort      string
+	Desc      bool
+	Limit     int // 0 表示不分页
+	Cursor    *photoCursor
+	Deleted   bool // 查询回收站中的照片
+}
+
+// 游标记录上一页最后一张照片的排序值和 ID
+type photoCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d"`
+	Key  string `json:"k"`
+	ID   string `json:"i"`
+}
+
+type photoQueryError string
+
+func (e photoQueryError) Error() string { return string(e) }
+
+// 解析查询参数，日期范围为 YYYY-MM-DD，包含两端
+func parsePhotoQuery(c *gin.Context) (photoQuery, error) {
+	q := photoQuery{
+		Keyword:  strings.ToLower(strings.TrimSpace(c.Query("q"))),
+		Category: c.Query("category"),
+		Album:    c.Query("album"),
+		Camera:   strings.ToLower(strings.TrimSpace(c.Query("camera"))),
+		Sort:     c.DefaultQuery("sort", photoSortCreated),
+		Desc:     c.DefaultQuery("order", "desc") != "asc",
+	}
+	if q.Category == "all" {
+		q.Category = ""
+	}
+	for _, tag := range c.QueryArray("tag") {
+		q.Tags = append(q.Tags, splitTags(tag)...)
+	}
+	q.Tags = uniqueStrings(q.Tags)
+
+	if q.Album != "" && c.Query("sort") == "" {
+		q.Sort = photoSortAlbum
+		q.Desc = c.Query("order") == "desc"
+	}
+	switch q.Sort {
+	case photoSortCreated, photoSortUpdated, photoSortTaken:
+	case photoSortAlbum:
+		if q.Album == "" {
+			return q, photoQueryError("按相册顺序排序时需要指定相册")
+		}
+	default:
+		return q, photoQueryError("不支持的排序方式: " + q.Sort)
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *string
+		end   bool
+	}{{"taken_from", &q.TakenFrom, false}, {"taken_to", &q.TakenTo, true}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return q, photoQueryError(p.name + " 应为 YYYY-MM-DD 格式")
+		}
+		// 拍摄时间格式为 2006-01-02 15:04:05，结束日期包含当天
+		if p.end {
+			v += " 99"
+		}
+		*p.value = v
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return q, photoQueryError("limit 应为正整数")
+		}
+		if limit > maxPhotoPageSize {
+			limit = maxPhotoPageSize
+		}
+		q.Limit = limit
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := decodePhotoCursor(v)
+		if err != nil || cursor.Sort != q.Sort || cursor.Desc != q.Desc {
+			return q, photoQueryError("无效的分页游标")
+		}
+		q.Cursor = &cursor
+		if q.Limit == 0 {
+			q.Limit = maxPhotoPageSize
+		}
+	}
+	return q, nil
+}
+
+// 按条件筛选、排序并截取一页照片，同时返回符合条件的总数；includePrivate 为 false 时私密相册视为不存在
+func (q photoQuery) apply(photos []models.Photo, albumsData models.AlbumsData, includePrivate bool) (models.PhotoPage, error) {
+	// 相册中的位置同时用于筛选和排序
+	var albumPos map[string]int
+	if q.Album != "" {
+		i := findAlbum(&albumsData, q.Album)
+		if i < 0 || (!includePrivate && albumIndex(albumsData.Albums).visibility(q.Album) == models.AlbumPrivate) {
+			return models.PhotoPage{}, errAlbumNotFound
+		}
+		albumPos = make(map[string]int)
+		for pos, id := range albumsData.Albums[i].PhotoIDs {
+			albumPos[id] = pos
+		}
+	}
+
+	type entry struct {
+		photo models.Photo
+		key   string
+	}
+	var hidden map[string]bool
+	if !includePrivate {
+		hidden = privatePhotoIDs(albumsData)
+	}
+	entries := []entry{}
+	for _, photo := range photos {
+		if hidden[photo.ID] {
+			continue
+		}
+		if albumPos != nil {
+			if _, ok := albumPos[photo.ID]; !ok {
+				continue
+			}
+		}
+		if !q.match(photo) {
+			continue
+		}
+		entries = append(entries, entry{photo, q.sortKey(photo, albumPos)})
+	}
+
+	// ID 作为第二排序字段，保证顺序稳定，游标才能准确定位
+	less := func(key, id string, other entry) bool {
+		if key != other.key {
+			return (key < other.key) != q.Desc
+		}
+		if id != other.photo.ID {
+			return (id < other.photo.ID) != q.Desc
+		}
+		return false
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return less(entries[i].key, entries[i].photo.ID, entries[j])
+	})
+
+	page := models.PhotoPage{Photos: []models.Photo{}, Total: len(entries)}
+	start := 0
+	if q.Cursor != nil {
+		start = sort.Search(len(entries), func(i int) bool {
+			return less(q.Cursor.Key, q.Cursor.ID, entries[i])
+		})
+	}
+	end := len(entries)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+		page.HasMore = true
+	}
+	for _, e := range entries[start:end] {
+		page.Photos = append(page.Photos, e.photo)
+	}
+	if page.HasMore {
+		last := entries[end-1]
+		page.NextCursor = encodePhotoCursor(photoCursor{Sort: q.Sort, Desc: q.Desc, Key: last.key, ID: last.photo.ID})
+	}
+	return page, nil
+}
+
+func (q photoQuery) match(photo models.Photo) bool {
+	if photo.Deleted != q.Deleted {
+		return false
+	}
+	if q.Category != "" && photo.Category != q.Category {
+		return false
+	}
+	if q.Keyword != "" &&
+		!strings.Contains(strings.ToLower(photo.Title), q.Keyword) &&
+		!strings.Contains(strings.ToLower(photo.Description), q.Keyword) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !containsString(photo.Tags, tag) {
+			return false
+		}
+	}
+	if q.Camera != "" && !photoHasCamera(photo, q.Camera) {
+		return false
+	}
+	if q.TakenFrom != "" || q.TakenTo != "" {
+		taken := photoTakenAt(photo)
+		if taken == "" || (q.TakenFrom != "" && taken < q.TakenFrom) || (q.TakenTo != "" && taken > q.TakenTo) {
+			return false
+		}
+	}
+	return true
+}
+
+// 排序值统一为可按字典序比较的字符串
+func (q photoQuery) sortKey(photo models.Photo, albumPos map[string]int) string {
+	switch q.Sort {
+	case photoSortUpdated:
+		return photo.UpdatedAt.UTC().Format("2006-01-02T15:04:05.000000000")
+	case photoSortTaken:
+		return photoTakenAt(photo)
+	case photoSortAlbum:
+		return fmt.Sprintf("%08d", albumPos[photo.ID])
+	default:
+		return photo.Created
+	}
+}
+
+// 照片中最早的拍摄时间，没有拍摄信息时返回空字符串
+func photoTakenAt(photo models.Photo) string {
+	taken := ""
+	for _, e := range photo.Exif {
+		if e.DateTaken != "" && (taken == "" || e.DateTaken < taken) {
+			taken = e.DateTaken
+		}
+	}
+	return taken
+}
+
+// 相机品牌或型号包含关键字
+func photoHasCamera(photo models.Photo, keyword string) bool {
+	for _, e := range photo.Exif {
+		if strings.Contains(strings.ToLower(e.Make+" "+e.Model), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// 标签可以用逗号分隔，去掉首尾空白和空标签
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func encodePhotoCursor(cursor photoCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePhotoCursor(value string) (photoCursor, error) {
+	var cursor photoCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
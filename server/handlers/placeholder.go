@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"sort"
+	"strings"
+
+	"server/imaging"
+	"server/models"
+	"server/storage"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 文章中引用的图片及其占位信息
+type ImageInfo struct {
+	URL string `json:"url"`
+	Alt string `json:"alt,omitempty"`
+	*models.ImagePlaceholder
+}
+
+// 解码图片并生成模糊哈希、低清预览和主色调
+func computePlaceholder(data []byte) (*models.ImagePlaceholder, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	lqip, err := imaging.LQIP(img)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ImagePlaceholder{
+		Width:         img.Bounds().Dx(),
+		Height:        img.Bounds().Dy(),
+		BlurHash:      imaging.BlurHash(img),
+		LQIP:          lqip,
+		DominantColor: imaging.DominantColor(img),
+	}, nil
+}
+
+// 生成占位信息并写入媒体元数据
+func savePlaceholder(name string, data []byte) error {
+	placeholder, err := computePlaceholder(data)
+	if err != nil {
+		return err
+	}
+	return updateMediaData(func(mediaData *models.MediaData) error {
+		meta := mediaData.Items[name]
+		meta.Placeholder = placeholder
+		mediaData.Items[name] = meta
+		return nil
+	})
+}
+
+// 为缺少占位信息的图片补充生成，force 为 true 时全部重新生成
+func BackfillPlaceholders(force bool) (updated, failed int, err error) {
+	objects, err := storage.Images.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	mediaData, err := readMediaData()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	for _, obj := range objects {
+		if !force && mediaData.Items[obj.Key].Placeholder != nil {
+			continue
+		}
+		data, err := storage.ReadAll(storage.Images, obj.Key)
+		if err == nil {
+			err = savePlaceholder(obj.Key, data)
+		}
+		if err != nil {
+			utils.Logger.Printf("生成占位信息失败 %s: %v", obj.Key, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	return updated, failed, nil
+}
+
+// 同一请求中只读取一次媒体元数据
+func requestMediaData(c *gin.Context) models.MediaData {
+	if v, ok := c.Get("mediaData"); ok {
+		return v.(models.MediaData)
+	}
+	mediaData, err := readMediaData()
+	if err != nil {
+		utils.Logger.Printf("读取媒体数据失败: %v", err)
+	}
+	c.Set("mediaData", mediaData)
+	return mediaData
+}
+
+// 文章内容中引用的本站图片，外部图片不包含在内
+func postImages(c *gin.Context, content string) []ImageInfo {
+	mediaData := requestMediaData(c)
+	images := []ImageInfo{}
+	seen := make(map[string]bool)
+	for _, u := range extractImageURLs(relativizeImageURLs(content, requestHosts(c)...)) {
+		if !strings.HasPrefix(u, imagePathPrefix) {
+			continue
+		}
+		name := imageFileName(u)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		meta := mediaData.Items[name]
+		images = append(images, ImageInfo{
+			URL:              imageURL(c, name),
+			Alt:              meta.Alt,
+			ImagePlaceholder: meta.Placeholder,
+		})
+	}
+	return images
+}
+
+// 照片各图片的占位信息，以完整地址为键
+func photoPlaceholders(c *gin.Context, urls []string) map[string]models.ImagePlaceholder {
+	mediaData := requestMediaData(c)
+	placeholders := make(map[string]models.ImagePlaceholder)
+	for _, u := range urls {
+		if meta, ok := mediaData.Items[imageFileName(u)]; ok && meta.Placeholder != nil {
+			placeholders[u] = *meta.Placeholder
+		}
+	}
+	if len(placeholders) == 0 {
+		return nil
+	}
+	return placeholders
+}
@@ -1,18 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
-	"path/filepath"
-	"regexp"
-	"sort"
-	"strings"
 	"time"
-	"unicode"
 
-	"server/config"
+	"server/events"
 	"server/models"
+	"server/repository"
 	"server/utils"
 
 	"github.com/gin-gonic/gin"
@@ -35,19 +32,36 @@ func HandleImageUpload(c *gin.Context) {
 		return
 	}
 
-	filename := fmt.Sprintf("%d-%s", time.Now().UnixNano(), file.Filename)
-	uploadDir := config.ImagesDir
-	filepath := filepath.Join(uploadDir, filename)
+	src, err := file.Open()
+	if err != nil {
+		utils.Logger.Printf("读取上传文件失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法获取上传的文件"})
+		return
+	}
+	data, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		utils.Logger.Printf("读取上传文件失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法获取上传的文件"})
+		return
+	}
 
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
+	filename, err := saveImage(file.Filename, data)
+	if errors.Is(err, errUnsupportedImageType) {
+		utils.Logger.Printf("%v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型"})
+		return
+	}
+	if err != nil {
 		utils.Logger.Printf("保存文件失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
 		return
 	}
 
-	imageUrl := fmt.Sprintf("http://%s/content/images/%s", c.Request.Host, filename)
+	imageUrl := imageURL(c, filename)
 	c.JSON(http.StatusOK, gin.H{
 		"imageUrl": imageUrl,
+		"path":     imagePath(filename),
 		"message":  "图片上传成功",
 	})
 }
@@ -83,73 +97,30 @@ func HandleSavePost(c *gin.Context) {
 	timeStr := currentTime.Format("2006-01-02 15:04")
 	utils.Logger.Printf("格式化后的时间: %v", timeStr)
 
-	// 构建文章内容
-	frontmatter := []string{
-		"---",
-		fmt.Sprintf("title:    %s", post.Title),
-		fmt.Sprintf("created:  %s", timeStr), // 使用当前时间
-		fmt.Sprintf("updated:  %s", timeStr), // 使用当前时间
-		fmt.Sprintf("category: %s", post.Category),
-		fmt.Sprintf("summary:  %s", post.Summary),
-		"tags:",
-	}
-
-	for _, tag := range post.Tags {
-		frontmatter = append(frontmatter, fmt.Sprintf("  - %s", tag))
-	}
-	frontmatter = append(frontmatter, "---")
-
-	// 提取主要内容（如果有的话）
-	mainContent := extractMainContent(post.Content)
-
-	// 组合完整的文章内容
-	fullContent := strings.Join(frontmatter, "\n") + "\n\n" + mainContent
-
-	// 清理标题，移除特殊字符
-	sanitizedTitle := strings.Map(func(r rune) rune {
-		switch {
-		case unicode.IsLetter(r), unicode.IsNumber(r):
-			return r
-		case unicode.IsSpace(r):
-			return '-'
-		default:
-			return '-'
+	// 使用当前时间构建文章ID，同时也是 markdown 文件名
+	post.ID = repository.NewPostID(currentTime, post.Title)
+	post.Created = timeStr
+	post.Updated = timeStr
+	post.Deleted = false
+	post.Content = repository.ExtractMainContent(relativizeImageURLs(post.Content, requestHosts(c)...))
+
+	utils.Logger.Printf("正在保存文章: %s", post.ID)
+	if err := repository.Posts.Create(post); err != nil {
+		if errors.Is(err, repository.ErrExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "同名文章已存在"})
+			return
 		}
-	}, post.Title)
-
-	// 使用当前时间构建文件名
-	fileName := fmt.Sprintf("%sT%s-%s.md",
-		currentTime.Format("2006-01-02"),
-		currentTime.Format("15-04"),
-		sanitizedTitle)
-
-	// 使用相对路径
-	postsDir := config.PostsDir
-	filePath := filepath.Join(postsDir, fileName)
-
-	// 确保目录存在
-	if err := os.MkdirAll(postsDir, 0755); err != nil {
-		utils.Logger.Printf("创建目录失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文章失败"})
-		return
-	}
-
-	// 写入文件
-	utils.Logger.Printf("正在保存文件: %s", filePath)
-	utils.Logger.Printf("文章内容: %s", fullContent)
-
-	if err := os.WriteFile(filePath, []byte(fullContent), 0644); err != nil {
-		utils.Logger.Printf("保存文件失败: %v", err)
+		utils.Logger.Printf("保存文章失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文章失败"})
 		return
 	}
+	publishPostEvent(events.PostCreated, post)
 
 	// 返回成功响应
-	urlPath := strings.TrimSuffix(fileName, ".md")
 	c.JSON(http.StatusOK, gin.H{
 		"message": "文章保存成功",
-		"path":    fileName,
-		"url":     urlPath,
+		"path":    post.ID + ".md",
+		"url":     post.ID,
 		"title":   post.Title,
 		"created": timeStr,
 		"updated": timeStr,
@@ -158,55 +129,52 @@ func HandleSavePost(c *gin.Context) {
 
 // 获取文章列表
 func HandleGetPosts(c *gin.Context) {
-	postsDir := config.PostsDir
-	files, err := os.ReadDir(postsDir)
+	posts, err := repository.Posts.List(false)
 	if err != nil {
-		utils.Logger.Printf("读取文章目录失败: %v", err)
+		utils.Logger.Printf("读取文章列表失败: %v", err)
 		c.JSON(http.StatusOK, []gin.H{}) // 返回空数组而不是错误
 		return
 	}
 
-	posts := getPostsList(files, postsDir, false)
-	if posts == nil {
-		posts = []gin.H{} // 确保返回空数组而不是 null
+	owner := isOwner(c)
+	result := []gin.H{}
+	for _, post := range posts {
+		if repository.IsDraft(post) && !owner {
+			continue
+		}
+		result = append(result, presentPost(c, postResponse(post)))
 	}
-	c.JSON(http.StatusOK, posts)
+	c.JSON(http.StatusOK, result)
 }
 
 // 获取单篇文章
 func HandleGetPostById(c *gin.Context) {
-	id := c.Param("id")
-	filePath := filepath.Join(config.PostsDir, id+".md")
-
-	post, err := getPostByPath(filePath)
-	if err != nil {
+	post, err := repository.Posts.Get(c.Param("id"))
+	if err != nil || (repository.IsDraft(post) && !isOwner(c)) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
 		return
 	}
+	if notModified(c, post) {
+		return
+	}
 
-	c.JSON(http.StatusOK, post)
+	c.JSON(http.StatusOK, presentPost(c, postResponse(post)))
 }
 
 // 更新文章
 func HandleUpdatePost(c *gin.Context) {
 	id := c.Param("id")
-	var post models.Post
-	if err := c.ShouldBindJSON(&post); err != nil {
+	var req models.Post
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
 		return
 	}
 
-	if post.Title == "" || post.Content == "" {
+	if req.Title == "" || req.Content == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "标题和内容不能为空"})
 		return
 	}
 
-	filePath := filepath.Join(config.PostsDir, id+".md")
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
-		return
-	}
-
 	// 使用北京时间，并添加详细日志
 	loc, err := time.LoadLocation("Asia/Shanghai")
 	if err != nil {
@@ -224,32 +192,58 @@ func HandleUpdatePost(c *gin.Context) {
 	now := beijingTime.Format("2006-01-02 15:04")
 	utils.Logger.Printf("格式化后的时间: %v", now)
 
-	post.Updated = now
+	otherLock, err := checkEditLock(c, id)
+	if respondEditLock(c, err) {
+		return
+	}
 
-	content := buildPostContent(post)
-	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+	post, err := repository.Posts.Update(id, func(post *models.Post) error {
+		if err := checkIfMatch(c, *post); err != nil {
+			return err
+		}
+		post.Title = req.Title
+		post.Category = req.Category
+		post.Summary = req.Summary
+		post.Tags = req.Tags
+		post.Created = req.Created
+		post.Updated = now
+		post.Content = repository.ExtractMainContent(relativizeImageURLs(req.Content, requestHosts(c)...))
+		return nil
+	})
+	if respondPrecondition(c, err) {
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
+		return
+	}
+	if err != nil {
 		utils.Logger.Printf("更新文章失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新文章失败"})
 		return
 	}
+	publishPostEvent(events.PostUpdated, post)
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "文章更新成功",
 		"path":    id + ".md",
 		"url":     id,
 		"title":   post.Title,
 		"created": post.Created,
 		"updated": now,
-	})
+	}
+	if otherLock != nil {
+		response["warning"] = "文章正在被其他人编辑，保存可能覆盖对方的修改"
+		response["lock"] = otherLock
+	}
+	c.Header("ETag", entityETag(post))
+	c.JSON(http.StatusOK, response)
 }
 
 // 软删除文章
 func HandleSoftDeletePost(c *gin.Context) {
-	id := c.Param("id")
-	filePath := filepath.Join(config.PostsDir, id+".md")
-
-	if err := updatePostDeleteStatus(filePath, true); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+	if err := setPostDeleted(c, c.Param("id"), true); err != nil {
+		respondPostError(c, err, "删除失败")
 		return
 	}
 
@@ -258,24 +252,24 @@ func HandleSoftDeletePost(c *gin.Context) {
 
 // 获取回收站文章
 func HandleGetTrashPosts(c *gin.Context) {
-	files, err := os.ReadDir(config.PostsDir)
+	posts, err := repository.Posts.List(true)
 	if err != nil {
-		utils.Logger.Printf("读取目录失败: %v", err)
+		utils.Logger.Printf("读取回收站失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回收站文章失败"})
 		return
 	}
 
-	posts := getPostsList(files, config.PostsDir, true)
-	c.JSON(http.StatusOK, gin.H{"posts": posts})
+	result := []gin.H{}
+	for _, post := range posts {
+		result = append(result, presentTrashPost(presentPost(c, postResponse(post)), post.DeletedAt))
+	}
+	c.JSON(http.StatusOK, gin.H{"posts": result})
 }
 
 // 恢复文章
 func HandleRestorePost(c *gin.Context) {
-	id := c.Param("id")
-	filePath := filepath.Join(config.PostsDir, id+".md")
-
-	if err := updatePostDeleteStatus(filePath, false); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+	if err := setPostDeleted(c, c.Param("id"), false); err != nil {
+		respondPostError(c, err, "恢复失败")
 		return
 	}
 
@@ -284,27 +278,11 @@ func HandleRestorePost(c *gin.Context) {
 
 // 永久删除文章
 func HandlePermanentDelete(c *gin.Context) {
-	id := c.Param("id")
-	filePath := filepath.Join(config.PostsDir, id+".md")
-
-	content, err := os.ReadFile(filePath)
+	err := purgePost(c.Param("id"), func(post models.Post) error {
+		return checkIfMatch(c, post)
+	})
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
-		return
-	}
-
-	// 删除文章中的图片
-	imgRegex := regexp.MustCompile(`!\[.*?\]\((.*?)\)`)
-	matches := imgRegex.FindAllStringSubmatch(string(content), -1)
-	for _, match := range matches {
-		if len(match) > 1 {
-			imgPath := filepath.Join(config.ImagesDir, filepath.Base(match[1]))
-			os.Remove(imgPath)
-		}
-	}
-
-	if err := os.Remove(filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除文章失败"})
+		respondPostError(c, err, "删除文章失败")
 		return
 	}
 
@@ -312,129 +290,90 @@ func HandlePermanentDelete(c *gin.Context) {
 }
 
 // 辅助函数
-func buildPostContent(post models.Post) string {
-	frontmatter := []string{
-		"---",
-		fmt.Sprintf("title:    %s", post.Title),
-		fmt.Sprintf("created:  %s", post.Created),
-		fmt.Sprintf("updated:  %s", post.Updated),
-		fmt.Sprintf("category: %s", post.Category),
-		fmt.Sprintf("summary:  %s", post.Summary),
-		"tags:",
+func setPostDeleted(c *gin.Context, id string, deleted bool) error {
+	post, err := repository.Posts.Update(id, func(post *models.Post) error {
+		if err := checkIfMatch(c, *post); err != nil {
+			return err
+		}
+		post.Deleted = deleted
+		post.DeletedAt = ""
+		if deleted {
+			post.DeletedAt = time.Now().In(loadTimeZone()).Format(time.RFC3339)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-
-	for _, tag := range post.Tags {
-		frontmatter = append(frontmatter, fmt.Sprintf("  - %s", tag))
+	if deleted {
+		publishPostEvent(events.PostTrashed, post)
+	} else {
+		publishPostEvent(events.PostRestored, post)
 	}
-	frontmatter = append(frontmatter, "---")
-
-	mainContent := extractMainContent(post.Content)
-	return strings.Join(frontmatter, "\n") + "\n\n" + mainContent
+	return nil
 }
 
-func extractMainContent(content string) string {
-	contentRegex := regexp.MustCompile(`(?s)^---\n.*?\n---\n\s*([\s\S]*)$`)
-	matches := contentRegex.FindStringSubmatch(content)
-	if len(matches) > 1 {
-		return strings.TrimSpace(matches[1])
+// 版本不匹配时返回 412，文章不存在时返回 404，其他错误记录日志后返回 500
+func respondPostError(c *gin.Context, err error, message string) {
+	if respondPrecondition(c, err) {
+		return
 	}
-	return strings.TrimSpace(content)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
+		return
+	}
+	utils.Logger.Printf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
 }
 
-func updatePostDeleteStatus(filePath string, deleted bool) error {
-	content, err := os.ReadFile(filePath)
+// 删除文章和只被这篇文章使用的图片，check 在删除前以当前内容调用，见 PostRepository.Delete
+func purgePost(id string, check func(models.Post) error) error {
+	post, err := repository.Posts.Get(id)
 	if err != nil {
 		return err
 	}
 
-	frontmatterRegex := regexp.MustCompile(`(?s)^(---\n.*?\n---\n)(.*)$`)
-	matches := frontmatterRegex.FindStringSubmatch(string(content))
-	if len(matches) != 3 {
-		return fmt.Errorf("无效的文章格式")
+	index, err := buildImageRefIndex()
+	if err != nil {
+		return fmt.Errorf("检查图片引用失败: %w", err)
 	}
 
-	frontmatter, mainContent := matches[1], matches[2]
-	if strings.Contains(frontmatter, "deleted:") {
-		frontmatter = strings.Replace(frontmatter,
-			fmt.Sprintf("deleted: %v", !deleted),
-			fmt.Sprintf("deleted: %v", deleted), 1)
-	} else {
-		frontmatter = strings.TrimSuffix(frontmatter, "---\n") +
-			fmt.Sprintf("deleted: %v\n---\n", deleted)
+	if err := repository.Posts.Delete(id, check); err != nil {
+		return err
 	}
+	dropEditLock(id)
+	publishPostEvent(events.PostDeleted, post)
 
-	newContent := frontmatter + mainContent
-	return os.WriteFile(filePath, []byte(newContent), 0644)
-}
-
-func getPostsList(files []os.DirEntry, postsDir string, deleted bool) []gin.H {
-	var posts []gin.H
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".md") {
-			content, err := os.ReadFile(filepath.Join(postsDir, file.Name()))
-			if err != nil {
-				continue
-			}
-
-			isDeleted := strings.Contains(string(content), "deleted: true")
-			if isDeleted != deleted {
-				continue
-			}
-
-			if post, err := parsePost(content, file.Name()); err == nil {
-				posts = append(posts, post)
-			}
+	self := ImageRef{Type: "post", ID: id}
+	for _, name := range extractImageNames(post.Content) {
+		if refs := index.refsExcept(name, self); len(refs) > 0 {
+			utils.Logger.Printf("图片 %s 仍被 %d 处引用，保留", name, len(refs))
+			continue
 		}
-	}
-
-	// 按创建时间排序
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i]["created"].(string) > posts[j]["created"].(string)
-	})
-
-	return posts
-}
-
-func parsePost(content []byte, fileName string) (gin.H, error) {
-	frontmatterRegex := regexp.MustCompile(`(?s)^---\n(.*?)\n---\n`)
-	matches := frontmatterRegex.FindSubmatch(content)
-	if len(matches) < 2 {
-		return nil, fmt.Errorf("无效的文章格式")
-	}
-
-	frontmatter := string(matches[1])
-	title := utils.ExtractField(frontmatter, "title")
-	created := utils.ExtractField(frontmatter, "created")
-	updated := utils.ExtractField(frontmatter, "updated")
-	category := utils.ExtractField(frontmatter, "category")
-	summary := utils.ExtractField(frontmatter, "summary")
-
-	var tags []string
-	tagRegex := regexp.MustCompile(`(?m)^  - (.+)$`)
-	tagMatches := tagRegex.FindAllStringSubmatch(frontmatter, -1)
-	for _, match := range tagMatches {
-		if len(match) > 1 {
-			tags = append(tags, match[1])
+		if err := removeImage(name); err != nil {
+			utils.Logger.Printf("删除图片失败 %s: %v", name, err)
 		}
 	}
-
-	id := strings.TrimSuffix(fileName, ".md")
-	return gin.H{
-		"id":       id,
-		"title":    title,
-		"created":  created,
-		"updated":  updated,
-		"category": category,
-		"summary":  summary,
-		"tags":     tags,
-		"content":  string(content),
-	}, nil
+	return nil
 }
-func getPostByPath(filePath string) (gin.H, error) {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, err
-	}
 
-	return parsePost(content, filepath.Base(filePath))
+// 文章的接口输出格式，content 为带 frontmatter 的完整 markdown
+func postResponse(post models.Post) gin.H {
+	response := gin.H{
+		"id":       post.ID,
+		"title":    post.Title,
+		"created":  post.Created,
+		"updated":  post.Updated,
+		"category": post.Category,
+		"summary":  post.Summary,
+		"tags":     post.Tags,
+		"content":  repository.FormatPost(post),
+	}
+	if post.DeletedAt != "" {
+		response["deleted_at"] = post.DeletedAt
+	}
+	if repository.IsDraft(post) {
+		response["draft"] = true
+	}
+	return response
 }
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 分片上传协议兼容 tus 1.0.0 的核心部分
+const tusVersion = "1.0.0"
+
+// 同一个上传会话的请求需要串行处理
+var uploadLocks sync.Map
+
+// 创建分片上传
+func HandleCreateUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 Upload-Length"})
+		return
+	}
+	if length > config.MaxResumableSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件过大"})
+		return
+	}
+
+	cleanupExpiredUploads()
+
+	metadata := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = "image"
+	}
+	if contentType := metadata["filetype"]; contentType != "" && !utils.IsAllowedImageType(contentType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型"})
+		return
+	}
+
+	session := models.UploadSession{
+		ID:        uuid.New().String(),
+		Filename:  filename,
+		Length:    length,
+		CreatedAt: time.Now(),
+	}
+	if err := os.WriteFile(uploadPartPath(session.ID), nil, 0600); err != nil {
+		utils.Logger.Printf("创建暂存文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+	if err := writeUploadSession(session); err != nil {
+		os.Remove(uploadPartPath(session.ID))
+		utils.Logger.Printf("保存上传会话失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+
+	location := "/api/uploads/" + session.ID
+	c.Header("Location", location)
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, gin.H{
+		"id":       session.ID,
+		"location": location,
+		"offset":   0,
+		"length":   length,
+	})
+}
+
+// 查询上传进度
+func HandleUploadProgress(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+
+	session, offset, err := loadUploadSession(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Length, 10))
+	c.Status(http.StatusOK)
+}
+
+// 上传一个分片，Upload-Offset 必须等于已上传的字节数
+func HandleUploadChunk(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type 必须是 application/offset+octet-stream"})
+		return
+	}
+
+	id := c.Param("id")
+	unlock := lockUpload(id)
+	defer unlock()
+
+	session, offset, err := loadUploadSession(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传不存在"})
+		return
+	}
+
+	clientOffset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 Upload-Offset"})
+		return
+	}
+	if clientOffset != offset {
+		c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset 与服务器不一致", "offset": offset})
+		return
+	}
+
+	f, err := os.OpenFile(uploadPartPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		utils.Logger.Printf("打开暂存文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存分片失败"})
+		return
+	}
+
+	// 连接中断时保留已收到的部分，客户端通过 HEAD 查询后续传
+	written, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, session.Length-offset))
+	syncErr := f.Sync()
+	f.Close()
+	offset += written
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	if copyErr != nil || syncErr != nil {
+		utils.Logger.Printf("保存分片中断 %s: %v %v", id, copyErr, syncErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存分片失败", "offset": offset})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// 完成上传：所有分片到齐后走与普通上传相同的校验和保存流程
+func HandleFinalizeUpload(c *gin.Context) {
+	id := c.Param("id")
+	unlock := lockUpload(id)
+	defer unlock()
+
+	session, offset, err := loadUploadSession(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传不存在"})
+		return
+	}
+	if offset != session.Length {
+		c.JSON(http.StatusConflict, gin.H{"error": "文件尚未上传完成", "offset": offset, "length": session.Length})
+		return
+	}
+
+	data, err := os.ReadFile(uploadPartPath(id))
+	if err != nil {
+		utils.Logger.Printf("读取暂存文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
+		return
+	}
+
+	filename, err := saveImage(session.Filename, data)
+	if errors.Is(err, errUnsupportedImageType) {
+		removeUpload(id)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型"})
+		return
+	}
+	if err != nil {
+		utils.Logger.Printf("保存文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
+		return
+	}
+	removeUpload(id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"imageUrl": imageURL(c, filename),
+		"path":     imagePath(filename),
+		"message":  "图片上传成功",
+	})
+}
+
+// 取消上传
+func HandleCancelUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	id := c.Param("id")
+	unlock := lockUpload(id)
+	defer unlock()
+
+	if _, _, err := loadUploadSession(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传不存在"})
+		return
+	}
+	removeUpload(id)
+	c.Status(http.StatusNoContent)
+}
+
+// 辅助函数
+func lockUpload(id string) func() {
+	v, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+func uploadSessionPath(id string) string {
+	return filepath.Join(config.UploadsDir, id+".json")
+}
+
+func uploadPartPath(id string) string {
+	return filepath.Join(config.UploadsDir, id+".part")
+}
+
+// 读取上传会话和当前偏移量
+func loadUploadSession(id string) (models.UploadSession, int64, error) {
+	var session models.UploadSession
+	if _, err := uuid.Parse(id); err != nil {
+		return session, 0, err
+	}
+
+	data, err := os.ReadFile(uploadSessionPath(id))
+	if err != nil {
+		return session, 0, err
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return session, 0, err
+	}
+
+	info, err := os.Stat(uploadPartPath(id))
+	if err != nil {
+		return session, 0, err
+	}
+	if uploadExpired(session.CreatedAt, info.ModTime()) {
+		return session, 0, fmt.Errorf("上传已过期")
+	}
+	return session, info.Size(), nil
+}
+
+// 过期时间从最后一次收到分片开始计算，持续上传的大文件不会过期
+func uploadExpired(times ...time.Time) bool {
+	var last time.Time
+	for _, t := range times {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return time.Since(last) > config.ResumableExpiry
+}
+
+func writeUploadSession(session models.UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(uploadSessionPath(session.ID), data, 0600)
+}
+
+func removeUpload(id string) {
+	os.Remove(uploadPartPath(id))
+	os.Remove(uploadSessionPath(id))
+	uploadLocks.Delete(id)
+}
+
+// 清理过期未完成的上传
+func cleanupExpiredUploads() {
+	files, err := os.ReadDir(config.UploadsDir)
+	if err != nil {
+		return
+	}
+	ids := make(map[string]bool)
+	for _, file := range files {
+		name := file.Name()
+		if id := strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".part"); id != name {
+			ids[id] = true
+		}
+	}
+	for id := range ids {
+		cleanupExpiredUpload(id)
+	}
+}
+
+// 持有会话锁时检查和删除，正在写入分片的会话直接跳过
+func cleanupExpiredUpload(id string) {
+	v, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	if !mu.TryLock() {
+		return
+	}
+	defer mu.Unlock()
+
+	var times []time.Time
+	for _, path := range []string{uploadSessionPath(id), uploadPartPath(id)} {
+		if info, err := os.Stat(path); err == nil {
+			times = append(times, info.ModTime())
+		}
+	}
+	if len(times) == 0 {
+		uploadLocks.Delete(id)
+		return
+	}
+	if !uploadExpired(times...) {
+		return
+	}
+	removeUpload(id)
+	utils.Logger.Printf("已清理过期上传: %s", id)
+}
+
+// 解析 tus 的 Upload-Metadata 头: "key base64value,key base64value"
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
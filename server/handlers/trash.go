@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/repository"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 永久删除前重新检查时内容已恢复，或重新移入回收站后未到清理时间
+var errNotPurgeable = errors.New("内容已不在回收站中或未到清理时间")
+
+// 定期永久删除回收站中超过保留期的文章和照片
+func StartTrashPurger() {
+	if config.TrashRetention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.TrashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			posts, photos, err := PurgeExpiredTrash()
+			if err != nil {
+				utils.Logger.Printf("清理回收站失败: %v", err)
+			} else if posts > 0 || photos > 0 {
+				utils.Logger.Printf("已清理回收站中过期的 %d 篇文章和 %d 张照片", posts, photos)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// 永久删除超过保留期的内容，没有删除时间的旧数据从现在开始计算保留期
+func PurgeExpiredTrash() (posts, photos int, err error) {
+	if config.TrashRetention <= 0 {
+		return 0, 0, nil
+	}
+	now := time.Now().In(loadTimeZone())
+
+	trashedPosts, err := repository.Posts.List(true)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, post := range trashedPosts {
+		if _, err := time.Parse(time.RFC3339, post.DeletedAt); err != nil {
+			_, err := repository.Posts.Update(post.ID, func(post *models.Post) error {
+				post.DeletedAt = now.Format(time.RFC3339)
+				return nil
+			})
+			if err != nil {
+				utils.Logger.Printf("记录文章删除时间失败 %s: %v", post.ID, err)
+			}
+			continue
+		}
+		if !postExpired(post, now) {
+			continue
+		}
+		err := purgePost(post.ID, func(post models.Post) error {
+			if !postExpired(post, now) {
+				return errNotPurgeable
+			}
+			return nil
+		})
+		if err != nil {
+			if !errors.Is(err, errNotPurgeable) && !errors.Is(err, repository.ErrNotFound) {
+				utils.Logger.Printf("永久删除文章失败 %s: %v", post.ID, err)
+			}
+			continue
+		}
+		posts++
+	}
+
+	photoList, err := repository.Photos.List()
+	if err != nil {
+		return posts, 0, err
+	}
+	for _, photo := range photoList {
+		if !photo.Deleted {
+			continue
+		}
+		if photo.DeletedAt == nil {
+			_, err := repository.Photos.Update(photo.ID, func(photo *models.Photo) error {
+				photo.DeletedAt = &now
+				return nil
+			})
+			if err != nil {
+				utils.Logger.Printf("记录照片删除时间失败 %s: %v", photo.ID, err)
+			}
+			continue
+		}
+		if !photoExpired(photo, now) {
+			continue
+		}
+		err := purgePhoto(photo.ID, func(photo models.Photo) error {
+			if !photoExpired(photo, now) {
+				return errNotPurgeable
+			}
+			return nil
+		})
+		if err != nil {
+			if !errors.Is(err, errNotPurgeable) && !errors.Is(err, repository.ErrNotFound) {
+				utils.Logger.Printf("永久删除照片失败 %s: %v", photo.ID, err)
+			}
+			continue
+		}
+		photos++
+	}
+	return posts, photos, nil
+}
+
+// 仍在回收站中且超过保留期
+func postExpired(post models.Post, now time.Time) bool {
+	deletedAt, err := time.Parse(time.RFC3339, post.DeletedAt)
+	return post.Deleted && err == nil && now.Sub(deletedAt) >= config.TrashRetention
+}
+
+func photoExpired(photo models.Photo, now time.Time) bool {
+	return photo.Deleted && photo.DeletedAt != nil && now.Sub(*photo.DeletedAt) >= config.TrashRetention
+}
+
+// 清空回收站时跳过在此期间已恢复的内容
+func postInTrash(post models.Post) error {
+	if !post.Deleted {
+		return errNotPurgeable
+	}
+	return nil
+}
+
+func photoInTrash(photo models.Photo) error {
+	if !photo.Deleted {
+		return errNotPurgeable
+	}
+	return nil
+}
+
+// 清空文章回收站
+func HandleEmptyTrash(c *gin.Context) {
+	trashedPosts, err := repository.Posts.List(true)
+	if err != nil {
+		utils.Logger.Printf("读取回收站失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清空回收站失败"})
+		return
+	}
+
+	removed, failed := 0, 0
+	for _, post := range trashedPosts {
+		err := purgePost(post.ID, postInTrash)
+		if errors.Is(err, errNotPurgeable) || errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			utils.Logger.Printf("永久删除文章失败 %s: %v", post.ID, err)
+			failed++
+			continue
+		}
+		removed++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "回收站已清空", "removed": removed, "failed": failed})
+}
+
+// 清空照片回收站
+func HandleEmptyPhotoTrash(c *gin.Context) {
+	photoList, err := repository.Photos.List()
+	if err != nil {
+		utils.Logger.Printf("读取照片数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清空回收站失败"})
+		return
+	}
+
+	removed, failed := 0, 0
+	for _, photo := range photoList {
+		if !photo.Deleted {
+			continue
+		}
+		err := purgePhoto(photo.ID, photoInTrash)
+		if errors.Is(err, errNotPurgeable) || errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			utils.Logger.Printf("永久删除照片失败 %s: %v", photo.ID, err)
+			failed++
+			continue
+		}
+		removed++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "回收站已清空", "removed": removed, "failed": failed})
+}
+
+// 自动清理的时间，未开启自动清理或删除时间未知时返回 nil
+func trashPurgeAt(deletedAt time.Time) *time.Time {
+	if config.TrashRetention <= 0 || deletedAt.IsZero() {
+		return nil
+	}
+	purgeAt := deletedAt.Add(config.TrashRetention)
+	return &purgeAt
+}
+
+// 距离自动清理的剩余秒数，已过期但尚未清理时为 0
+func trashRemainingSeconds(purgeAt time.Time) int64 {
+	remaining := int64(time.Until(purgeAt) / time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
+}
+
+// 为回收站中的文章添加清理时间
+func presentTrashPost(post gin.H, deletedAt string) gin.H {
+	t, _ := time.Parse(time.RFC3339, deletedAt)
+	if purgeAt := trashPurgeAt(t); purgeAt != nil {
+		post["purge_at"] = purgeAt
+		post["remaining_seconds"] = trashRemainingSeconds(*purgeAt)
+	}
+	return post
+}
+
+// 为回收站中的照片添加清理时间
+func presentTrashPhoto(photo models.Photo) models.Photo {
+	if photo.DeletedAt == nil {
+		return photo
+	}
+	if purgeAt := trashPurgeAt(*photo.DeletedAt); purgeAt != nil {
+		remaining := trashRemainingSeconds(*purgeAt)
+		photo.PurgeAt = purgeAt
+		photo.RemainingSeconds = &remaining
+	}
+	return photo
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"server/config"
+	"server/events"
+	"server/exif"
+	"server/imaging"
+	"server/storage"
+	"server/utils"
+)
+
+var errUnsupportedImageType = errors.New("不支持的文件类型")
+
+// 图片上传的统一处理流程：校验类型、按策略处理元数据、保存到图片目录，返回保存的文件名
+func saveImage(originalName string, data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !utils.IsAllowedImageType(contentType) {
+		return "", fmt.Errorf("%w: %s", errUnsupportedImageType, contentType)
+	}
+
+	filename := fmt.Sprintf("%d-%s", time.Now().UnixNano(), sanitizeFileName(originalName))
+
+	public, err := sanitizeImageMetadata(data, contentType)
+	if err != nil {
+		return "", fmt.Errorf("处理图片元数据失败: %w", err)
+	}
+
+	if config.KeepOriginalMetadata && !bytes.Equal(public, data) {
+		if err := storage.Originals.Put(filename, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			return "", fmt.Errorf("保存原始图片失败: %w", err)
+		}
+	}
+
+	if err := storage.Images.Put(filename, bytes.NewReader(public), int64(len(public)), contentType); err != nil {
+		return "", fmt.Errorf("保存文件失败: %w", err)
+	}
+
+	// 占位信息生成失败不影响上传，之后可以通过 placeholders 命令补充
+	if err := savePlaceholder(filename, public); err != nil {
+		utils.Logger.Printf("生成占位信息失败 %s: %v", filename, err)
+	}
+	events.Publish(events.ImageUploaded, map[string]string{"name": filename, "path": imagePath(filename)})
+	return filename, nil
+}
+
+// 导入文章时保存引用的图片，按上传流程处理，返回写入文章的图片路径
+func ImportImage(originalName string, data []byte) (string, error) {
+	filename, err := saveImage(originalName, data)
+	if err != nil {
+		return "", err
+	}
+	return imagePath(filename), nil
+}
+
+// 按上传策略移除元数据，移除前先把方向标签应用到像素上
+func sanitizeImageMetadata(data []byte, contentType string) ([]byte, error) {
+	var strip func([]byte) ([]byte, error)
+	switch config.UploadMetadataPolicy {
+	case config.MetadataStripGPS:
+		strip = exif.StripGPS
+	case config.MetadataStripAll:
+		strip = exif.StripAll
+	default:
+		return data, nil
+	}
+
+	cleaned, err := strip(data)
+	if err != nil {
+		return nil, err
+	}
+
+	orientation := 1
+	if contentType == "image/jpeg" {
+		orientation = exif.Orientation(data)
+	}
+	if orientation == 1 {
+		return cleaned, nil
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(cleaned))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, imaging.ApplyOrientation(img, orientation), &jpeg.Options{Quality: 92}); err != nil {
+		return nil, err
+	}
+	return exif.ResetOrientation(exif.CopyJPEGMetadata(cleaned, buf.Bytes())), nil
+}
+
+// 只保留文件名本身，去掉路径和空白
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r', '/', '?', '#', '%':
+			return '-'
+		}
+		return r
+	}, name)
+	if name == "." || name == "" {
+		return "image"
+	}
+	return name
+}
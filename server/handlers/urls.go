@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"server/config"
+	"server/models"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 内容中保存的图片路径都以此开头，输出时再补全为完整地址
+const imagePathPrefix = "/content/images/"
+
+// 内容中以根路径开头的图片地址
+var relativeImageURLRegex = regexp.MustCompile(`(^|[\s("'=])/content/images/`)
+
+// 内容中任意域名下的图片完整地址，替换时再判断是否为本站域名
+var absoluteImageURLRegex = regexp.MustCompile(`(?:https?:)?//([^/\s"'()<>]+)/content/images/`)
+
+// 图片的根相对路径
+func imagePath(name string) string {
+	return imagePathPrefix + url.PathEscape(name)
+}
+
+// 图片的完整访问地址，优先使用 CDN
+func imageURL(c *gin.Context, name string) string {
+	if config.ImageCDNPrefix != "" {
+		return config.ImageCDNPrefix + "/" + url.PathEscape(name)
+	}
+	return publicBaseURL(c) + imagePath(name)
+}
+
+// 站点对外地址，未配置时根据请求推断，只采用可信代理传来的 X-Forwarded-* 请求头
+func publicBaseURL(c *gin.Context) string {
+	if config.PublicBaseURL != "" {
+		return config.PublicBaseURL
+	}
+
+	scheme, host := "http", c.Request.Host
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if isTrustedProxy(c.RemoteIP()) {
+		if proto := forwardedValue(c.GetHeader("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := forwardedValue(c.GetHeader("X-Forwarded-Host")); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+	return scheme + "://" + host
+}
+
+// 多层代理时取最靠近客户端的值
+func forwardedValue(header string) string {
+	value, _, _ := strings.Cut(header, ",")
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+func isTrustedProxy(ip string) bool {
+	remote := net.ParseIP(ip)
+	if remote == nil {
+		return false
+	}
+	for _, proxy := range config.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(remote) {
+				return true
+			}
+		} else if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(remote) {
+			return true
+		}
+	}
+	return false
+}
+
+// 当前请求使用的域名，和配置的域名一起视为本站域名
+func requestHosts(c *gin.Context) []string {
+	return []string{c.Request.Host, publicBaseURL(c)}
+}
+
+// 保存前把指向本站图片的完整地址改为根相对路径，更换域名或 CDN 后无需修改内容；
+// 只处理本站域名，其他网站的图片和代码中的地址保持原样
+func relativizeImageURLs(content string, requestHosts ...string) string {
+	own := make(map[string]bool)
+	for _, host := range utils.OwnImageHosts(requestHosts...) {
+		own[host] = true
+	}
+	return utils.ReplaceOutsideCode(content, func(text string) string {
+		if config.ImageCDNPrefix != "" {
+			text = strings.ReplaceAll(text, config.ImageCDNPrefix+"/", imagePathPrefix)
+		}
+		return absoluteImageURLRegex.ReplaceAllStringFunc(text, func(match string) string {
+			_, rest, _ := strings.Cut(match, "//")
+			if own[strings.ToLower(strings.TrimSuffix(rest, imagePathPrefix))] {
+				return imagePathPrefix
+			}
+			return match
+		})
+	})
+}
+
+// 输出前把根相对路径补全为当前配置下的完整地址，本站域名的完整地址也会换成当前配置的地址
+func absolutizeImageURLs(c *gin.Context, content string) string {
+	base := publicBaseURL(c) + imagePathPrefix
+	if config.ImageCDNPrefix != "" {
+		base = config.ImageCDNPrefix + "/"
+	}
+	return utils.ReplaceOutsideCode(relativizeImageURLs(content, requestHosts(c)...), func(text string) string {
+		return relativeImageURLRegex.ReplaceAllString(text, "${1}"+base)
+	})
+}
+
+// 文章输出前补全内容中的图片地址，并附上引用图片的占位信息
+func presentPost(c *gin.Context, post gin.H) gin.H {
+	if content, ok := post["content"].(string); ok {
+		post["images"] = postImages(c, content)
+		post["content"] = absolutizeImageURLs(c, content)
+	}
+	return post
+}
+
+func relativizeImageURLList(urls []string, requestHosts ...string) []string {
+	result := make([]string, len(urls))
+	for i, u := range urls {
+		result[i] = relativizeImageURLs(u, requestHosts...)
+	}
+	return result
+}
+
+// 照片输出前补全图片地址和尺寸，拍摄信息的键也要同步替换，并附上占位信息和所在相册
+func presentPhoto(c *gin.Context, photo models.Photo) models.Photo {
+	mediaData := requestMediaData(c)
+	images := make([]models.PhotoImage, len(photo.Images))
+	for i, image := range photo.Images {
+		if image.Width == 0 {
+			image.Width, image.Height, _ = localImageSize(mediaData, image.URL)
+		}
+		image.URL = absolutizeImageURLs(c, image.URL)
+		images[i] = image
+	}
+	photo.Images = images
+	photo.URLs = photoURLs(images)
+
+	if photo.Exif != nil {
+		photoExif := make(map[string]models.PhotoExif, len(photo.Exif))
+		for u, e := range photo.Exif {
+			photoExif[absolutizeImageURLs(c, u)] = e
+		}
+		photo.Exif = photoExif
+	}
+	photo.Placeholders = photoPlaceholders(c, photo.URLs)
+	photo.Albums = photoAlbumIDs(requestAlbumsData(c), photo.ID, isOwner(c))
+	return photo
+}
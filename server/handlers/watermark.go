@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"server/config"
+	"server/exif"
+	"server/imaging"
+	"server/models"
+	"server/repository"
+	"server/storage"
+	"server/utils"
+
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+var errWatermarkUnsupported = errors.New("只支持为 JPEG 和 PNG 图片添加水印")
+
+var (
+	watermarkOnce        sync.Once
+	watermark            *imaging.Watermark
+	watermarkFingerprint string
+	watermarkErr         error
+)
+
+// 读取水印配置，指纹随配置和水印文件内容变化，用于判断图片是否需要重新生成
+func loadWatermark() (*imaging.Watermark, string, error) {
+	watermarkOnce.Do(func() {
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n", config.WatermarkText, config.WatermarkPosition,
+			strconv.FormatFloat(config.WatermarkOpacity, 'f', -1, 64), strconv.FormatFloat(config.WatermarkScale, 'f', -1, 64))
+
+		w := &imaging.Watermark{
+			Text:     config.WatermarkText,
+			Position: config.WatermarkPosition,
+			Opacity:  config.WatermarkOpacity,
+			Scale:    config.WatermarkScale,
+		}
+
+		if config.WatermarkImage != "" {
+			data, err := os.ReadFile(config.WatermarkImage)
+			if err != nil {
+				watermarkErr = fmt.Errorf("读取水印图片失败: %w", err)
+				return
+			}
+			if w.Overlay, err = png.Decode(bytes.NewReader(data)); err != nil {
+				watermarkErr = fmt.Errorf("解析水印图片失败: %w", err)
+				return
+			}
+			hash.Write(data)
+		} else {
+			fontData := goregular.TTF
+			if config.WatermarkFont != "" {
+				data, err := os.ReadFile(config.WatermarkFont)
+				if err != nil {
+					watermarkErr = fmt.Errorf("读取水印字体失败: %w", err)
+					return
+				}
+				fontData = data
+			}
+			font, err := opentype.Parse(fontData)
+			if err != nil {
+				watermarkErr = fmt.Errorf("解析水印字体失败: %w", err)
+				return
+			}
+			w.Font = font
+			hash.Write(fontData)
+		}
+
+		watermark = w
+		watermarkFingerprint = hex.EncodeToString(hash.Sum(nil))[:16]
+	})
+	return watermark, watermarkFingerprint, watermarkErr
+}
+
+// 为照片中的本站图片添加水印，已按当前配置处理过的图片跳过
+func watermarkPhotoImages(urls []string) {
+	if !config.WatermarkEnabled {
+		return
+	}
+	_, fingerprint, err := loadWatermark()
+	if err != nil {
+		utils.Logger.Printf("加载水印配置失败: %v", err)
+		return
+	}
+	mediaData, err := readMediaData()
+	if err != nil {
+		utils.Logger.Printf("读取媒体数据失败: %v", err)
+		return
+	}
+
+	for _, name := range photoImageNames(urls) {
+		if mediaData.Items[name].Watermark == fingerprint {
+			continue
+		}
+		if err := applyWatermark(name); err != nil {
+			utils.Logger.Printf("添加水印失败 %s: %v", name, err)
+		}
+	}
+}
+
+// 按当前配置重新生成所有照片图片，关闭水印时恢复为不带水印的图片
+func RewatermarkPhotos(force bool) (updated, failed int, err error) {
+	photoList, err := repository.Photos.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	mediaData, err := readMediaData()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fingerprint := ""
+	if config.WatermarkEnabled {
+		if _, fingerprint, err = loadWatermark(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, photo := range photoList {
+		for _, name := range photoImageNames(photoURLs(photo.Images)) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if !force && mediaData.Items[name].Watermark == fingerprint {
+				continue
+			}
+			if err := applyWatermark(name); err != nil {
+				utils.Logger.Printf("处理水印失败 %s: %v", name, err)
+				failed++
+				continue
+			}
+			updated++
+		}
+	}
+	return updated, failed, nil
+}
+
+// 从不带水印的原图重新生成公开图片，未启用水印时只恢复原图
+func applyWatermark(name string) error {
+	source, err := storage.ReadAll(storage.Originals, name)
+	if errors.Is(err, storage.ErrNotExist) {
+		// 第一次加水印前把当前图片保存为原图
+		if source, err = storage.ReadAll(storage.Images, name); err != nil {
+			return err
+		}
+		contentType := http.DetectContentType(source)
+		if err := storage.Originals.Put(name, bytes.NewReader(source), int64(len(source)), contentType); err != nil {
+			return fmt.Errorf("保存原始图片失败: %w", err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	contentType := http.DetectContentType(source)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return errWatermarkUnsupported
+	}
+
+	public, err := sanitizeImageMetadata(source, contentType)
+	if err != nil {
+		return err
+	}
+
+	fingerprint := ""
+	if config.WatermarkEnabled {
+		w, fp, err := loadWatermark()
+		if err != nil {
+			return err
+		}
+		if public, err = renderWatermark(w, public, contentType); err != nil {
+			return err
+		}
+		fingerprint = fp
+	}
+
+	if err := storage.Images.Put(name, bytes.NewReader(public), int64(len(public)), contentType); err != nil {
+		return err
+	}
+	if err := savePlaceholder(name, public); err != nil {
+		utils.Logger.Printf("生成占位信息失败 %s: %v", name, err)
+	}
+	return updateMediaData(func(mediaData *models.MediaData) error {
+		meta := mediaData.Items[name]
+		meta.Watermark = fingerprint
+		mediaData.Items[name] = meta
+		return nil
+	})
+}
+
+// 叠加水印后重新编码，JPEG 保留处理后的元数据
+func renderWatermark(w *imaging.Watermark, data []byte, contentType string) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if contentType == "image/png" {
+		marked, err := w.Apply(img)
+		if err != nil {
+			return nil, err
+		}
+		if err := png.Encode(&buf, marked); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	// 保留元数据的策略下图片可能还带有方向标签，先转正再加水印
+	marked, err := w.Apply(imaging.ApplyOrientation(img, exif.Orientation(data)))
+	if err != nil {
+		return nil, err
+	}
+	if err := jpeg.Encode(&buf, marked, &jpeg.Options{Quality: 92}); err != nil {
+		return nil, err
+	}
+	return exif.ResetOrientation(exif.CopyJPEGMetadata(data, buf.Bytes())), nil
+}
+
+// 照片地址中指向本站的图片文件名
+func photoImageNames(urls []string) []string {
+	var names []string
+	for _, u := range relativizeImageURLList(urls) {
+		if !strings.HasPrefix(u, imagePathPrefix) {
+			continue
+		}
+		if name := imageFileName(u); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
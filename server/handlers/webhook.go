@@ -0,0 +1,682 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/config"
+	"server/events"
+	"server/models"
+	"server/repository"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 测试投递使用的事件类型，不会出现在事件流中
+const webhookTestEvent = "webhook.test"
+
+var errWebhookNotFound = errors.New("Webhook 不存在")
+
+type webhookRequestError string
+
+func (e webhookRequestError) Error() string { return string(e) }
+
+// 有新的投递时唤醒投递协程
+var webhookWake = make(chan struct{}, 1)
+
+// 获取 Webhook 列表
+func HandleGetWebhooks(c *gin.Context) {
+	data, err := repository.Webhooks.Read()
+	if err != nil {
+		utils.Logger.Printf("读取 Webhook 数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+
+	list := []gin.H{}
+	for _, webhook := range data.Webhooks {
+		list = append(list, webhookResponse(webhook, false))
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": list})
+}
+
+// 获取单个 Webhook
+func HandleGetWebhookById(c *gin.Context) {
+	data, err := repository.Webhooks.Read()
+	if err != nil {
+		utils.Logger.Printf("读取 Webhook 数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+	webhook := findWebhook(&data, c.Param("id"))
+	if webhook == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errWebhookNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookResponse(*webhook, false))
+}
+
+// 创建 Webhook，未提供密钥时自动生成；密钥只在创建时返回
+func HandleCreateWebhook(c *gin.Context) {
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+	if err := validateWebhookRequest(&req); err != nil {
+		respondWebhookError(c, err, "创建 Webhook 失败")
+		return
+	}
+
+	now := time.Now()
+	webhook := models.Webhook{
+		ID:        uuid.New().String(),
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    req.Secret,
+		Active:    req.Active == nil || *req.Active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = generateWebhookSecret()
+	}
+	err := repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		data.Webhooks = append(data.Webhooks, webhook)
+		return nil
+	})
+	if err != nil {
+		respondWebhookError(c, err, "创建 Webhook 失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookResponse(webhook, true))
+}
+
+// 修改 Webhook，secret 为空时保留原密钥
+func HandleUpdateWebhook(c *gin.Context) {
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+	if err := validateWebhookRequest(&req); err != nil {
+		respondWebhookError(c, err, "修改 Webhook 失败")
+		return
+	}
+
+	var updated models.Webhook
+	err := repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		webhook := findWebhook(data, c.Param("id"))
+		if webhook == nil {
+			return errWebhookNotFound
+		}
+		webhook.URL = req.URL
+		webhook.Events = req.Events
+		if req.Secret != "" {
+			webhook.Secret = req.Secret
+		}
+		if req.Active != nil {
+			webhook.Active = *req.Active
+		}
+		webhook.UpdatedAt = time.Now()
+		updated = *webhook
+		return nil
+	})
+	if err != nil {
+		respondWebhookError(c, err, "修改 Webhook 失败")
+		return
+	}
+
+	// 重新启用后尽快发送积压的投递
+	wakeWebhookDeliveries()
+	c.JSON(http.StatusOK, webhookResponse(updated, false))
+}
+
+// 删除 Webhook 及其投递记录，未完成的投递不再发送
+func HandleDeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	err := repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		if findWebhook(data, id) == nil {
+			return errWebhookNotFound
+		}
+		webhooks := data.Webhooks[:0]
+		for _, webhook := range data.Webhooks {
+			if webhook.ID != id {
+				webhooks = append(webhooks, webhook)
+			}
+		}
+		data.Webhooks = webhooks
+		deliveries := data.Deliveries[:0]
+		for _, delivery := range data.Deliveries {
+			if delivery.WebhookID != id {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		data.Deliveries = deliveries
+		return nil
+	})
+	if err != nil {
+		respondWebhookError(c, err, "删除 Webhook 失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook 已删除"})
+}
+
+// 获取 Webhook 的投递记录，按创建时间倒序，可以按 status 过滤
+func HandleGetWebhookDeliveries(c *gin.Context) {
+	data, err := repository.Webhooks.Read()
+	if err != nil {
+		utils.Logger.Printf("读取 Webhook 数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+	id := c.Param("id")
+	if findWebhook(&data, id) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errWebhookNotFound.Error()})
+		return
+	}
+
+	status := c.Query("status")
+	deliveries := []models.WebhookDelivery{}
+	for i := len(data.Deliveries) - 1; i >= 0; i-- {
+		delivery := data.Deliveries[i]
+		if delivery.WebhookID == id && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// 立即向 Webhook 发送一个测试事件并返回投递结果，失败时与普通投递一样稍后重试
+func HandleTestWebhook(c *gin.Context) {
+	event := events.Event{
+		ID:   "test-" + uuid.New().String(),
+		Type: webhookTestEvent,
+		Time: time.Now(),
+		Data: gin.H{"message": "这是一条测试消息"},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		respondWebhookError(c, err, "发送测试事件失败")
+		return
+	}
+
+	var webhook models.Webhook
+	var delivery models.WebhookDelivery
+	err = repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		found := findWebhook(data, c.Param("id"))
+		if found == nil {
+			return errWebhookNotFound
+		}
+		webhook = *found
+		delivery = newWebhookDelivery(webhook.ID, event, payload)
+		// 由当前请求发送，不交给投递协程
+		delivery.NextAttempt = nil
+		data.Deliveries = append(data.Deliveries, delivery)
+		return nil
+	})
+	if err != nil {
+		respondWebhookError(c, err, "发送测试事件失败")
+		return
+	}
+
+	attempt := sendWebhook(webhook, delivery)
+	delivery, err = recordDeliveryAttempt(delivery.ID, attempt)
+	if err != nil {
+		respondWebhookError(c, err, "发送测试事件失败")
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// 启动 Webhook 投递：订阅内容变化事件写入投递队列，并在后台发送到期的投递。
+// 队列保存在数据文件中，重启后继续发送未完成的投递
+func StartWebhookDispatcher() {
+	go consumeWebhookEvents()
+	go runWebhookDeliveries()
+}
+
+func consumeWebhookEvents() {
+	lastID := ""
+	for {
+		sub := events.Default.Subscribe(nil, lastID)
+		if !sub.Complete {
+			utils.Logger.Printf("Webhook 队列处理太慢，%s 之后的部分事件未能投递", lastID)
+		}
+		for _, event := range sub.Replay {
+			enqueueWebhookEvent(event)
+			lastID = event.ID
+		}
+		for event := range sub.C {
+			enqueueWebhookEvent(event)
+			lastID = event.ID
+		}
+		// 通道关闭说明处理不及时被断开，从最后处理的事件继续订阅
+	}
+}
+
+// 为订阅了该事件的每个 Webhook 创建投递
+func enqueueWebhookEvent(event events.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		utils.Logger.Printf("序列化事件失败 %s: %v", event.ID, err)
+		return
+	}
+
+	added := 0
+	err = repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		for _, webhook := range data.Webhooks {
+			if webhook.Active && events.Filter(webhook.Events).Match(event.Type) {
+				data.Deliveries = append(data.Deliveries, newWebhookDelivery(webhook.ID, event, payload))
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Logger.Printf("写入 Webhook 投递队列失败 %s: %v", event.ID, err)
+		return
+	}
+	if added > 0 {
+		wakeWebhookDeliveries()
+	}
+}
+
+func newWebhookDelivery(webhookID string, event events.Event, payload []byte) models.WebhookDelivery {
+	now := time.Now()
+	return models.WebhookDelivery{
+		ID:          uuid.New().String(),
+		WebhookID:   webhookID,
+		EventID:     event.ID,
+		EventType:   event.Type,
+		Payload:     payload,
+		Status:      models.DeliveryPending,
+		Attempts:    []models.DeliveryAttempt{},
+		NextAttempt: &now,
+		CreatedAt:   now,
+	}
+}
+
+func wakeWebhookDeliveries() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// 没有待发送的投递时最长等待多久再检查一次
+const webhookIdleInterval = time.Minute
+
+func runWebhookDeliveries() {
+	timer := time.NewTimer(0)
+	for {
+		select {
+		case <-timer.C:
+		case <-webhookWake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+
+		wait := webhookIdleInterval
+		if next, ok := sendDueDeliveries(); ok {
+			if d := time.Until(next); d < wait {
+				wait = d
+			}
+		}
+		if wait < 0 {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
+
+// 同时发送投递的 Webhook 数量，同一 Webhook 的投递依次发送
+const webhookWorkers = 4
+
+// 连续发送时每发送这么多个投递写入一次结果
+const webhookRecordBatch = 20
+
+// 发送所有到期的投递，返回下一个投递的到期时间
+func sendDueDeliveries() (time.Time, bool) {
+	data, err := repository.Webhooks.Read()
+	if err != nil {
+		utils.Logger.Printf("读取 Webhook 数据失败: %v", err)
+		return time.Now().Add(webhookIdleInterval), true
+	}
+
+	now := time.Now()
+	var order []string
+	due := make(map[string][]models.WebhookDelivery)
+	for _, delivery := range data.Deliveries {
+		if delivery.Status != models.DeliveryPending || delivery.NextAttempt == nil || delivery.NextAttempt.After(now) {
+			continue
+		}
+		webhook := findWebhook(&data, delivery.WebhookID)
+		if webhook == nil || !webhook.Active {
+			// 停用期间的投递保留在队列中，重新启用后发送
+			continue
+		}
+		if _, ok := due[webhook.ID]; !ok {
+			order = append(order, webhook.ID)
+		}
+		due[webhook.ID] = append(due[webhook.ID], delivery)
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < webhookWorkers && i < len(order); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				sendWebhookDeliveries(*findWebhook(&data, id), due[id])
+			}
+		}()
+	}
+	for _, id := range order {
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
+
+	if data, err = repository.Webhooks.Read(); err != nil {
+		return time.Time{}, false
+	}
+	var next time.Time
+	for _, delivery := range data.Deliveries {
+		if delivery.Status != models.DeliveryPending || delivery.NextAttempt == nil {
+			continue
+		}
+		if webhook := findWebhook(&data, delivery.WebhookID); webhook == nil || !webhook.Active {
+			continue
+		}
+		if next.IsZero() || delivery.NextAttempt.Before(next) {
+			next = *delivery.NextAttempt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// 依次发送同一 Webhook 的投递，结果分批写入。
+// 发送失败说明接收方暂时不可用，其余投递不再发送，推迟到失败的投递重试时
+func sendWebhookDeliveries(webhook models.Webhook, deliveries []models.WebhookDelivery) {
+	attempts := make(map[string]models.DeliveryAttempt)
+	record := func(postponed []string) {
+		if _, err := recordDeliveryAttempts(attempts, postponed); err != nil {
+			utils.Logger.Printf("记录 Webhook %s 的投递结果失败: %v", webhook.ID, err)
+		}
+		attempts = make(map[string]models.DeliveryAttempt)
+	}
+
+	for i, delivery := range deliveries {
+		attempt := sendWebhook(webhook, delivery)
+		attempts[delivery.ID] = attempt
+		if attempt.Error != "" {
+			var postponed []string
+			for _, rest := range deliveries[i+1:] {
+				postponed = append(postponed, rest.ID)
+			}
+			record(postponed)
+			return
+		}
+		if len(attempts) >= webhookRecordBatch {
+			record(nil)
+		}
+	}
+	if len(attempts) > 0 {
+		record(nil)
+	}
+}
+
+// 发送一次投递。请求体为事件 JSON，签名为
+// HMAC-SHA256(secret, 时间戳 + "." + 请求体)，接收方应同时校验时间戳防止重放
+func sendWebhook(webhook models.Webhook, delivery models.WebhookDelivery) models.DeliveryAttempt {
+	start := time.Now()
+	attempt := models.DeliveryAttempt{At: start}
+
+	// 数据文件以缩进格式保存，发送前还原为紧凑格式
+	var body bytes.Buffer
+	if err := json.Compact(&body, delivery.Payload); err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(webhook.Secret, timestamp, body.Bytes()))
+
+	client := &http.Client{Timeout: config.WebhookTimeout}
+	resp, err := client.Do(req)
+	attempt.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = resp.Status
+	}
+	return attempt
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 校验 Webhook 签名，signature 为 X-Webhook-Signature 请求头的值，供接收方使用
+func VerifyWebhookSignature(secret, timestamp, signature string, body []byte) bool {
+	expected := "sha256=" + signWebhook(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// 记录发送结果：成功或达到最多尝试次数时结束投递，否则按指数退避安排重试
+func recordDeliveryAttempt(id string, attempt models.DeliveryAttempt) (models.WebhookDelivery, error) {
+	results, err := recordDeliveryAttempts(map[string]models.DeliveryAttempt{id: attempt}, nil)
+	return results[id], err
+}
+
+// 一次写入多个投递的发送结果，postponed 中仍未完成的投递推迟到这批投递中最晚的重试时间。
+// 投递都已不存在（Webhook 被删除）时返回 errWebhookNotFound
+func recordDeliveryAttempts(attempts map[string]models.DeliveryAttempt, postponed []string) (map[string]models.WebhookDelivery, error) {
+	results := make(map[string]models.WebhookDelivery, len(attempts))
+	err := repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		completed := make(map[string]bool)
+		until := time.Now().Add(webhookRetryDelay(1))
+		for i := range data.Deliveries {
+			delivery := &data.Deliveries[i]
+			attempt, ok := attempts[delivery.ID]
+			if !ok {
+				continue
+			}
+
+			delivery.Attempts = append(delivery.Attempts, attempt)
+			delivery.NextAttempt = nil
+			switch {
+			case attempt.Error == "":
+				delivery.Status = models.DeliverySucceeded
+			case len(delivery.Attempts) >= config.WebhookMaxAttempts:
+				delivery.Status = models.DeliveryFailed
+			default:
+				next := time.Now().Add(webhookRetryDelay(len(delivery.Attempts)))
+				delivery.NextAttempt = &next
+				if next.After(until) {
+					until = next
+				}
+			}
+			results[delivery.ID] = *delivery
+			if delivery.Status != models.DeliveryPending {
+				completed[delivery.WebhookID] = true
+			}
+		}
+		if len(results) == 0 {
+			return errWebhookNotFound
+		}
+
+		deferred := make(map[string]bool, len(postponed))
+		for _, id := range postponed {
+			deferred[id] = true
+		}
+		for i := range data.Deliveries {
+			delivery := &data.Deliveries[i]
+			if deferred[delivery.ID] && delivery.Status == models.DeliveryPending && delivery.NextAttempt != nil && delivery.NextAttempt.Before(until) {
+				delivery.NextAttempt = &until
+			}
+		}
+
+		for webhookID := range completed {
+			trimWebhookDeliveries(data, webhookID)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// 第 n 次失败后的等待时间
+func webhookRetryDelay(failures int) time.Duration {
+	delay := config.WebhookRetryBase
+	for i := 1; i < failures && delay < config.WebhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > config.WebhookRetryMax {
+		delay = config.WebhookRetryMax
+	}
+	return delay
+}
+
+// 每个 Webhook 只保留最近的已完成投递，未完成的投递不受影响
+func trimWebhookDeliveries(data *models.WebhooksData, webhookID string) {
+	completed := 0
+	for _, delivery := range data.Deliveries {
+		if delivery.WebhookID == webhookID && delivery.Status != models.DeliveryPending {
+			completed++
+		}
+	}
+	if completed <= config.WebhookLogSize {
+		return
+	}
+
+	drop := completed - config.WebhookLogSize
+	deliveries := data.Deliveries[:0]
+	for _, delivery := range data.Deliveries {
+		if drop > 0 && delivery.WebhookID == webhookID && delivery.Status != models.DeliveryPending {
+			drop--
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	data.Deliveries = deliveries
+}
+
+func findWebhook(data *models.WebhooksData, id string) *models.Webhook {
+	for i := range data.Webhooks {
+		if data.Webhooks[i].ID == id {
+			return &data.Webhooks[i]
+		}
+	}
+	return nil
+}
+
+// 校验地址和事件类型，去掉重复的事件类型
+func validateWebhookRequest(req *models.WebhookRequest) error {
+	req.URL = strings.TrimSpace(req.URL)
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return webhookRequestError("Webhook 地址必须是 http 或 https 地址")
+	}
+
+	seen := make(map[string]bool, len(req.Events))
+	eventTypes := []string{}
+	for _, pattern := range req.Events {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || seen[pattern] {
+			continue
+		}
+		if !knownEventPattern(pattern) {
+			return webhookRequestError("未知的事件类型: " + pattern)
+		}
+		seen[pattern] = true
+		eventTypes = append(eventTypes, pattern)
+	}
+	sort.Strings(eventTypes)
+	req.Events = eventTypes
+	return nil
+}
+
+func generateWebhookSecret() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return uuid.New().String()
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Webhook 的接口输出格式，withSecret 为 false 时只返回密钥末尾几位
+func webhookResponse(webhook models.Webhook, withSecret bool) gin.H {
+	secret := webhook.Secret
+	if !withSecret {
+		masked := strings.Repeat("*", 8)
+		if len(secret) > 8 {
+			masked += secret[len(secret)-4:]
+		}
+		secret = masked
+	}
+	return gin.H{
+		"id":         webhook.ID,
+		"url":        webhook.URL,
+		"events":     webhook.Events,
+		"secret":     secret,
+		"active":     webhook.Active,
+		"created_at": webhook.CreatedAt,
+		"updated_at": webhook.UpdatedAt,
+	}
+}
+
+// 请求不合法时返回 400，Webhook 不存在时返回 404，其他错误记录日志后返回 500
+func respondWebhookError(c *gin.Context, err error, message string) {
+	var reqErr webhookRequestError
+	switch {
+	case errors.As(err, &reqErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": reqErr.Error()})
+	case errors.Is(err, errWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		utils.Logger.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
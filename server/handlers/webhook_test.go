@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"server/config"
+	"server/events"
+	"server/models"
+	"server/repository"
+)
+
+// 使用临时的数据文件和较小的重试配置
+func setupWebhookTest(t *testing.T) {
+	t.Helper()
+	oldFile := repository.Webhooks
+	oldTimeout, oldBase, oldMax := config.WebhookTimeout, config.WebhookRetryBase, config.WebhookRetryMax
+	oldAttempts, oldLogSize := config.WebhookMaxAttempts, config.WebhookLogSize
+	t.Cleanup(func() {
+		repository.Webhooks = oldFile
+		config.WebhookTimeout, config.WebhookRetryBase, config.WebhookRetryMax = oldTimeout, oldBase, oldMax
+		config.WebhookMaxAttempts, config.WebhookLogSize = oldAttempts, oldLogSize
+	})
+
+	repository.Webhooks = repository.NewJSONFile(filepath.Join(t.TempDir(), "webhooks.json"), func() models.WebhooksData {
+		return models.WebhooksData{Webhooks: []models.Webhook{}, Deliveries: []models.WebhookDelivery{}}
+	})
+	config.WebhookTimeout = 5 * time.Second
+	config.WebhookRetryBase = time.Second
+	config.WebhookRetryMax = 4 * time.Second
+	config.WebhookMaxAttempts = 3
+	config.WebhookLogSize = 2
+}
+
+// 接收 Webhook 的本地服务，按 statuses 的顺序返回状态码，用完后返回 204
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	r := &webhookReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body})
+		status := http.StatusNoContent
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// 写入一个 Webhook 和一个待发送的投递
+func addTestDelivery(t *testing.T, url string) (models.Webhook, models.WebhookDelivery) {
+	t.Helper()
+	webhook := models.Webhook{ID: "hook", URL: url, Secret: "s3cret", Active: true}
+	event := events.Event{ID: "1", Type: events.PostCreated, Time: time.Now(), Data: map[string]string{"id": "a"}}
+	payload, err := json.MarshalIndent(event, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := newWebhookDelivery(webhook.ID, event, payload)
+	err = repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		if findWebhook(data, webhook.ID) == nil {
+			data.Webhooks = append(data.Webhooks, webhook)
+		}
+		data.Deliveries = append(data.Deliveries, delivery)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhook, delivery
+}
+
+func TestSendWebhookSignature(t *testing.T) {
+	setupWebhookTest(t)
+	receiver := newWebhookReceiver(t)
+	webhook, delivery := addTestDelivery(t, receiver.URL)
+
+	attempt := sendWebhook(webhook, delivery)
+	if attempt.Error != "" || attempt.StatusCode != http.StatusNoContent {
+		t.Fatalf("sendWebhook = %+v", attempt)
+	}
+	if len(receiver.requests) != 1 {
+		t.Fatalf("收到 %d 个请求", len(receiver.requests))
+	}
+	got := receiver.requests[0]
+	if got.header.Get("X-Webhook-Id") != delivery.ID || got.header.Get("X-Webhook-Event") != events.PostCreated {
+		t.Errorf("请求头不正确: %v", got.header)
+	}
+	if !json.Valid(got.body) || len(got.body) >= len(delivery.Payload) {
+		t.Errorf("请求体应为紧凑格式的 JSON: %s", got.body)
+	}
+
+	timestamp, signature := got.header.Get("X-Webhook-Timestamp"), got.header.Get("X-Webhook-Signature")
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		want      bool
+	}{
+		{"正确的签名", webhook.Secret, timestamp, got.body, true},
+		{"密钥不同", "other", timestamp, got.body, false},
+		{"时间戳被修改", webhook.Secret, timestamp + "1", got.body, false},
+		{"请求体被修改", webhook.Secret, timestamp, append(got.body[:len(got.body):len(got.body)], ' '), false},
+	}
+	for _, tt := range tests {
+		if ok := VerifyWebhookSignature(tt.secret, tt.timestamp, signature, tt.body); ok != tt.want {
+			t.Errorf("%s: VerifyWebhookSignature = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	setupWebhookTest(t)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 4 * time.Second},
+		{50, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := webhookRetryDelay(tt.failures); got != tt.want {
+			t.Errorf("webhookRetryDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRecordDeliveryAttemptRetries(t *testing.T) {
+	setupWebhookTest(t)
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	webhook, delivery := addTestDelivery(t, receiver.URL)
+
+	for i, wantDelay := range []time.Duration{time.Second, 2 * time.Second} {
+		before := time.Now()
+		result, err := recordDeliveryAttempt(delivery.ID, sendWebhook(webhook, delivery))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != models.DeliveryPending || len(result.Attempts) != i+1 || result.NextAttempt == nil {
+			t.Fatalf("第 %d 次失败后: %+v", i+1, result)
+		}
+		if d := result.NextAttempt.Sub(before); d < wantDelay || d > wantDelay+time.Second {
+			t.Errorf("第 %d 次失败后 %v 后重试, want %v", i+1, d, wantDelay)
+		}
+	}
+
+	result, err := recordDeliveryAttempt(delivery.ID, sendWebhook(webhook, delivery))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != models.DeliverySucceeded || result.NextAttempt != nil || len(result.Attempts) != 3 {
+		t.Errorf("成功后: %+v", result)
+	}
+	if codes := []int{result.Attempts[0].StatusCode, result.Attempts[1].StatusCode}; codes[0] != 500 || codes[1] != 502 {
+		t.Errorf("记录的状态码 = %v", codes)
+	}
+}
+
+func TestRecordDeliveryAttemptFailsAfterMaxAttempts(t *testing.T) {
+	setupWebhookTest(t)
+	receiver := newWebhookReceiver(t, 500, 500, 500, 500)
+	webhook, delivery := addTestDelivery(t, receiver.URL)
+
+	var result models.WebhookDelivery
+	for i := 0; i < config.WebhookMaxAttempts; i++ {
+		var err error
+		if result, err = recordDeliveryAttempt(delivery.ID, sendWebhook(webhook, delivery)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.Status != models.DeliveryFailed || result.NextAttempt != nil || len(result.Attempts) != config.WebhookMaxAttempts {
+		t.Errorf("达到最多尝试次数后: %+v", result)
+	}
+
+	// 无法连接时同样记录为失败的尝试
+	receiver.Close()
+	_, delivery = addTestDelivery(t, receiver.URL)
+	attempt := sendWebhook(webhook, delivery)
+	if attempt.Error == "" || attempt.StatusCode != 0 {
+		t.Errorf("无法连接时 = %+v", attempt)
+	}
+
+	if _, err := recordDeliveryAttempt("missing", attempt); !errors.Is(err, errWebhookNotFound) {
+		t.Errorf("投递不存在时 err = %v", err)
+	}
+}
+
+func TestTrimWebhookDeliveries(t *testing.T) {
+	setupWebhookTest(t)
+	delivery := func(id, webhookID, status string) models.WebhookDelivery {
+		return models.WebhookDelivery{ID: id, WebhookID: webhookID, Status: status}
+	}
+	tests := []struct {
+		name       string
+		deliveries []models.WebhookDelivery
+		want       []string
+	}{
+		{
+			name: "未超过保留数量",
+			deliveries: []models.WebhookDelivery{
+				delivery("1", "a", models.DeliverySucceeded),
+				delivery("2", "a", models.DeliveryFailed),
+			},
+			want: []string{"1", "2"},
+		},
+		{
+			name: "删除最早的已完成投递",
+			deliveries: []models.WebhookDelivery{
+				delivery("1", "a", models.DeliverySucceeded),
+				delivery("2", "a", models.DeliveryPending),
+				delivery("3", "a", models.DeliveryFailed),
+				delivery("4", "a", models.DeliverySucceeded),
+				delivery("5", "a", models.DeliverySucceeded),
+			},
+			want: []string{"2", "4", "5"},
+		},
+		{
+			name: "其他 Webhook 的投递不受影响",
+			deliveries: []models.WebhookDelivery{
+				delivery("1", "b", models.DeliverySucceeded),
+				delivery("2", "a", models.DeliverySucceeded),
+				delivery("3", "b", models.DeliverySucceeded),
+				delivery("4", "a", models.DeliverySucceeded),
+				delivery("5", "b", models.DeliverySucceeded),
+				delivery("6", "a", models.DeliverySucceeded),
+			},
+			want: []string{"1", "3", "4", "5", "6"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := models.WebhooksData{Deliveries: tt.deliveries}
+			trimWebhookDeliveries(&data, "a")
+			var got []string
+			for _, d := range data.Deliveries {
+				got = append(got, d.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("保留 %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("保留 %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSendWebhookDeliveriesPostponesAfterFailure(t *testing.T) {
+	setupWebhookTest(t)
+	receiver := newWebhookReceiver(t, http.StatusServiceUnavailable)
+	webhook, first := addTestDelivery(t, receiver.URL)
+	_, second := addTestDelivery(t, receiver.URL)
+	_, third := addTestDelivery(t, receiver.URL)
+
+	sendWebhookDeliveries(webhook, []models.WebhookDelivery{first, second, third})
+	if len(receiver.requests) != 1 {
+		t.Fatalf("接收方出错后仍发送了 %d 个请求", len(receiver.requests))
+	}
+
+	data, err := repository.Webhooks.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := data.Deliveries[0]
+	if len(failed.Attempts) != 1 || failed.NextAttempt == nil {
+		t.Fatalf("失败的投递: %+v", failed)
+	}
+	for _, delivery := range data.Deliveries[1:] {
+		if len(delivery.Attempts) != 0 || delivery.Status != models.DeliveryPending {
+			t.Errorf("推迟的投递不应记录尝试: %+v", delivery)
+		}
+		if delivery.NextAttempt == nil || delivery.NextAttempt.Before(*failed.NextAttempt) {
+			t.Errorf("推迟的投递 %v 早于失败投递的重试时间 %v", delivery.NextAttempt, failed.NextAttempt)
+		}
+	}
+}
+
+func TestSendDueDeliveriesBoundsConcurrency(t *testing.T) {
+	setupWebhookTest(t)
+	var mu sync.Mutex
+	inFlight, peak, total := 0, 0, 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		total++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	webhooks := webhookWorkers * 2
+	perWebhook := 3
+	event := events.Event{ID: "1", Type: events.PostCreated, Time: time.Now()}
+	err := repository.Webhooks.Update(func(data *models.WebhooksData) error {
+		for i := 0; i < webhooks; i++ {
+			webhook := models.Webhook{ID: "hook-" + string(rune('a'+i)), URL: receiver.URL, Secret: "s", Active: true}
+			data.Webhooks = append(data.Webhooks, webhook)
+			for j := 0; j < perWebhook; j++ {
+				data.Deliveries = append(data.Deliveries, newWebhookDelivery(webhook.ID, event, []byte(`{}`)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, pending := sendDueDeliveries(); pending {
+		t.Error("所有投递成功后不应还有待发送的投递")
+	}
+	if total != webhooks*perWebhook {
+		t.Errorf("发送了 %d 个请求, want %d", total, webhooks*perWebhook)
+	}
+	if peak > webhookWorkers {
+		t.Errorf("同时发送 %d 个请求, 上限为 %d", peak, webhookWorkers)
+	}
+	data, err := repository.Webhooks.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delivery := range data.Deliveries {
+		if delivery.Status != models.DeliverySucceeded {
+			t.Errorf("投递 %s 状态为 %s", delivery.ID, delivery.Status)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// 水印位置
+const (
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionCenter      = "center"
+	PositionTile        = "tile"
+)
+
+var ErrEmptyWatermark = errors.New("水印文字和图片不能同时为空")
+
+// 水印参数，Overlay 不为空时使用图片水印，否则使用文字水印
+type Watermark struct {
+	Text     string
+	Font     *opentype.Font
+	Overlay  image.Image
+	Position string
+	// 不透明度，0-1
+	Opacity float64
+	// 水印宽度占图片宽度的比例
+	Scale float64
+}
+
+// 在图片上叠加水印，返回新的图片
+func (w Watermark) Apply(img image.Image) (*image.NRGBA, error) {
+	dst := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	width, height := dst.Rect.Dx(), dst.Rect.Dy()
+	markWidth := int(math.Round(float64(width) * w.Scale))
+	if markWidth < 1 {
+		markWidth = 1
+	}
+
+	var mark image.Image
+	var err error
+	switch {
+	case w.Overlay != nil:
+		mark = scaleToWidth(w.Overlay, markWidth)
+	case w.Text != "":
+		mark, err = w.renderText(markWidth)
+	default:
+		err = ErrEmptyWatermark
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(clamp01(w.Opacity) * 255))})
+	mb := mark.Bounds()
+	margin := int(math.Round(float64(minInt(width, height)) * 0.02))
+
+	if w.Position == PositionTile {
+		// 平铺时错行排列，水印之间留出与水印等大的间距
+		stepX, stepY := mb.Dx()*2, mb.Dy()*3
+		for row, y := 0, margin; y < height; row, y = row+1, y+stepY {
+			offset := (row % 2) * mb.Dx()
+			for x := margin - offset; x < width; x += stepX {
+				draw.DrawMask(dst, image.Rect(x, y, x+mb.Dx(), y+mb.Dy()), mark, mb.Min, mask, image.Point{}, draw.Over)
+			}
+		}
+		return dst, nil
+	}
+
+	var x, y int
+	switch w.Position {
+	case PositionTopLeft:
+		x, y = margin, margin
+	case PositionTopRight:
+		x, y = width-mb.Dx()-margin, margin
+	case PositionBottomLeft:
+		x, y = margin, height-mb.Dy()-margin
+	case PositionCenter:
+		x, y = (width-mb.Dx())/2, (height-mb.Dy())/2
+	default:
+		x, y = width-mb.Dx()-margin, height-mb.Dy()-margin
+	}
+	draw.DrawMask(dst, image.Rect(x, y, x+mb.Dx(), y+mb.Dy()), mark, mb.Min, mask, image.Point{}, draw.Over)
+	return dst, nil
+}
+
+// 按目标宽度计算字号后绘制白色文字，并加上深色阴影，浅色背景上也能看清
+func (w Watermark) renderText(targetWidth int) (image.Image, error) {
+	const refSize = 100.0
+	ref, err := opentype.NewFace(w.Font, &opentype.FaceOptions{Size: refSize, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	advance := font.MeasureString(ref, w.Text)
+	ref.Close()
+	if advance <= 0 {
+		return nil, ErrEmptyWatermark
+	}
+
+	size := refSize * float64(targetWidth) / (float64(advance) / 64)
+	face, err := opentype.NewFace(w.Font, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	shadow := int(math.Ceil(size / 24))
+	textWidth := font.MeasureString(face, w.Text).Ceil()
+	textHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	mark := image.NewNRGBA(image.Rect(0, 0, textWidth+shadow, textHeight+shadow))
+
+	drawer := &font.Drawer{
+		Dst:  mark,
+		Src:  image.NewUniform(color.NRGBA{A: 160}),
+		Face: face,
+		Dot:  fixed.P(shadow, metrics.Ascent.Ceil()+shadow),
+	}
+	drawer.DrawString(w.Text)
+	drawer.Src = image.White
+	drawer.Dot = fixed.P(0, metrics.Ascent.Ceil())
+	drawer.DrawString(w.Text)
+	return mark, nil
+}
+
+func scaleToWidth(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	height := int(math.Round(float64(b.Dy()) * float64(width) / float64(b.Dx())))
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Over, nil)
+	return dst
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,293 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 模板标签的转换函数，ok 为 false 时保留原标签并记录在报告中
+type tagHandler func(args string) (replacement string, ok bool)
+
+var (
+	liquidBlockRegex  = regexp.MustCompile(`(?s)\{%-?\s*(highlight|codeblock|raw)\b\s*(.*?)\s*-?%\}\n?(.*?)\{%-?\s*end(highlight|codeblock|raw)\s*-?%\}`)
+	liquidTagRegex    = regexp.MustCompile(`\{%-?\s*(\w+)\s*(.*?)\s*-?%\}`)
+	liquidOutputRegex = regexp.MustCompile(`\{\{-?\s*(.*?)\s*-?\}\}`)
+
+	shortcodeBlockRegex = regexp.MustCompile(`(?s)\{\{[<%]\s*highlight\s+(.*?)\s*[>%]\}\}\n?(.*?)\{\{[<%]\s*/highlight\s*[>%]\}\}`)
+	shortcodeRegex      = regexp.MustCompile(`\{\{[<%]\s*(/?[\w.-]+)\s*(.*?)\s*[>%]\}\}`)
+)
+
+// 转换 Hexo 和 Jekyll 文章中的 Liquid/Nunjucks 标签：代码块转为 markdown 代码块，
+// 其他标签交给 tags 处理，outputs 处理 {{ }} 输出
+func convertLiquid(src *sourcePost, tags map[string]tagHandler, output tagHandler) {
+	var protected []string
+	protect := func(s string) string {
+		protected = append(protected, s)
+		return fmt.Sprintf("\x00%d\x00", len(protected)-1)
+	}
+
+	content := liquidBlockRegex.ReplaceAllStringFunc(src.content, func(block string) string {
+		m := liquidBlockRegex.FindStringSubmatch(block)
+		if m[1] != m[4] {
+			return block
+		}
+		if m[1] == "raw" {
+			return protect(m[3])
+		}
+		return protect(codeFence(firstArg(m[2]), m[3]))
+	})
+	content = protectCode(content, protect)
+
+	unknown := map[string]bool{}
+	content = liquidTagRegex.ReplaceAllStringFunc(content, func(tag string) string {
+		m := liquidTagRegex.FindStringSubmatch(tag)
+		if handler, ok := tags[m[1]]; ok {
+			if replacement, ok := handler(m[2]); ok {
+				return replacement
+			}
+		}
+		if !unknown[tag] {
+			unknown[tag] = true
+			src.warn("未转换的标签: %s", tag)
+		}
+		return tag
+	})
+	content = liquidOutputRegex.ReplaceAllStringFunc(content, func(tag string) string {
+		m := liquidOutputRegex.FindStringSubmatch(tag)
+		if output != nil {
+			if replacement, ok := output(m[1]); ok {
+				return replacement
+			}
+		}
+		if !unknown[tag] {
+			unknown[tag] = true
+			src.warn("未转换的模板输出: %s", tag)
+		}
+		return tag
+	})
+
+	src.content = restore(content, protected)
+}
+
+// 转换 Hugo 文章中的 shortcode：highlight 转为代码块，其他交给 shortcodes 处理
+func convertShortcodes(src *sourcePost, shortcodes map[string]tagHandler) {
+	var protected []string
+	content := shortcodeBlockRegex.ReplaceAllStringFunc(src.content, func(block string) string {
+		m := shortcodeBlockRegex.FindStringSubmatch(block)
+		protected = append(protected, codeFence(firstArg(m[1]), m[2]))
+		return fmt.Sprintf("\x00%d\x00", len(protected)-1)
+	})
+
+	unknown := map[string]bool{}
+	content = shortcodeRegex.ReplaceAllStringFunc(content, func(code string) string {
+		m := shortcodeRegex.FindStringSubmatch(code)
+		if handler, ok := shortcodes[m[1]]; ok {
+			if replacement, ok := handler(m[2]); ok {
+				return replacement
+			}
+		}
+		if !unknown[code] {
+			unknown[code] = true
+			src.warn("未转换的 shortcode: %s", code)
+		}
+		return code
+	})
+
+	// {{</* name */>}} 是转义写法，输出为原样的 shortcode
+	content = strings.NewReplacer("{{</*", "{{<", "*/>}}", ">}}", "{{%/*", "{{%", "*/%}}", "%}}").Replace(content)
+	src.content = restore(content, protected)
+}
+
+var inlineCodeRegex = regexp.MustCompile("`[^`\n]+`")
+
+// 代码块和行内代码中的内容不是模板标签
+func protectCode(content string, protect func(string) string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var b strings.Builder
+	for i := 0; i < len(lines); i++ {
+		fence := codeFenceMarker(lines[i])
+		if fence == "" {
+			b.WriteString(inlineCodeRegex.ReplaceAllStringFunc(lines[i], protect))
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), fence) {
+			end++
+		}
+		if end == len(lines) {
+			end--
+		}
+		block := strings.Join(lines[i:end+1], "")
+		trailing := ""
+		if strings.HasSuffix(block, "\n") {
+			block, trailing = block[:len(block)-1], "\n"
+		}
+		b.WriteString(protect(block) + trailing)
+		i = end
+	}
+	return b.String()
+}
+
+func codeFenceMarker(line string) string {
+	line = strings.TrimSpace(line)
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return strings.Repeat(c, n)
+		}
+	}
+	return ""
+}
+
+func restore(content string, protected []string) string {
+	for i, s := range protected {
+		content = strings.Replace(content, fmt.Sprintf("\x00%d\x00", i), s, 1)
+	}
+	return content
+}
+
+func codeFence(lang, code string) string {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(code, "\n") + "\n" + fence
+}
+
+// 代码块标签的第一个参数是语言，Hexo 的 codeblock 也可以写成 lang:xxx
+func firstArg(args string) string {
+	for _, arg := range splitArgs(args) {
+		if strings.HasPrefix(arg, "lang:") {
+			return strings.TrimPrefix(arg, "lang:")
+		}
+	}
+	if fields := splitArgs(args); len(fields) > 0 && !strings.Contains(fields[0], ":") && !strings.Contains(fields[0], "=") {
+		return fields[0]
+	}
+	return ""
+}
+
+// 按空白拆分参数，引号中的空白不拆分，引号会被去掉；引号中的 \" 表示引号本身
+func splitArgs(args string) []string {
+	var result []string
+	var current strings.Builder
+	var quote rune
+	inArg, escaped := false, false
+	for _, r := range args {
+		switch {
+		case escaped:
+			if r != quote {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			switch r {
+			case quote:
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				result = append(result, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inArg {
+		result = append(result, current.String())
+	}
+	return result
+}
+
+// shortcode 的参数，key="value" 形式放入 named，其余按顺序放入 positional
+func shortcodeArgs(args string) (positional []string, named map[string]string) {
+	named = map[string]string{}
+	for _, arg := range splitArgs(args) {
+		if key, value, ok := strings.Cut(arg, "="); ok && key != "" && !strings.ContainsAny(key, "/.") {
+			named[key] = value
+			continue
+		}
+		positional = append(positional, arg)
+	}
+	return positional, named
+}
+
+func markdownImage(alt, src, title string) string {
+	if title != "" {
+		return fmt.Sprintf("![%s](%s \"%s\")", alt, src, strings.ReplaceAll(title, `"`, `'`))
+	}
+	return fmt.Sprintf("![%s](%s)", alt, src)
+}
+
+// 把标题等转换成地址中使用的形式：空白和标点替换为 -，保留各种语言的文字
+func slugize(s string, lower bool) string {
+	if lower {
+		s = strings.ToLower(s)
+	}
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.TrimSpace(s) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// 展开固定链接模板中的 :name 变量，未知变量保持不变
+var permalinkVarRegex = regexp.MustCompile(`:[a-z_]+`)
+
+func expandPermalink(pattern string, vars map[string]string) string {
+	path := permalinkVarRegex.ReplaceAllStringFunc(pattern, func(name string) string {
+		if value, ok := vars[name[1:]]; ok {
+			return value
+		}
+		return name
+	})
+	return cleanURLPath(path)
+}
+
+// 合并重复的 /，保证以 / 开头，保留末尾的 /
+func cleanURLPath(path string) string {
+	path = "/" + path
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	return path
+}
+
+// 固定链接模板中通用的日期变量，t 为旧站点时区的文章日期
+func dateVars(vars map[string]string, t time.Time) {
+	vars["year"] = t.Format("2006")
+	vars["short_year"] = t.Format("06")
+	vars["month"] = t.Format("01")
+	vars["i_month"] = t.Format("1")
+	vars["day"] = t.Format("02")
+	vars["i_day"] = t.Format("2")
+	vars["hour"] = t.Format("15")
+	vars["minute"] = t.Format("04")
+	vars["second"] = t.Format("05")
+}
@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertLiquid(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     map[string]tagHandler
+		output   tagHandler
+		in       string
+		want     string
+		warnings []string
+	}{
+		{
+			name: "highlight 代码块",
+			in:   "前\n{% highlight ruby linenos %}\nputs 1\n{% endhighlight %}\n后",
+			want: "前\n```ruby\nputs 1\n```\n后",
+		},
+		{
+			name: "codeblock lang 参数",
+			in:   "{% codeblock demo.js lang:js %}\nlet a = \"{% x %}\"\n{% endcodeblock %}",
+			want: "```js\nlet a = \"{% x %}\"\n```",
+		},
+		{
+			name: "代码中有 ```",
+			in:   "{% highlight md %}\n```\ncode\n```\n{% endhighlight %}",
+			want: "````md\n```\ncode\n```\n````",
+		},
+		{
+			name: "raw 原样保留",
+			in:   "{% raw %}{{ page.title }} {% if %}{% endraw %}",
+			want: "{{ page.title }} {% if %}",
+		},
+		{
+			name: "markdown 代码块和行内代码不转换",
+			in:   "```\n{% asset_img a.png %}\n```\n`{{ site.url }}` {% asset_img b.png %}",
+			tags: hexoTags,
+			want: "```\n{% asset_img a.png %}\n```\n`{{ site.url }}` ![](b.png)",
+		},
+		{
+			name: "未闭合的代码块",
+			in:   "~~~\n{% asset_img a.png %}",
+			tags: hexoTags,
+			want: "~~~\n{% asset_img a.png %}",
+		},
+		{
+			name: "Hexo 图片",
+			in:   `{% asset_img left cat.jpg 200 "A cat" "cat alt" %} {% asset_link doc.pdf 下载 文档 %}`,
+			tags: hexoTags,
+			want: `![cat alt](cat.jpg "A cat") [下载 文档](doc.pdf)`,
+		},
+		{
+			name:     "未知标签只警告一次",
+			in:       "{% post_link other %} {% post_link other %} {% include x.html %}",
+			tags:     hexoTags,
+			want:     "{% post_link other %} {% post_link other %} {% include x.html %}",
+			warnings: []string{"未转换的标签: {% post_link other %}", "未转换的标签: {% include x.html %}"},
+		},
+		{
+			name:     "Jekyll 输出",
+			in:       `![a]({{ site.baseurl }}/a.png) [b]({{ "/b/" | relative_url }}) {{ page.title }}`,
+			output:   jekyllOutput,
+			want:     `![a](/a.png) [b](/b/) {{ page.title }}`,
+			warnings: []string{"未转换的模板输出: {{ page.title }}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &sourcePost{content: tt.in}
+			convertLiquid(src, tt.tags, tt.output)
+			if src.content != tt.want {
+				t.Errorf("content = %q\nwant %q", src.content, tt.want)
+			}
+			if !reflect.DeepEqual(src.warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", src.warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestConvertShortcodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		want     string
+		warnings []string
+	}{
+		{
+			name: "highlight 代码块",
+			in:   "{{< highlight go \"linenos=table\" >}}\nfmt.Println(\"{{< x >}}\")\n{{< /highlight >}}",
+			want: "```go\nfmt.Println(\"{{< x >}}\")\n```",
+		},
+		{
+			name: "figure",
+			in:   `{{< figure src="/a.jpg" title="Say \"hi\"" >}} {{% figure "/b.jpg" alt="b" %}}`,
+			want: `![Say "hi"](/a.jpg "Say 'hi'") ![b](/b.jpg)`,
+		},
+		{
+			name:     "未知 shortcode",
+			in:       `{{< youtube abc >}} {{< youtube abc >}}`,
+			want:     `{{< youtube abc >}} {{< youtube abc >}}`,
+			warnings: []string{"未转换的 shortcode: {{< youtube abc >}}"},
+		},
+		{
+			name: "转义写法",
+			in:   `{{</* figure src="x" */>}} {{%/* note */%}}`,
+			want: `{{< figure src="x" >}} {{% note %}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &sourcePost{content: tt.in}
+			convertShortcodes(src, hugoShortcodes)
+			if src.content != tt.want {
+				t.Errorf("content = %q\nwant %q", src.content, tt.want)
+			}
+			if !reflect.DeepEqual(src.warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", src.warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  a  b ", []string{"a", "b"}},
+		{`"a b" 'c "d"' e`, []string{"a b", `c "d"`, "e"}},
+		{`title="A B" x`, []string{"title=A B", "x"}},
+		{`""`, []string{""}},
+		{`"say \"hi\"" 'C:\dir' "end\`, []string{`say "hi"`, `C:\dir`, `end\`}},
+	}
+	for _, tt := range tests {
+		if got := splitArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSlugize(t *testing.T) {
+	tests := []struct {
+		in    string
+		lower bool
+		want  string
+	}{
+		{"Hello, World!", true, "hello-world"},
+		{"Hello World", false, "Hello-World"},
+		{"  Go 1.20 发布  ", true, "go-1-20-发布"},
+		{"snake_case -- x", true, "snake_case-x"},
+		{"!!!", true, ""},
+	}
+	for _, tt := range tests {
+		if got := slugize(tt.in, tt.lower); got != tt.want {
+			t.Errorf("slugize(%q, %v) = %q, want %q", tt.in, tt.lower, got, tt.want)
+		}
+	}
+}
+
+func TestExpandPermalink(t *testing.T) {
+	vars := map[string]string{"year": "2024", "month": "05", "title": "hello"}
+	tests := []struct {
+		pattern, want string
+	}{
+		{":year/:month/:title/", "/2024/05/hello/"},
+		{"/blog//:title.html", "/blog/hello.html"},
+		{":year/:unknown/:title", "/2024/:unknown/hello"},
+	}
+	for _, tt := range tests {
+		if got := expandPermalink(tt.pattern, vars); got != tt.want {
+			t.Errorf("expandPermalink(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 解析后的 frontmatter
+type frontMatter map[string]any
+
+// 拆分 frontmatter 和正文，支持 YAML（---）、TOML（+++）和 JSON（{ }）三种格式；
+// 没有 frontmatter 时返回空的 frontMatter 和全部内容
+func splitFrontMatter(data []byte) (frontMatter, string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	switch {
+	case strings.HasPrefix(text, "---\n"):
+		head, body, ok := cutDelimited(text[4:], "---")
+		if !ok {
+			return nil, "", fmt.Errorf("frontmatter 没有结束标记")
+		}
+		fm, err := unmarshalYAML([]byte(head))
+		if err != nil {
+			return nil, "", fmt.Errorf("解析 YAML frontmatter 失败: %w", err)
+		}
+		return fm, body, nil
+	case strings.HasPrefix(text, "+++\n"):
+		head, body, ok := cutDelimited(text[4:], "+++")
+		if !ok {
+			return nil, "", fmt.Errorf("frontmatter 没有结束标记")
+		}
+		fm := frontMatter{}
+		if err := toml.Unmarshal([]byte(head), &fm); err != nil {
+			return nil, "", fmt.Errorf("解析 TOML frontmatter 失败: %w", err)
+		}
+		return fm, body, nil
+	case strings.HasPrefix(text, "{"):
+		fm := frontMatter{}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		if err := decoder.Decode(&fm); err != nil {
+			return nil, "", fmt.Errorf("解析 JSON frontmatter 失败: %w", err)
+		}
+		return fm, text[decoder.InputOffset():], nil
+	}
+	return frontMatter{}, text, nil
+}
+
+// 读取 YAML、TOML 或 JSON 格式的站点配置，文件不存在时返回空配置
+func readConfig(path string) (frontMatter, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return frontMatter{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg := frontMatter{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &cfg)
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	default:
+		cfg, err = unmarshalYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// YAML 中的日期保留为字符串，没有时区的日期由调用方按源站点的时区解释
+func unmarshalYAML(data []byte) (frontMatter, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	keepTimestamps(&node)
+	fm := frontMatter{}
+	if err := node.Decode(&fm); err != nil {
+		return nil, err
+	}
+	return fm, nil
+}
+
+func keepTimestamps(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!timestamp" {
+		node.Tag = "!!str"
+	}
+	for _, child := range node.Content {
+		keepTimestamps(child)
+	}
+}
+
+// 查找单独成行的结束标记
+func cutDelimited(text, delimiter string) (string, string, bool) {
+	if strings.HasPrefix(text, delimiter+"\n") || text == delimiter {
+		return "", strings.TrimPrefix(text, delimiter), true
+	}
+	lines := strings.SplitAfter(text, "\n")
+	offset := 0
+	for _, line := range lines {
+		if strings.TrimRight(line, " \t\n") == delimiter {
+			return text[:offset], text[offset+len(line):], true
+		}
+		offset += len(line)
+	}
+	return "", "", false
+}
+
+// 字符串字段，键名不区分大小写
+func (fm frontMatter) text(keys ...string) string {
+	value, ok := fm.lookup(keys...)
+	if !ok || value == nil {
+		return ""
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
+
+// 列表字段，单个字符串按 sep 拆分（sep 为空时不拆分），嵌套列表展开
+func (fm frontMatter) list(sep string, keys ...string) []string {
+	value, ok := fm.lookup(keys...)
+	if !ok {
+		return nil
+	}
+	return flattenList(value, sep)
+}
+
+// 分类层级：Hexo 的 [a, b] 表示 a 下的子分类 b，[[a, b], c] 表示 a/b 和 c 两组分类
+func (fm frontMatter) groups(keys ...string) [][]string {
+	value, ok := fm.lookup(keys...)
+	if !ok {
+		return nil
+	}
+	items, ok := value.([]any)
+	nested := false
+	for _, item := range items {
+		if _, ok := item.([]any); ok {
+			nested = true
+		}
+	}
+	if !nested {
+		if list := flattenList(value, ""); len(list) > 0 {
+			return [][]string{list}
+		}
+		return nil
+	}
+	var groups [][]string
+	for _, item := range items {
+		if list := flattenList(item, ""); len(list) > 0 {
+			groups = append(groups, list)
+		}
+	}
+	return groups
+}
+
+func flattenList(value any, sep string) []string {
+	var result []string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		if sep == "" {
+			if s := strings.TrimSpace(v); s != "" {
+				result = append(result, s)
+			}
+			break
+		}
+		for _, item := range strings.Split(v, sep) {
+			if s := strings.TrimSpace(item); s != "" {
+				result = append(result, s)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			result = append(result, flattenList(item, "")...)
+		}
+	default:
+		result = append(result, fmt.Sprint(v))
+	}
+	return result
+}
+
+// 布尔字段，字符串 "true"/"false" 也可以识别
+func (fm frontMatter) flag(key string) (bool, bool) {
+	value, ok := fm.lookup(key)
+	if !ok {
+		return false, false
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes":
+			return true, true
+		case "false", "no":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// 日期字段，没有时区的日期按 loc 解释
+func (fm frontMatter) date(loc *time.Location, keys ...string) (time.Time, bool, error) {
+	value, ok := fm.lookup(keys...)
+	if !ok || value == nil {
+		return time.Time{}, false, nil
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v, true, nil
+	case toml.LocalDateTime:
+		return v.AsTime(loc), true, nil
+	case toml.LocalDate:
+		return v.AsTime(loc), true, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return time.Time{}, false, nil
+		}
+		t, err := parseTime(v, loc)
+		return t, err == nil, err
+	}
+	return time.Time{}, false, fmt.Errorf("无法识别的日期: %v", value)
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04 -0700",
+	"2006-01-02 15:04",
+	"2006-1-2 15:4:5",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006-01-02",
+	"2006-1-2",
+	"2006/01/02",
+}
+
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法识别的日期: %s", value)
+}
+
+func (fm frontMatter) lookup(keys ...string) (any, bool) {
+	for _, key := range keys {
+		if value, ok := fm[key]; ok {
+			return value, true
+		}
+		for k, value := range fm {
+			if strings.EqualFold(k, key) {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
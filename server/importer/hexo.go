@@ -0,0 +1,173 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Hexo 站点：文章在 source/_posts，草稿在 source/_drafts，配置在 _config.yml
+func readHexo(root string) (*sourceSite, error) {
+	cfg, err := readConfig(filepath.Join(root, "_config.yml"))
+	if err != nil {
+		return nil, err
+	}
+	loc, err := siteLocation(cfg.text("timezone"))
+	if err != nil {
+		return nil, err
+	}
+	sourceDir := filepath.Join(root, stringOr(cfg.text("source_dir"), "source"))
+	site := &sourceSite{
+		root:       root,
+		staticDirs: []string{sourceDir},
+		baseURL:    strings.TrimRight(cfg.text("url"), "/"),
+		basePath:   strings.TrimRight(stringOr(cfg.text("root"), "/"), "/"),
+	}
+
+	for _, name := range []string{"_posts", "_drafts"} {
+		postsDir := filepath.Join(sourceDir, name)
+		draft := name == "_drafts"
+		err := walkMarkdown(postsDir, func(path string) error {
+			post, err := readHexoPost(site, cfg, loc, postsDir, path, draft)
+			if err != nil {
+				site.skip(path, err.Error())
+				return nil
+			}
+			site.posts = append(site.posts, post)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return site, nil
+}
+
+func readHexoPost(site *sourceSite, cfg frontMatter, loc *time.Location, postsDir, path string, draft bool) (*sourcePost, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fm, body, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	post := &sourcePost{
+		file:    site.rel(path),
+		title:   fm.text("title"),
+		summary: fm.text("excerpt", "description"),
+		content: body,
+		draft:   draft,
+		tags:    fm.list("", "tags", "tag"),
+		// 开启 post_asset_folder 时图片在与文章同名的目录中
+		assetDirs: []string{filepath.Dir(path), filepath.Join(filepath.Dir(path), name)},
+	}
+	if published, ok := fm.flag("published"); ok && !published {
+		post.draft = true
+	}
+	if post.date, _, err = fm.date(loc, "date"); err != nil {
+		post.warn("%v", err)
+	}
+	if post.updated, _, err = fm.date(loc, "updated"); err != nil {
+		post.warn("%v", err)
+	}
+	if err := post.fallbackDate(path); err != nil {
+		return nil, err
+	}
+	groups := fm.groups("categories", "category")
+	for _, group := range groups {
+		post.categories = append(post.categories, group...)
+	}
+
+	if !post.draft {
+		var permalink string
+		if custom := fm.text("permalink"); custom != "" {
+			permalink = cleanURLPath(site.basePath + "/" + custom)
+		} else {
+			vars := map[string]string{
+				"name":       name,
+				"post_title": slugize(post.title, false),
+				"category":   slugize(stringOr(cfg.text("default_category"), "uncategorized"), false),
+			}
+			if rel, err := filepath.Rel(postsDir, path); err == nil {
+				vars["title"] = strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+			}
+			if len(groups) > 0 {
+				var parts []string
+				for _, category := range groups[0] {
+					parts = append(parts, slugize(category, false))
+				}
+				vars["category"] = strings.Join(parts, "/")
+			}
+			dateVars(vars, post.date.In(loc))
+			permalink = expandPermalink(site.basePath+"/"+stringOr(cfg.text("permalink"), ":year/:month/:day/:title/"), vars)
+		}
+		post.permalinks = append(post.permalinks, permalink)
+	}
+
+	convertLiquid(post, hexoTags, nil)
+	return post, nil
+}
+
+// Hexo 文章中常用的标签，post_link 等依赖其他文章地址的标签保留原样
+var hexoTags = map[string]tagHandler{
+	"asset_img": hexoImage,
+	"img":       hexoImage,
+	"asset_path": func(args string) (string, bool) {
+		fields := splitArgs(args)
+		if len(fields) == 0 {
+			return "", false
+		}
+		return fields[0], true
+	},
+	"asset_link": func(args string) (string, bool) {
+		fields := splitArgs(args)
+		if len(fields) == 0 {
+			return "", false
+		}
+		title := fields[0]
+		if len(fields) > 1 {
+			title = strings.Join(fields[1:], " ")
+		}
+		return "[" + title + "](" + fields[0] + ")", true
+	},
+}
+
+// {% asset_img [class] slug [width] [height] [title [alt]] %}
+func hexoImage(args string) (string, bool) {
+	fields := splitArgs(args)
+	src := -1
+	for i, field := range fields {
+		if strings.Contains(field, "/") || filepath.Ext(field) != "" {
+			src = i
+			break
+		}
+	}
+	if src < 0 {
+		return "", false
+	}
+	var text []string
+	for _, field := range fields[src+1:] {
+		if strings.Trim(field, "0123456789px%") != "" {
+			text = append(text, field)
+		}
+	}
+	title, alt := "", ""
+	if len(text) > 0 {
+		title, alt = text[0], text[0]
+	}
+	if len(text) > 1 {
+		alt = text[1]
+	}
+	return markdownImage(alt, fields[src], title), true
+}
+
+func stringOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
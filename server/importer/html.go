@@ -0,0 +1,507 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 图片集中的一张图片
+type galleryImage struct {
+	src     string
+	alt     string
+	caption string
+}
+
+// HTML 转 markdown，无法用 markdown 表示的嵌入内容保留为 HTML 并记录警告
+type htmlConverter struct {
+	// 改写图片地址，为空时保持不变
+	imageSrc func(src string) string
+	// 按附件 ID 列表查找图片集中的图片
+	attachments func(ids string) []galleryImage
+	galleries   [][]galleryImage
+	warnings    []string
+}
+
+func (c *htmlConverter) warn(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	for _, w := range c.warnings {
+		if w == message {
+			return
+		}
+	}
+	c.warnings = append(c.warnings, message)
+}
+
+func (c *htmlConverter) convert(source string) (string, error) {
+	nodes, err := parseHTML(source)
+	if err != nil {
+		return "", err
+	}
+	markdown := c.blocks(nodes)
+	return strings.TrimSpace(markdown), nil
+}
+
+func parseHTML(source string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(source), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+}
+
+// 依次输出块级内容，相邻的行内内容合并为一个段落
+func (c *htmlConverter) blocks(nodes []*html.Node) string {
+	var blocks []string
+	var paragraph strings.Builder
+	flush := func() {
+		// 换行后的空白会被当作缩进
+		text := hardBreakRegex.ReplaceAllString(paragraph.String(), "  \n")
+		if text = strings.TrimSpace(text); text != "" {
+			blocks = append(blocks, text)
+		}
+		paragraph.Reset()
+	}
+	for _, node := range nodes {
+		if node.Type == html.ElementNode && isBlockElement(node) {
+			flush()
+			if block := strings.TrimSpace(c.block(node)); block != "" {
+				blocks = append(blocks, block)
+			}
+			continue
+		}
+		paragraph.WriteString(c.inline(node))
+	}
+	flush()
+	return strings.Join(blocks, "\n\n")
+}
+
+func children(node *html.Node) []*html.Node {
+	var nodes []*html.Node
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		nodes = append(nodes, child)
+	}
+	return nodes
+}
+
+func (c *htmlConverter) block(node *html.Node) string {
+	if isGallery(node) {
+		return c.gallery(collectImages(node, c.imageSrc))
+	}
+	switch node.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(node.Data[1] - '0')
+		return strings.Repeat("#", level) + " " + strings.TrimSpace(c.inlineChildren(node))
+	case atom.Pre:
+		return codeFence(codeLanguage(node), textContent(node))
+	case atom.Blockquote:
+		return prefixLines(c.blocks(children(node)), "> ")
+	case atom.Ul, atom.Ol:
+		return c.list(node, 0)
+	case atom.Hr:
+		// 不使用 ---，避免与 frontmatter 的分隔符混淆
+		return "* * *"
+	case atom.Table:
+		return c.table(node)
+	case atom.Figure:
+		return c.figure(node)
+	case atom.Iframe, atom.Video, atom.Audio, atom.Object, atom.Embed:
+		c.warn("保留了 HTML 嵌入内容: <%s>", node.Data)
+		return renderHTML(node)
+	case atom.Script, atom.Style, atom.Form, atom.Noscript:
+		c.warn("删除了 <%s>", node.Data)
+		return ""
+	}
+	if node.DataAtom == atom.Div && hasClass(node, "wxr-gallery") && c.attachments != nil {
+		return c.gallery(c.attachments(attr(node, "data-ids")))
+	}
+	return c.blocks(children(node))
+}
+
+// 图片集在文章中显示为连续的图片，同时记录下来导入为照片
+func (c *htmlConverter) gallery(images []galleryImage) string {
+	if len(images) == 0 {
+		return ""
+	}
+	c.galleries = append(c.galleries, images)
+	var lines []string
+	for _, image := range images {
+		lines = append(lines, markdownImage(escapeText(image.alt), image.src, image.caption))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// figure 中的图片加上说明文字
+func (c *htmlConverter) figure(node *html.Node) string {
+	var caption string
+	var content []*html.Node
+	for _, child := range children(node) {
+		if child.DataAtom == atom.Figcaption {
+			caption = strings.TrimSpace(c.inlineChildren(child))
+			continue
+		}
+		content = append(content, child)
+	}
+	body := c.blocks(content)
+	if caption != "" {
+		body += "\n\n_" + caption + "_"
+	}
+	return body
+}
+
+func (c *htmlConverter) list(node *html.Node, depth int) string {
+	var items []string
+	n := 0
+	if start, err := strconv.Atoi(attr(node, "start")); err == nil {
+		n = start - 1
+	}
+	for _, child := range children(node) {
+		if child.DataAtom != atom.Li {
+			continue
+		}
+		n++
+		marker := "- "
+		if node.DataAtom == atom.Ol {
+			marker = strconv.Itoa(n) + ". "
+		}
+		var parts []string
+		var inline []*html.Node
+		flushInline := func() {
+			if text := strings.TrimSpace(c.blocks(inline)); text != "" {
+				parts = append(parts, text)
+			}
+			inline = nil
+		}
+		for _, grandchild := range children(child) {
+			if grandchild.DataAtom == atom.Ul || grandchild.DataAtom == atom.Ol {
+				flushInline()
+				parts = append(parts, c.list(grandchild, depth+1))
+				continue
+			}
+			inline = append(inline, grandchild)
+		}
+		flushInline()
+		body := strings.Join(parts, "\n")
+		items = append(items, marker+indentLines(body, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// 表格转为 GFM 表格，单元格中的换行合并为空格
+func (c *htmlConverter) table(node *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.DataAtom == atom.Tr {
+			var row []string
+			for _, cell := range children(n) {
+				if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+					text := strings.Join(strings.Fields(c.inlineChildren(cell)), " ")
+					row = append(row, strings.ReplaceAll(text, "|", `\|`))
+				}
+			}
+			rows = append(rows, row)
+			return
+		}
+		for _, child := range children(n) {
+			walk(child)
+		}
+	}
+	walk(node)
+	if len(rows) == 0 {
+		return ""
+	}
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	var lines []string
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *htmlConverter) inlineChildren(node *html.Node) string {
+	var b strings.Builder
+	for _, child := range children(node) {
+		b.WriteString(c.inline(child))
+	}
+	return b.String()
+}
+
+var (
+	whitespaceRegex = regexp.MustCompile(`\s+`)
+	hardBreakRegex  = regexp.MustCompile(` *  \n\s*`)
+)
+
+func (c *htmlConverter) inline(node *html.Node) string {
+	switch node.Type {
+	case html.TextNode:
+		return escapeText(whitespaceRegex.ReplaceAllString(node.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch node.DataAtom {
+	case atom.Br:
+		return "  \n"
+	case atom.Strong, atom.B:
+		return wrapInline(c.inlineChildren(node), "**")
+	case atom.Em, atom.I:
+		return wrapInline(c.inlineChildren(node), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrapInline(c.inlineChildren(node), "~~")
+	case atom.Code, atom.Kbd, atom.Tt:
+		text := textContent(node)
+		fence := "`"
+		for strings.Contains(text, fence) {
+			fence += "`"
+		}
+		return fence + text + fence
+	case atom.Img:
+		return c.image(node, "")
+	case atom.A:
+		href := attr(node, "href")
+		// 链接到大图的缩略图直接使用大图
+		if img := onlyImage(node); img != nil && isImageURL(href) {
+			return c.image(img, href)
+		}
+		text := strings.TrimSpace(c.inlineChildren(node))
+		if href == "" || strings.HasPrefix(href, "#") {
+			return text
+		}
+		if text == "" {
+			text = escapeText(href)
+		}
+		if title := attr(node, "title"); title != "" {
+			return fmt.Sprintf("[%s](%s \"%s\")", text, href, strings.ReplaceAll(title, `"`, `'`))
+		}
+		return fmt.Sprintf("[%s](%s)", text, href)
+	case atom.Script, atom.Style:
+		c.warn("删除了 <%s>", node.Data)
+		return ""
+	case atom.Iframe, atom.Video, atom.Audio, atom.Object, atom.Embed:
+		c.warn("保留了 HTML 嵌入内容: <%s>", node.Data)
+		return renderHTML(node)
+	}
+	if isBlockElement(node) {
+		return " " + c.inlineChildren(node) + " "
+	}
+	return c.inlineChildren(node)
+}
+
+func (c *htmlConverter) image(node *html.Node, src string) string {
+	if src == "" {
+		src = attr(node, "src")
+	}
+	if src == "" {
+		return ""
+	}
+	if c.imageSrc != nil {
+		src = c.imageSrc(src)
+	}
+	return markdownImage(escapeText(attr(node, "alt")), strings.ReplaceAll(src, " ", "%20"), attr(node, "title"))
+}
+
+// 强调标记不能紧挨空白，否则不会生效
+func wrapInline(text, mark string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := text[:strings.Index(text, trimmed)]
+	end := text[len(start)+len(trimmed):]
+	return start + mark + trimmed + mark + end
+}
+
+// 转义会被当作 markdown 语法的字符，单词中间的下划线不需要转义
+func escapeText(text string) string {
+	var b strings.Builder
+	for i, r := range text {
+		switch r {
+		case '\\', '*', '`', '[', ']', '<':
+			b.WriteByte('\\')
+		case '_':
+			prev, _ := utf8.DecodeLastRuneInString(text[:i])
+			next, _ := utf8.DecodeRuneInString(text[i+1:])
+			if !isWordRune(prev) || !isWordRune(next) {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func prefixLines(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(prefix+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 列表项的后续行缩进到内容的起始位置
+func indentLines(text, indent string) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isBlockElement(node *html.Node) bool {
+	switch node.DataAtom {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Aside, atom.Header, atom.Footer, atom.Nav, atom.Main,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Pre, atom.Blockquote, atom.Ul, atom.Ol, atom.Dl, atom.Hr, atom.Table, atom.Figure, atom.Address,
+		atom.Iframe, atom.Video, atom.Audio, atom.Object, atom.Embed, atom.Script, atom.Style, atom.Form, atom.Noscript:
+		return true
+	}
+	return false
+}
+
+// WordPress 图片集的 HTML：经典编辑器的 div.gallery 和区块编辑器的 figure.wp-block-gallery
+func isGallery(node *html.Node) bool {
+	return hasClass(node, "wp-block-gallery") || (node.DataAtom == atom.Div && hasClass(node, "gallery"))
+}
+
+func collectImages(node *html.Node, rewrite func(string) string) []galleryImage {
+	var images []galleryImage
+	var walk func(n *html.Node, caption string)
+	walk = func(n *html.Node, caption string) {
+		if n.DataAtom == atom.Figure || n.DataAtom == atom.Dl || n.DataAtom == atom.Li {
+			for _, child := range children(n) {
+				if child.DataAtom == atom.Figcaption || hasClass(child, "gallery-caption") {
+					caption = strings.TrimSpace(strings.Join(strings.Fields(textContent(child)), " "))
+				}
+			}
+		}
+		if n.DataAtom == atom.Img {
+			src := attr(n, "src")
+			// 链接到大图时使用大图
+			if n.Parent != nil && n.Parent.DataAtom == atom.A && isImageURL(attr(n.Parent, "href")) {
+				src = attr(n.Parent, "href")
+			}
+			if rewrite != nil {
+				src = rewrite(src)
+			}
+			images = append(images, galleryImage{src: src, alt: attr(n, "alt"), caption: caption})
+			return
+		}
+		for _, child := range children(n) {
+			if child.DataAtom != atom.Figcaption {
+				walk(child, caption)
+			}
+		}
+	}
+	for _, child := range children(node) {
+		walk(child, "")
+	}
+	return images
+}
+
+func onlyImage(node *html.Node) *html.Node {
+	var img *html.Node
+	for _, child := range children(node) {
+		switch {
+		case child.Type == html.TextNode && strings.TrimSpace(child.Data) == "":
+		case child.DataAtom == atom.Img && img == nil:
+			img = child
+		default:
+			return nil
+		}
+	}
+	return img
+}
+
+var imageExtRegex = regexp.MustCompile(`(?i)\.(jpe?g|png|gif|webp)(\?.*)?$`)
+
+func isImageURL(u string) bool {
+	return imageExtRegex.MatchString(u)
+}
+
+// pre 中的代码语言：class="language-go"、class="brush: php" 或 code 元素上的 class
+func codeLanguage(node *html.Node) string {
+	classes := attr(node, "class")
+	if code := node.FirstChild; code != nil && code.DataAtom == atom.Code {
+		classes += " " + attr(code, "class")
+	}
+	if lang := attr(node, "data-lang"); lang != "" {
+		return lang
+	}
+	for _, class := range strings.Fields(strings.ReplaceAll(classes, ";", " ")) {
+		if strings.HasPrefix(class, "language-") {
+			return strings.TrimPrefix(class, "language-")
+		}
+		if strings.HasPrefix(class, "lang-") {
+			return strings.TrimPrefix(class, "lang-")
+		}
+	}
+	if i := strings.Index(classes, "brush:"); i >= 0 {
+		if fields := strings.Fields(classes[i+len("brush:"):]); len(fields) > 0 {
+			return strings.TrimSuffix(fields[0], ";")
+		}
+	}
+	return ""
+}
+
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var b strings.Builder
+	for _, child := range children(node) {
+		if child.DataAtom == atom.Br {
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func renderHTML(node *html.Node) string {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func hasClass(node *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(node, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
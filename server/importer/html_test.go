@@ -0,0 +1,120 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHTMLConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		want      string
+		warnings  []string
+		galleries int
+	}{
+		{
+			name: "段落和强调",
+			in:   "<p>Hello <strong>world</strong> and <em>more</em>!</p><p>Second</p>",
+			want: "Hello **world** and *more*!\n\nSecond",
+		},
+		{name: "删除线", in: "<p><del>old</del> new</p>", want: "~~old~~ new"},
+		{name: "标题", in: "<h2>Title <code>x</code></h2>", want: "## Title `x`"},
+		{name: "换行", in: "<p>a<br>b<br/>\n c</p>", want: "a  \nb  \nc"},
+		{
+			name: "嵌套列表",
+			in:   "<ul><li>one</li><li>two<ul><li>nested</li></ul></li></ul>",
+			want: "- one\n- two\n  - nested",
+		},
+		{
+			name: "有序列表起始序号",
+			in:   `<ol start="3"><li>c</li><li><p>d</p><p>e</p></li></ol>`,
+			want: "3. c\n4. d\n\n   e",
+		},
+		{name: "引用", in: "<blockquote><p>q1</p><p>q2</p></blockquote>", want: "> q1\n>\n> q2"},
+		{
+			name: "SyntaxHighlighter 代码块",
+			in:   "<pre class=\"brush: php; gutter: false\">echo 1;\n&lt;?php</pre>",
+			want: "```php\necho 1;\n<?php\n```",
+		},
+		{
+			name: "language 代码块",
+			in:   "<pre><code class=\"language-go\">fmt.Println(\"`\")</code></pre>",
+			want: "```go\nfmt.Println(\"`\")\n```",
+		},
+		{name: "行内代码含反引号", in: "<p>use <code>a`b</code> here</p>", want: "use ``a`b`` here"},
+		{
+			name: "表格",
+			in:   "<table><thead><tr><th>A</th><th>B|C</th></tr></thead><tbody><tr><td>1</td></tr></tbody></table>",
+			want: "| A | B\\|C |\n| --- | --- |\n| 1 |  |",
+		},
+		{
+			name: "链接",
+			in:   `<p><a href="https://x.com" title='say "hi"'>link</a> <a href="#top">top</a> <a href="https://y.com"></a></p>`,
+			want: `[link](https://x.com "say 'hi'") top [https://y.com](https://y.com)`,
+		},
+		{
+			name: "链接到大图的图片",
+			in:   `<p><a href="/big.jpg"><img src="/small.jpg" alt="pic"></a></p>`,
+			want: "![pic](/big.jpg)",
+		},
+		{
+			name: "figure 说明含强调",
+			in:   `<figure><img src="a b.png" alt="*x*"><figcaption>Cap <em>it</em></figcaption></figure>`,
+			want: "![\\*x\\*](a%20b.png)\n\n_Cap *it*_",
+		},
+		{
+			name: "转义",
+			in:   `<p>snake_case _under_ 1*2 [b] &lt;tag&gt; back\slash</p>`,
+			want: `snake_case \_under\_ 1\*2 \[b\] \<tag> back\\slash`,
+		},
+		{name: "分隔线", in: "<hr><p>x</p>", want: "* * *\n\nx"},
+		{
+			name:     "脚本和嵌入",
+			in:       `<p>before</p><script>alert(1)</script><iframe src="https://v"></iframe>`,
+			want:     "before\n\n<iframe src=\"https://v\"></iframe>",
+			warnings: []string{"删除了 <script>", "保留了 HTML 嵌入内容: <iframe>"},
+		},
+		{
+			name:      "相册",
+			in:        `<div class="gallery"><dl><dt><a href="/1.jpg"><img src="/1-150.jpg" alt="one"></a></dt><dd class="gallery-caption">First</dd></dl><dl><dt><img src="/2.jpg"></dt></dl></div>`,
+			want:      "![one](/1.jpg \"First\")\n![](/2.jpg)",
+			galleries: 1,
+		},
+		{name: "行内和块混排", in: "text only<div>block</div>tail", want: "text only\n\nblock\n\ntail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &htmlConverter{}
+			got, err := c.convert(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("convert = %q\nwant %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(c.warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", c.warnings, tt.warnings)
+			}
+			if len(c.galleries) != tt.galleries {
+				t.Errorf("galleries = %d, want %d", len(c.galleries), tt.galleries)
+			}
+		})
+	}
+}
+
+func TestAutop(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a\nb\n\nc", "<p>a<br>\nb</p>\n\n<p>c</p>"},
+		{"<pre>x\n\ny</pre>\n\np", "<pre>x\n\ny</pre>\n\n<p>p</p>"},
+		{"<h2>T</h2>\n\ntext\r\nmore", "<h2>T</h2>\n\n<p>text<br>\nmore</p>"},
+		{"<ul>\n<li>x</li>\n</ul>", "<ul>\n<li>x</li>\n</ul>"},
+	}
+	for _, tt := range tests {
+		if got := autop(tt.in); got != tt.want {
+			t.Errorf("autop(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
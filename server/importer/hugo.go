@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var hugoConfigNames = []string{"hugo.toml", "hugo.yaml", "hugo.yml", "hugo.json", "config.toml", "config.yaml", "config.yml", "config.json"}
+
+// Hugo 的配置文件可以在站点根目录或 config/_default 中
+func hugoConfigFile(root string) string {
+	for _, dir := range []string{root, filepath.Join(root, "config", "_default")} {
+		for _, name := range hugoConfigNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Hugo 站点：文章在 content 目录，第一层目录为栏目，index.md 所在目录为页面包
+func readHugo(root string) (*sourceSite, error) {
+	cfg := frontMatter{}
+	if file := hugoConfigFile(root); file != "" {
+		var err error
+		if cfg, err = readConfig(file); err != nil {
+			return nil, err
+		}
+	}
+	// Hugo 默认按 UTC 解释没有时区的日期
+	loc, err := siteLocation(stringOr(cfg.text("timeZone"), "UTC"))
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimRight(cfg.text("baseURL"), "/")
+	site := &sourceSite{root: root, baseURL: baseURL}
+	if u, err := url.Parse(baseURL); err == nil {
+		site.basePath = strings.TrimRight(u.Path, "/")
+	}
+	for _, dir := range append(cfg.list("", "staticDir"), "static") {
+		site.staticDirs = append(site.staticDirs, filepath.Join(root, dir))
+	}
+
+	contentDir := filepath.Join(root, stringOr(cfg.text("contentDir"), "content"))
+	if !isDir(contentDir) {
+		return nil, fmt.Errorf("找不到内容目录 %s", contentDir)
+	}
+	permalinks := hugoPermalinks(cfg)
+	lower := true
+	if disabled, ok := cfg.flag("disablePathToLower"); ok && disabled {
+		lower = false
+	}
+
+	err = walkMarkdown(contentDir, func(file string) error {
+		if strings.HasPrefix(filepath.Base(file), "_index.") {
+			site.skip(file, "栏目列表页不导入")
+			return nil
+		}
+		post, err := readHugoPost(site, loc, contentDir, file, permalinks, lower)
+		if err != nil {
+			site.skip(file, err.Error())
+			return nil
+		}
+		site.posts = append(site.posts, post)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return site, nil
+}
+
+// 栏目到固定链接格式的映射，兼容新版本按页面类型分组的写法
+func hugoPermalinks(cfg frontMatter) map[string]string {
+	value, _ := cfg.lookup("permalinks")
+	section, _ := value.(map[string]any)
+	if page, ok := section["page"].(map[string]any); ok {
+		section = page
+	}
+	permalinks := map[string]string{}
+	for name, pattern := range section {
+		if s, ok := pattern.(string); ok {
+			permalinks[name] = s
+		}
+	}
+	return permalinks
+}
+
+func readHugoPost(site *sourceSite, loc *time.Location, contentDir, file string, permalinks map[string]string, lower bool) (*sourcePost, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	fm, body, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, err
+	}
+
+	post := &sourcePost{
+		file:       site.rel(file),
+		title:      fm.text("title"),
+		summary:    fm.text("summary", "description"),
+		content:    body,
+		categories: fm.list("", "categories"),
+		tags:       fm.list("", "tags"),
+		assetDirs:  []string{filepath.Dir(file)},
+	}
+	if draft, ok := fm.flag("draft"); ok && draft {
+		post.draft = true
+	}
+	if post.date, _, err = fm.date(loc, "date", "publishDate", "pubDate", "published"); err != nil {
+		post.warn("%v", err)
+	}
+	if post.updated, _, err = fm.date(loc, "lastmod", "modified"); err != nil {
+		post.warn("%v", err)
+	}
+	if err := post.fallbackDate(file); err != nil {
+		return nil, err
+	}
+
+	// 页面包使用目录名作为文件名
+	rel, err := filepath.Rel(contentDir, file)
+	if err != nil {
+		return nil, err
+	}
+	rel = filepath.ToSlash(rel)
+	dir, name := path.Dir(rel), strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	if name == "index" && dir != "." {
+		dir, name = path.Dir(dir), path.Base(dir)
+	}
+	if dir == "." {
+		dir = ""
+	}
+	section := strings.Split(dir, "/")[0]
+
+	var permalink string
+	if custom := fm.text("url"); custom != "" {
+		permalink = cleanURLPath(site.basePath + "/" + custom)
+	} else {
+		slug := fm.text("slug")
+		var generated string
+		if pattern, ok := permalinks[section]; ok && section != "" {
+			vars := map[string]string{
+				"section":         section,
+				"sections":        dir,
+				"title":           slugize(post.title, true),
+				"slug":            stringOr(slug, slugize(post.title, true)),
+				"filename":        name,
+				"slugorfilename":  stringOr(slug, name),
+				"contentbasename": name,
+			}
+			t := post.date.In(loc)
+			dateVars(vars, t)
+			vars["monthname"] = t.Format("January")
+			vars["weekday"] = fmt.Sprint(int(t.Weekday()))
+			vars["weekdayname"] = t.Format("Monday")
+			vars["yearday"] = fmt.Sprint(t.YearDay())
+			generated = expandPermalink(pattern, vars)
+		} else {
+			generated = cleanURLPath(dir + "/" + stringOr(slug, name) + "/")
+		}
+		if lower {
+			generated = strings.ToLower(generated)
+		}
+		permalink = cleanURLPath(site.basePath + generated)
+	}
+	if !post.draft {
+		post.permalinks = append(post.permalinks, permalink)
+		// aliases 是 Hugo 为旧地址生成的跳转页面，同样需要跳转到新地址
+		for _, alias := range fm.list("", "aliases") {
+			if !strings.HasPrefix(alias, "/") {
+				alias = path.Join(path.Dir(strings.TrimSuffix(permalink, "/")), alias)
+			} else {
+				alias = site.basePath + alias
+			}
+			post.permalinks = append(post.permalinks, cleanURLPath(alias))
+		}
+	}
+
+	convertShortcodes(post, hugoShortcodes)
+	return post, nil
+}
+
+// figure 转换为 markdown 图片，其他 shortcode 保留原样
+var hugoShortcodes = map[string]tagHandler{
+	"figure": func(args string) (string, bool) {
+		positional, named := shortcodeArgs(args)
+		src := named["src"]
+		if src == "" && len(positional) > 0 {
+			src = positional[0]
+		}
+		if src == "" {
+			return "", false
+		}
+		title := stringOr(named["title"], named["caption"])
+		return markdownImage(stringOr(named["alt"], title), src, title), true
+	},
+}
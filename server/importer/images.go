@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownImageRegex = regexp.MustCompile(`!\[[^\]]*\]\(\s*(<[^>]+>|[^)\s]+)(?:\s+"[^"]*")?\s*\)`)
+	htmlImageRegex     = regexp.MustCompile(`(?i)<img\s[^>]*?src\s*=\s*["']([^"']+)["']`)
+)
+
+// 保存文章引用的本地图片并改写引用地址，外部图片保持不变，找不到的图片记录在报告中
+func (im *importer) importImages(src *sourcePost) string {
+	rewrite := func(ref string) string {
+		path, local := im.resolveImage(strings.Trim(ref, "<>"), src)
+		if !local {
+			return ref
+		}
+		if path == "" {
+			src.warn("找不到图片: %s", ref)
+			return ref
+		}
+		saved, err := im.saveImage(path)
+		if err != nil {
+			src.warn("图片 %s 保存失败: %v", ref, err)
+			return ref
+		}
+		if saved == "" {
+			return ref
+		}
+		return saved
+	}
+	content := replaceGroup(markdownImageRegex, src.content, rewrite)
+	content = replaceGroup(htmlImageRegex, content, rewrite)
+	return content
+}
+
+// 查找图片对应的源文件；local 为 false 表示外部图片，找不到文件时 path 为空
+func (im *importer) resolveImage(ref string, src *sourcePost) (path string, local bool) {
+	if im.site.baseURL != "" && strings.HasPrefix(ref, im.site.baseURL) {
+		ref = "/" + strings.TrimPrefix(strings.TrimPrefix(ref, im.site.baseURL), "/")
+	}
+	if strings.Contains(ref, "://") || strings.HasPrefix(ref, "//") || strings.HasPrefix(ref, "data:") {
+		return "", false
+	}
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref = ref[:i]
+	}
+	if unescaped, err := url.PathUnescape(ref); err == nil {
+		ref = unescaped
+	}
+
+	var candidates []string
+	if strings.HasPrefix(ref, "/") {
+		refs := []string{ref}
+		if im.site.basePath != "" && strings.HasPrefix(ref, im.site.basePath+"/") {
+			refs = append(refs, strings.TrimPrefix(ref, im.site.basePath))
+		}
+		for _, dir := range im.site.staticDirs {
+			for _, r := range refs {
+				candidates = append(candidates, filepath.Join(dir, filepath.FromSlash(r)))
+			}
+		}
+	} else {
+		for _, dir := range src.assetDirs {
+			candidates = append(candidates, filepath.Join(dir, filepath.FromSlash(ref)))
+		}
+	}
+
+	root, _ := filepath.Abs(im.site.root)
+	for _, candidate := range candidates {
+		abs, err := filepath.Abs(candidate)
+		if err != nil || !strings.HasPrefix(abs, root+string(filepath.Separator)) {
+			continue
+		}
+		if info, err := os.Stat(abs); err == nil && info.Mode().IsRegular() {
+			return abs, true
+		}
+	}
+	return "", true
+}
+
+// 同一个源文件只保存一次；预览时不保存，保留原地址
+func (im *importer) saveImage(path string) (string, error) {
+	if saved, ok := im.images[path]; ok {
+		return saved, nil
+	}
+	if im.opts.DryRun || im.opts.SaveImage == nil {
+		im.images[path] = ""
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	saved, err := im.opts.SaveImage(filepath.Base(path), data)
+	if err != nil {
+		return "", err
+	}
+	im.images[path] = saved
+	return saved, nil
+}
+
+// 替换每个匹配中第一个分组的内容
+func replaceGroup(re *regexp.Regexp, s string, fn func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(s[last:m[2]])
+		b.WriteString(fn(s[m[2]:m[3]]))
+		last = m[3]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
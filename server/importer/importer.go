@@ -0,0 +1,446 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"server/config"
+	"server/models"
+	"server/repository"
+)
+
+// 支持的源站点格式
+const (
+	FormatHexo      = "hexo"
+	FormatHugo      = "hugo"
+	FormatJekyll    = "jekyll"
+	FormatWordPress = "wordpress"
+)
+
+// 导入选项
+type Options struct {
+	// 源站点目录，WordPress 为导出的 WXR 文件
+	Source string
+	// 源站点格式，为空时自动识别
+	Format string
+	// 只生成报告，不写入文章和图片
+	DryRun bool
+	// 同时导入草稿，草稿只有作者可以看到，发布后才公开显示
+	IncludeDrafts bool
+	// WordPress 的 wp-content/uploads 目录，文章引用的附件从这里读取
+	Uploads string
+	// 只导入这些 WordPress 用户的文章，为空时导入所有文章
+	Authors []string
+	// 保存图片，返回写入文章的图片路径
+	SaveImage func(name string, data []byte) (string, error)
+	// 把图片集保存为照片
+	CreatePhoto func(photo models.Photo) error
+}
+
+// 导入报告
+type Report struct {
+	Source    string       `json:"source"`
+	Format    string       `json:"format"`
+	DryRun    bool         `json:"dry_run"`
+	Imported  []ReportItem `json:"imported"`
+	Skipped   []ReportItem `json:"skipped"`
+	Warnings  []ReportItem `json:"warnings"`
+	Images    int          `json:"images"`
+	Photos    int          `json:"photos"`
+	Redirects []Redirect   `json:"redirects"`
+}
+
+// 报告中的一篇文章；File 为相对源站点目录的文件路径，Author 为 WordPress 的原作者
+type ReportItem struct {
+	File    string `json:"file"`
+	PostID  string `json:"post_id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Author  string `json:"author,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// 旧地址到新文章地址的跳转
+type Redirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// 从源站点读取的文章，各格式的读取结果统一为这种结构后再导入
+type sourcePost struct {
+	file string
+	// 相对路径的图片在这些目录中查找
+	assetDirs  []string
+	title      string
+	summary    string
+	content    string
+	date       time.Time
+	updated    time.Time
+	categories []string
+	tags       []string
+	draft      bool
+	// 私密文章，即使导入草稿也不导入
+	private bool
+	// 草稿未导入时报告中的说明
+	draftNote string
+	author    string
+	// 文章中的图片集，导入为照片
+	galleries [][]galleryImage
+	// 文章在旧站点的地址
+	permalinks []string
+	warnings   []string
+}
+
+func (p *sourcePost) warn(format string, args ...any) {
+	p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+}
+
+// 没有日期时使用文件修改时间
+func (p *sourcePost) fallbackDate(path string) error {
+	if !p.date.IsZero() {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	p.date = info.ModTime()
+	p.warn("没有日期，使用文件修改时间")
+	return nil
+}
+
+type sourceSite struct {
+	root string
+	// 以 / 开头的图片地址在这些目录中查找
+	staticDirs []string
+	// 旧站点的地址和路径前缀，指向旧站点的图片按本地图片处理
+	baseURL  string
+	basePath string
+	posts    []*sourcePost
+	// 无法作为文章导入的文件
+	skipped []ReportItem
+}
+
+type importer struct {
+	opts   Options
+	site   *sourceSite
+	report *Report
+	loc    *time.Location
+	// 已保存的图片，源文件路径到新路径
+	images map[string]string
+	// 照片中的图片会被加水印，与文章中的图片分开保存
+	photoImages map[string]string
+	ids         map[string]bool
+}
+
+// 导入 Hexo、Hugo 或 Jekyll 站点的文章，已存在的文章跳过，转换中丢失的内容记录在报告中
+func Import(opts Options) (*Report, error) {
+	format := opts.Format
+	if format == "" {
+		detected, err := DetectFormat(opts.Source)
+		if err != nil {
+			return nil, err
+		}
+		format = detected
+	}
+
+	var site *sourceSite
+	var err error
+	switch format {
+	case FormatHexo:
+		site, err = readHexo(opts.Source)
+	case FormatHugo:
+		site, err = readHugo(opts.Source)
+	case FormatJekyll:
+		site, err = readJekyll(opts.Source)
+	case FormatWordPress:
+		site, err = readWordPress(opts)
+	default:
+		return nil, fmt.Errorf("不支持的格式: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Source:    opts.Source,
+		Format:    format,
+		DryRun:    opts.DryRun,
+		Imported:  []ReportItem{},
+		Skipped:   append([]ReportItem{}, site.skipped...),
+		Warnings:  []ReportItem{},
+		Redirects: []Redirect{},
+	}
+	im := &importer{
+		opts:        opts,
+		site:        site,
+		report:      report,
+		loc:         targetLocation(),
+		images:      map[string]string{},
+		photoImages: map[string]string{},
+		ids:         map[string]bool{},
+	}
+	for _, post := range site.posts {
+		if err := im.importPost(post); err != nil {
+			return report, fmt.Errorf("导入 %s 失败: %w", post.file, err)
+		}
+	}
+	report.Images = len(im.images) + len(im.photoImages)
+	return report, nil
+}
+
+// 按目录结构识别源站点格式，文件按 WordPress 导出文件处理
+func DetectFormat(dir string) (string, error) {
+	switch {
+	case isWXRFile(dir):
+		return FormatWordPress, nil
+	case isDir(filepath.Join(dir, "source", "_posts")):
+		return FormatHexo, nil
+	case isDir(filepath.Join(dir, "_posts")) || isDir(filepath.Join(dir, "_drafts")):
+		return FormatJekyll, nil
+	case hugoConfigFile(dir) != "":
+		return FormatHugo, nil
+	}
+	return "", fmt.Errorf("无法识别 %s 的站点格式，请指定格式", dir)
+}
+
+func (im *importer) importPost(src *sourcePost) error {
+	item := ReportItem{File: src.file, Title: src.title, Author: src.author}
+	if src.private || (src.draft && !im.opts.IncludeDrafts) {
+		item.Message = stringOr(src.draftNote, "草稿未导入")
+		im.report.Skipped = append(im.report.Skipped, item)
+		return nil
+	}
+
+	if src.title == "" {
+		src.title = titleFromFile(src.file)
+		src.warn("没有标题，使用文件名作为标题")
+	}
+	src.title = singleLine(src.title)
+	item.Title = src.title
+
+	created := src.date.In(im.loc)
+	id := repository.NewPostID(created, src.title)
+	item.PostID = id
+	if im.ids[id] {
+		item.Message = "与本次导入的其他文章 ID 相同"
+		im.report.Skipped = append(im.report.Skipped, item)
+		return nil
+	}
+	if _, err := repository.Posts.Get(id); err == nil {
+		item.Message = "文章已存在"
+		im.report.Skipped = append(im.report.Skipped, item)
+		return nil
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	im.ids[id] = true
+
+	post := models.Post{
+		ID:      id,
+		Title:   src.title,
+		Summary: singleLine(src.summary),
+		Created: created.Format("2006-01-02 15:04"),
+		Updated: created.Format("2006-01-02 15:04"),
+		Tags:    []string{},
+	}
+	if !src.updated.IsZero() {
+		post.Updated = src.updated.In(im.loc).Format("2006-01-02 15:04")
+	}
+	// 只能有一个分类，多出的分类转为标签
+	var extraCategories []string
+	if len(src.categories) > 0 {
+		post.Category = singleLine(src.categories[0])
+		extraCategories = src.categories[1:]
+	}
+	if len(extraCategories) > 0 {
+		src.warn("只保留第一个分类 %s，其余分类转为标签: %s", post.Category, strings.Join(extraCategories, ", "))
+	}
+	seen := map[string]bool{}
+	for _, tag := range append(append([]string{}, extraCategories...), src.tags...) {
+		tag = singleLine(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			post.Tags = append(post.Tags, tag)
+		}
+	}
+
+	post.Content = im.importImages(src)
+	// 文章没有作者字段，原作者写入 frontmatter 的 author 中保留
+	if author := singleLine(src.author); author != "" {
+		post.Extra = "author: " + author
+	}
+	if src.draft {
+		repository.SetDraft(&post, true)
+	}
+
+	if !im.opts.DryRun {
+		if err := repository.Posts.Create(post); errors.Is(err, repository.ErrExists) {
+			item.Message = "文章已存在"
+			im.report.Skipped = append(im.report.Skipped, item)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	im.report.Imported = append(im.report.Imported, item)
+	if src.draft && len(src.galleries) > 0 {
+		src.warn("草稿中的 %d 个图片集未导入为照片", len(src.galleries))
+		src.galleries = nil
+	}
+	for i, images := range src.galleries {
+		if err := im.importGallery(src, post, i, images); err != nil {
+			return err
+		}
+	}
+
+	to := "/blog/" + url.PathEscape(id)
+	seenPaths := map[string]bool{}
+	for _, permalink := range src.permalinks {
+		from := (&url.URL{Path: permalink}).EscapedPath()
+		if from == "" || from == to || seenPaths[from] {
+			continue
+		}
+		seenPaths[from] = true
+		im.report.Redirects = append(im.report.Redirects, Redirect{From: from, To: to})
+	}
+	for _, warning := range src.warnings {
+		im.report.Warnings = append(im.report.Warnings, ReportItem{File: src.file, PostID: id, Title: src.title, Author: src.author, Message: warning})
+	}
+	return nil
+}
+
+func (s *sourceSite) rel(path string) string {
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (s *sourceSite) skip(path, message string) {
+	s.skipped = append(s.skipped, ReportItem{File: s.rel(path), Message: message})
+}
+
+// 遍历目录中的 markdown 文件，目录不存在时不做任何事
+func walkMarkdown(dir string, fn func(path string) error) error {
+	if !isDir(dir) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isMarkdown(d.Name()) {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// 文章中的图片集导入为一张照片，分类、标签和日期与文章相同
+func (im *importer) importGallery(src *sourcePost, post models.Post, index int, images []galleryImage) error {
+	photo := models.Photo{
+		Title:       post.Title,
+		Description: post.Summary,
+		Category:    post.Category,
+		Tags:        post.Tags,
+		Created:     src.date.In(im.loc).Format("2006-01-02"),
+	}
+	if len(src.galleries) > 1 {
+		photo.Title = fmt.Sprintf("%s (%d)", post.Title, index+1)
+	}
+	seen := map[string]bool{}
+	for _, image := range images {
+		path, local := im.resolveImage(image.src, src)
+		if !local || path == "" {
+			src.warn("图片集中的图片无法导入: %s", image.src)
+			continue
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		saved, ok := im.photoImages[path]
+		if !ok && !im.opts.DryRun {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if saved, err = im.opts.SaveImage(filepath.Base(path), data); err != nil {
+				src.warn("图片 %s 保存失败: %v", image.src, err)
+				continue
+			}
+		}
+		im.photoImages[path] = saved
+		photo.Images = append(photo.Images, models.PhotoImage{URL: saved, Alt: image.alt, Caption: image.caption})
+	}
+	if len(photo.Images) == 0 {
+		return nil
+	}
+	if !im.opts.DryRun && im.opts.CreatePhoto != nil {
+		if err := im.opts.CreatePhoto(photo); err != nil {
+			return fmt.Errorf("保存照片失败: %w", err)
+		}
+	}
+	im.report.Photos++
+	return nil
+}
+
+// 文章时间统一转换到配置的时区
+func targetLocation() *time.Location {
+	loc, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return time.FixedZone("CST", 8*3600)
+	}
+	return loc
+}
+
+// 源站点配置的时区，没有配置时按目标时区解释没有时区的日期
+func siteLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return targetLocation(), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("无法识别源站点的时区 %s: %w", name, err)
+	}
+	return loc, nil
+}
+
+// frontmatter 中的标题、摘要等字段只能占一行
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func titleFromFile(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if name == "index" {
+		name = filepath.Base(filepath.Dir(file))
+	}
+	return strings.ReplaceAll(name, "-", " ")
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func isMarkdown(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", ".mdown", ".mkd":
+		return true
+	}
+	return false
+}
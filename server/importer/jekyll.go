@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Jekyll 内置的固定链接格式
+var jekyllPermalinkStyles = map[string]string{
+	"date":    "/:categories/:year/:month/:day/:title:output_ext",
+	"pretty":  "/:categories/:year/:month/:day/:title/",
+	"ordinal": "/:categories/:year/:y_day/:title:output_ext",
+	"none":    "/:categories/:title:output_ext",
+}
+
+// 文章文件名为 YYYY-MM-DD-title.md
+var jekyllPostNameRegex = regexp.MustCompile(`^(\d{4}-\d{1,2}-\d{1,2})-(.+)$`)
+
+// Jekyll 站点：文章在任意层级的 _posts 目录，上级目录名即分类；草稿在 _drafts，配置在 _config.yml
+func readJekyll(root string) (*sourceSite, error) {
+	cfg, err := readConfig(filepath.Join(root, "_config.yml"))
+	if err != nil {
+		return nil, err
+	}
+	loc, err := siteLocation(cfg.text("timezone"))
+	if err != nil {
+		return nil, err
+	}
+	basePath := strings.TrimRight(cfg.text("baseurl"), "/")
+	site := &sourceSite{
+		root:       root,
+		staticDirs: []string{root},
+		baseURL:    strings.TrimRight(cfg.text("url"), "/") + basePath,
+		basePath:   basePath,
+	}
+
+	var postDirs []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == root {
+			return nil
+		}
+		switch name := d.Name(); {
+		case name == "_posts":
+			postDirs = append(postDirs, path)
+			return filepath.SkipDir
+		case name == "_drafts" && filepath.Dir(path) == root:
+			postDirs = append(postDirs, path)
+			return filepath.SkipDir
+		case name == "_site" || name == "node_modules" || name == "vendor" || strings.HasPrefix(name, "."):
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, postsDir := range postDirs {
+		draft := filepath.Base(postsDir) == "_drafts"
+		// _posts 的上级目录依次作为分类
+		var dirCategories []string
+		if rel, err := filepath.Rel(root, filepath.Dir(postsDir)); err == nil && rel != "." {
+			dirCategories = strings.Split(filepath.ToSlash(rel), "/")
+		}
+		err := walkMarkdown(postsDir, func(path string) error {
+			post, err := readJekyllPost(site, cfg, loc, path, draft, dirCategories)
+			if err != nil {
+				site.skip(path, err.Error())
+				return nil
+			}
+			site.posts = append(site.posts, post)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return site, nil
+}
+
+func readJekyllPost(site *sourceSite, cfg frontMatter, loc *time.Location, path string, draft bool, dirCategories []string) (*sourcePost, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	slug := name
+	var fileDate time.Time
+	if m := jekyllPostNameRegex.FindStringSubmatch(name); m != nil {
+		t, err := time.ParseInLocation("2006-1-2", m[1], loc)
+		if err != nil {
+			return nil, fmt.Errorf("文件名中的日期无效: %s", m[1])
+		}
+		fileDate, slug = t, m[2]
+	} else if !draft {
+		return nil, fmt.Errorf("文件名不是 YYYY-MM-DD-title 格式，Jekyll 不会发布这篇文章")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fm, body, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, err
+	}
+
+	post := &sourcePost{
+		file:       site.rel(path),
+		title:      stringOr(fm.text("title"), titleize(slug)),
+		summary:    fm.text("excerpt", "description"),
+		content:    body,
+		date:       fileDate,
+		draft:      draft,
+		categories: append(append([]string{}, dirCategories...), fm.list(" ", "categories")...),
+		tags:       fm.list(" ", "tags"),
+		assetDirs:  []string{filepath.Dir(path), site.root},
+	}
+	post.categories = append(post.categories, fm.list("", "category")...)
+	post.tags = append(post.tags, fm.list("", "tag")...)
+	if published, ok := fm.flag("published"); ok && !published {
+		post.draft = true
+	}
+	if date, ok, err := fm.date(loc, "date"); err != nil {
+		post.warn("%v", err)
+	} else if ok {
+		post.date = date
+	}
+	if post.updated, _, err = fm.date(loc, "last_modified_at", "updated", "modified"); err != nil {
+		post.warn("%v", err)
+	}
+	if err := post.fallbackDate(path); err != nil {
+		return nil, err
+	}
+
+	if !post.draft {
+		pattern := stringOr(fm.text("permalink"), stringOr(cfg.text("permalink"), "date"))
+		if style, ok := jekyllPermalinkStyles[pattern]; ok {
+			pattern = style
+		}
+		var categories []string
+		for _, category := range post.categories {
+			categories = append(categories, strings.ToLower(category))
+		}
+		vars := map[string]string{
+			"title":      stringOr(fm.text("slug"), slug),
+			"slug":       slugize(stringOr(fm.text("slug"), slug), true),
+			"categories": strings.Join(categories, "/"),
+			"output_ext": ".html",
+		}
+		t := post.date.In(loc)
+		dateVars(vars, t)
+		vars["y_day"] = fmt.Sprintf("%03d", t.YearDay())
+		post.permalinks = append(post.permalinks, expandPermalink(site.basePath+pattern, vars))
+	}
+
+	convertLiquid(post, nil, jekyllOutput)
+	return post, nil
+}
+
+var jekyllFilterRegex = regexp.MustCompile(`^["']([^"']*)["']\s*\|\s*(?:relative_url|absolute_url)$`)
+
+// 站点地址和 relative_url 过滤器转换为根路径，其他输出保留原样
+func jekyllOutput(expr string) (string, bool) {
+	switch expr {
+	case "site.baseurl", "site.url":
+		return "", true
+	}
+	if m := jekyllFilterRegex.FindStringSubmatch(expr); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// 文件名中的标题转换为 Jekyll 默认的文章标题: my-first-post -> My First Post
+func titleize(slug string) string {
+	words := strings.FieldsFunc(slug, func(r rune) bool { return r == '-' || r == '_' || unicode.IsSpace(r) })
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
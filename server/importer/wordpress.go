@@ -0,0 +1,464 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WordPress 导出文件（WXR）中用到的字段，标签不带命名空间以兼容各版本的导出格式
+type wxrFile struct {
+	Channel struct {
+		Authors []wxrAuthor `xml:"author"`
+		Items   []wxrItem   `xml:"item"`
+	} `xml:"channel"`
+}
+
+type wxrAuthor struct {
+	Login       string `xml:"author_login"`
+	DisplayName string `xml:"author_display_name"`
+}
+
+type wxrItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	Creator string `xml:"creator"`
+	// content:encoded 为正文，excerpt:encoded 为摘要
+	Encoded       []wxrEncoded  `xml:"encoded"`
+	ID            int           `xml:"post_id"`
+	Date          string        `xml:"post_date"`
+	DateGMT       string        `xml:"post_date_gmt"`
+	Modified      string        `xml:"post_modified"`
+	ModifiedGMT   string        `xml:"post_modified_gmt"`
+	Status        string        `xml:"status"`
+	Parent        int           `xml:"post_parent"`
+	MenuOrder     int           `xml:"menu_order"`
+	Type          string        `xml:"post_type"`
+	AttachmentURL string        `xml:"attachment_url"`
+	Categories    []wxrCategory `xml:"category"`
+	Meta          []wxrMeta     `xml:"postmeta"`
+}
+
+type wxrEncoded struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type wxrCategory struct {
+	Domain   string `xml:"domain,attr"`
+	Nicename string `xml:"nicename,attr"`
+	Name     string `xml:",chardata"`
+}
+
+type wxrMeta struct {
+	Key   string `xml:"meta_key"`
+	Value string `xml:"meta_value"`
+}
+
+func (item *wxrItem) content() string {
+	for _, e := range item.Encoded {
+		if strings.Contains(e.XMLName.Space, "purl.org/rss/1.0/modules/content") {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+func (item *wxrItem) excerpt() string {
+	for _, e := range item.Encoded {
+		if strings.Contains(e.XMLName.Space, "excerpt") {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+func (item *wxrItem) meta(key string) string {
+	for _, m := range item.Meta {
+		if m.Key == key {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+const wxrUploadsPath = "/wp-content/uploads/"
+
+var (
+	galleryShortcodeRegex = regexp.MustCompile(`\[gallery([^\]]*)\]`)
+	captionShortcodeRegex = regexp.MustCompile(`(?s)\[caption([^\]]*)\](.*?)\[/caption\]`)
+	captionImageRegex     = regexp.MustCompile(`(?s)^\s*((?:<a[^>]*>\s*)?<img[^>]*>(?:\s*</a>)?)(.*)$`)
+	embedShortcodeRegex   = regexp.MustCompile(`(?s)\[embed[^\]]*\](.*?)\[/embed\]`)
+	shortcodeAttrRegex    = regexp.MustCompile(`([\w-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|(\S+))`)
+	wpShortcodeRegex      = regexp.MustCompile(`\[([a-z][\w-]*)(\s[^\]]*)?\]`)
+	// WordPress 生成的缩略图文件名带有尺寸后缀: photo-300x200.jpg
+	resizedImageRegex = regexp.MustCompile(`-\d+x\d+(\.\w+)$`)
+	blockStartRegex   = regexp.MustCompile(`(?i)^(<(p|div|h[1-6]|ul|ol|li|dl|blockquote|pre|table|figure|hr|address|form|section|article|aside|header|footer|nav|iframe|video|audio|object|embed|script|style)\b|<!--|\x00)`)
+	paragraphRegex    = regexp.MustCompile(`\n\s*\n`)
+	lineBreakRegex    = regexp.MustCompile(`([^>\n])\n([^<\n])`)
+	preRegex          = regexp.MustCompile(`(?is)<pre[\s>].*?</pre>`)
+)
+
+type wxrReader struct {
+	opts    Options
+	file    string
+	uploads string
+	authors map[string]string
+	// 附件 ID 到附件，以及每篇文章的附件
+	attachments map[int]*wxrItem
+	children    map[int][]*wxrItem
+	// 站点时间与 UTC 的时差，从同时带有本地时间和 GMT 时间的文章推算
+	offset *time.Location
+}
+
+// WordPress：读取 WXR 文件中的文章，附件从本地的 uploads 目录读取
+func readWordPress(opts Options) (*sourceSite, error) {
+	f, err := os.Open(opts.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var export wxrFile
+	decoder := xml.NewDecoder(f)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	if err := decoder.Decode(&export); err != nil {
+		return nil, fmt.Errorf("解析 WordPress 导出文件失败: %w", err)
+	}
+
+	r := &wxrReader{
+		opts:        opts,
+		file:        filepath.Base(opts.Source),
+		uploads:     opts.Uploads,
+		authors:     map[string]string{},
+		attachments: map[int]*wxrItem{},
+		children:    map[int][]*wxrItem{},
+	}
+	for _, author := range export.Channel.Authors {
+		r.authors[author.Login] = stringOr(author.DisplayName, author.Login)
+	}
+	items := export.Channel.Items
+	for i := range items {
+		item := &items[i]
+		if item.Type == "attachment" {
+			r.attachments[item.ID] = item
+			r.children[item.Parent] = append(r.children[item.Parent], item)
+		}
+		if r.offset == nil {
+			r.offset = siteOffset(item)
+		}
+	}
+	for _, list := range r.children {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].MenuOrder < list[j].MenuOrder })
+	}
+	if r.offset == nil {
+		r.offset = targetLocation()
+	}
+
+	site := &sourceSite{root: filepath.Dir(opts.Source)}
+	if r.uploads != "" {
+		if !isDir(r.uploads) {
+			return nil, fmt.Errorf("找不到附件目录 %s", r.uploads)
+		}
+		site.root = r.uploads
+		site.staticDirs = []string{r.uploads}
+	}
+	for i := range items {
+		item := &items[i]
+		file := fmt.Sprintf("%s#%d", r.file, item.ID)
+		switch item.Type {
+		case "post":
+		case "page":
+			site.skipped = append(site.skipped, ReportItem{File: file, Title: html.UnescapeString(item.Title), Message: "页面不导入"})
+			continue
+		default:
+			continue
+		}
+		switch item.Status {
+		case "auto-draft", "inherit":
+			continue
+		case "trash":
+			site.skipped = append(site.skipped, ReportItem{File: file, Title: html.UnescapeString(item.Title), Message: "回收站中的文章不导入"})
+			continue
+		}
+		author := stringOr(r.authors[item.Creator], item.Creator)
+		if len(opts.Authors) > 0 && !containsString(opts.Authors, item.Creator) {
+			site.skipped = append(site.skipped, ReportItem{File: file, Title: html.UnescapeString(item.Title), Author: author, Message: "不是指定作者的文章"})
+			continue
+		}
+		post, err := r.readPost(item, file, author)
+		if err != nil {
+			site.skipped = append(site.skipped, ReportItem{File: file, Title: html.UnescapeString(item.Title), Author: author, Message: err.Error()})
+			continue
+		}
+		site.posts = append(site.posts, post)
+	}
+	return site, nil
+}
+
+func (r *wxrReader) readPost(item *wxrItem, file, author string) (*sourcePost, error) {
+	post := &sourcePost{
+		file:    file,
+		title:   html.UnescapeString(strings.TrimSpace(item.Title)),
+		summary: htmlText(item.excerpt()),
+		author:  author,
+	}
+	switch item.Status {
+	case "publish":
+	case "future":
+		post.warn("定时发布的文章，导入后立即显示")
+	case "private":
+		post.private, post.draftNote = true, "私密文章未导入"
+	default:
+		post.draft, post.draftNote = true, fmt.Sprintf("%s 状态的文章按草稿处理，未导入", item.Status)
+	}
+
+	var ok bool
+	if post.date, ok = r.time(item.Date, item.DateGMT); !ok {
+		if post.date, ok = r.time(item.Modified, item.ModifiedGMT); !ok {
+			return nil, fmt.Errorf("没有日期")
+		}
+		post.warn("没有发布日期，使用修改时间")
+	}
+	if updated, ok := r.time(item.Modified, item.ModifiedGMT); ok && updated.After(post.date) {
+		post.updated = updated
+	}
+
+	for _, category := range item.Categories {
+		name := html.UnescapeString(strings.TrimSpace(category.Name))
+		switch category.Domain {
+		case "category":
+			// 默认分类没有实际意义
+			if category.Nicename != "uncategorized" {
+				post.categories = append(post.categories, name)
+			}
+		case "post_tag":
+			post.tags = append(post.tags, name)
+		}
+	}
+
+	converter := &htmlConverter{
+		imageSrc: r.uploadRef,
+		attachments: func(ids string) []galleryImage {
+			return r.galleryImages(item, ids, post)
+		},
+	}
+	content := r.convertShortcodes(item.content(), post)
+	if !strings.Contains(content, "<!-- wp:") {
+		// 经典编辑器的正文用空行分段，显示时才由 WordPress 转换为段落
+		content = autop(content)
+	}
+	markdown, err := converter.convert(content)
+	if err != nil {
+		return nil, err
+	}
+	post.content = markdown
+	post.galleries = converter.galleries
+	post.warnings = append(post.warnings, converter.warnings...)
+	if strings.Contains(markdown, wxrUploadsPath) {
+		post.warn("文章仍链接到旧站点的附件")
+	}
+
+	// 特色图片没有对应的字段，不在正文中时提示
+	if id := item.meta("_thumbnail_id"); id != "" {
+		thumbnail := r.attachment(id)
+		if thumbnail != nil && !strings.Contains(markdown, r.uploadRef(thumbnail.AttachmentURL)) {
+			post.warn("特色图片未导入: %s", thumbnail.AttachmentURL)
+		}
+	}
+
+	if !post.draft {
+		if u, err := url.Parse(item.Link); err == nil && u.Path != "" && u.Path != "/" && u.RawQuery == "" {
+			post.permalinks = append(post.permalinks, u.Path)
+		}
+	}
+	return post, nil
+}
+
+// 图片集、图片说明和嵌入等 shortcode 先转换为 HTML，其他 shortcode 保留原样
+func (r *wxrReader) convertShortcodes(content string, post *sourcePost) string {
+	content = galleryShortcodeRegex.ReplaceAllStringFunc(content, func(code string) string {
+		attrs := shortcodeAttrs(galleryShortcodeRegex.FindStringSubmatch(code)[1])
+		return fmt.Sprintf(`<div class="wxr-gallery" data-ids="%s"></div>`, html.EscapeString(attrs["ids"]))
+	})
+	content = captionShortcodeRegex.ReplaceAllStringFunc(content, func(code string) string {
+		m := captionShortcodeRegex.FindStringSubmatch(code)
+		image, caption := m[2], shortcodeAttrs(m[1])["caption"]
+		if parts := captionImageRegex.FindStringSubmatch(m[2]); parts != nil {
+			image, caption = parts[1], stringOr(strings.TrimSpace(parts[2]), caption)
+		}
+		return "<figure>" + image + "<figcaption>" + caption + "</figcaption></figure>"
+	})
+	content = embedShortcodeRegex.ReplaceAllStringFunc(content, func(code string) string {
+		u := strings.TrimSpace(embedShortcodeRegex.FindStringSubmatch(code)[1])
+		return fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(u), html.EscapeString(u))
+	})
+	seen := map[string]bool{}
+	for _, m := range wpShortcodeRegex.FindAllStringSubmatch(content, -1) {
+		if seen[m[1]] {
+			continue
+		}
+		// 带参数或有结束标记的才是 shortcode，避免把 [1] 之类的文字当作 shortcode
+		if strings.Contains(m[2], "=") || strings.Contains(content, "[/"+m[1]+"]") {
+			seen[m[1]] = true
+			post.warn("未转换的 shortcode: [%s]", m[1])
+		}
+	}
+	return content
+}
+
+// [gallery ids="1,2"] 中的图片；没有 ids 时为文章的所有图片附件
+func (r *wxrReader) galleryImages(item *wxrItem, ids string, post *sourcePost) []galleryImage {
+	var attachments []*wxrItem
+	if strings.TrimSpace(ids) == "" {
+		attachments = r.children[item.ID]
+	} else {
+		for _, id := range strings.Split(ids, ",") {
+			found := r.attachment(id)
+			if found == nil {
+				post.warn("图片集中的附件 %s 不在导出文件中", strings.TrimSpace(id))
+				continue
+			}
+			attachments = append(attachments, found)
+		}
+	}
+	var images []galleryImage
+	for _, attachment := range attachments {
+		if !isImageURL(attachment.AttachmentURL) {
+			continue
+		}
+		images = append(images, galleryImage{
+			src:     r.uploadRef(attachment.AttachmentURL),
+			alt:     attachment.meta("_wp_attachment_image_alt"),
+			caption: htmlText(attachment.excerpt()),
+		})
+	}
+	return images
+}
+
+func (r *wxrReader) attachment(id string) *wxrItem {
+	n, err := strconv.Atoi(strings.TrimSpace(id))
+	if err != nil {
+		return nil
+	}
+	return r.attachments[n]
+}
+
+// 指定了附件目录时，uploads 中的文件改为相对附件目录的地址，缩略图不存在时使用原图
+func (r *wxrReader) uploadRef(src string) string {
+	i := strings.Index(src, wxrUploadsPath)
+	if r.uploads == "" || i < 0 {
+		return src
+	}
+	rest := src[i+len(wxrUploadsPath):]
+	if j := strings.IndexAny(rest, "?#"); j >= 0 {
+		rest = rest[:j]
+	}
+	if unescaped, err := url.PathUnescape(rest); err == nil {
+		rest = unescaped
+	}
+	if _, err := os.Stat(filepath.Join(r.uploads, filepath.FromSlash(rest))); err != nil {
+		original := resizedImageRegex.ReplaceAllString(rest, "$1")
+		if _, err := os.Stat(filepath.Join(r.uploads, filepath.FromSlash(original))); err == nil {
+			rest = original
+		}
+	}
+	return (&url.URL{Path: "/" + rest}).EscapedPath()
+}
+
+// WXR 中的本地时间没有时区，优先使用 GMT 时间
+func (r *wxrReader) time(local, gmt string) (time.Time, bool) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", gmt, time.UTC); err == nil && t.Year() > 1 {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", local, r.offset); err == nil && t.Year() > 1 {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// 由文章的本地时间和 GMT 时间推算站点时区
+func siteOffset(item *wxrItem) *time.Location {
+	local, err := time.Parse("2006-01-02 15:04:05", item.Date)
+	if err != nil || local.Year() <= 1 {
+		return nil
+	}
+	gmt, err := time.Parse("2006-01-02 15:04:05", item.DateGMT)
+	if err != nil || gmt.Year() <= 1 {
+		return nil
+	}
+	offset := local.Sub(gmt)
+	return time.FixedZone(fmt.Sprintf("UTC%+.1f", offset.Hours()), int(offset.Seconds()))
+}
+
+// 模拟 WordPress 的 wpautop：空行分段，段落中的换行转为 <br>，pre 中的内容不变
+func autop(content string) string {
+	var pres []string
+	content = preRegex.ReplaceAllStringFunc(strings.ReplaceAll(content, "\r\n", "\n"), func(pre string) string {
+		pres = append(pres, pre)
+		return fmt.Sprintf("\x00%d\x00", len(pres)-1)
+	})
+	paragraphs := paragraphRegex.Split(content, -1)
+	for i, p := range paragraphs {
+		p = strings.TrimSpace(p)
+		if p == "" || blockStartRegex.MatchString(p) {
+			paragraphs[i] = p
+			continue
+		}
+		paragraphs[i] = "<p>" + lineBreakRegex.ReplaceAllString(p, "$1<br>\n$2") + "</p>"
+	}
+	return restore(strings.Join(paragraphs, "\n\n"), pres)
+}
+
+func shortcodeAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range shortcodeAttrRegex.FindAllStringSubmatch(s, -1) {
+		attrs[m[1]] = m[2] + m[3] + m[4]
+	}
+	return attrs
+}
+
+// HTML 片段中的纯文本，用于摘要和图片说明
+func htmlText(s string) string {
+	nodes, err := parseHTML(s)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	var parts []string
+	for _, node := range nodes {
+		parts = append(parts, textContent(node))
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+func isWXRFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 4096)
+	n, _ := f.Read(head)
+	return strings.Contains(string(head[:n]), "wordpress.org/export/")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch = errors.New("无效的补丁")
+	ErrPathNotFound = errors.New("路径不存在")
+	ErrTestFailed   = errors.New("test 操作未通过")
+)
+
+// 补丁的 Content-Type
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// 按 RFC 7396 JSON Merge Patch 合并，补丁中的 null 表示删除字段
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergeValue(t[key], value)
+	}
+	return t
+}
+
+// JSON Patch 中的一个操作；Value 为空表示没有 value，显式的 null 保留为 "null"
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// 按 RFC 6902 JSON Patch 依次执行操作，任一操作失败时整个补丁不生效
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if root, err = applyOperation(root, op); err != nil {
+			return nil, fmt.Errorf("第 %d 个操作 %s %s: %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func applyOperation(root any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: 缺少 value", ErrInvalidPatch)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+			if root, err = remove(root, path); err != nil {
+				return nil, err
+			}
+			return add(root, path, value)
+		default:
+			current, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(normalize(current), normalize(value)) {
+				return nil, ErrTestFailed
+			}
+			return root, nil
+		}
+	case "remove":
+		return remove(root, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("%w: 不能移动到自身的子路径", ErrInvalidPatch)
+			}
+			if root, err = remove(root, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+		return add(root, path, value)
+	default:
+		return nil, fmt.Errorf("%w: 不支持的操作 %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// 解析 RFC 6901 JSON Pointer
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: 路径必须以 / 开头: %q", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			value, ok := n[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			node = value
+		case []any:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// 在 path 处添加值，数组中的 "-" 表示末尾；返回新的根节点
+func add(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]any:
+		p[last] = value
+		return root, nil
+	case []any:
+		i := len(p)
+		if last != "-" {
+			if i, err = arrayIndex(last, len(p)); err != nil {
+				return nil, err
+			}
+		}
+		arr := append(p[:i:i], append([]any{value}, p[i:]...)...)
+		return replaceNode(root, path[:len(path)-1], arr)
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+func remove(root any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: 不能删除根节点", ErrInvalidPatch)
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]any:
+		if _, ok := p[last]; !ok {
+			return nil, ErrPathNotFound
+		}
+		delete(p, last)
+		return root, nil
+	case []any:
+		i, err := arrayIndex(last, len(p)-1)
+		if err != nil {
+			return nil, err
+		}
+		arr := append(p[:i:i], p[i+1:]...)
+		return replaceNode(root, path[:len(path)-1], arr)
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// 数组长度变化后需要把新数组写回上一级
+func replaceNode(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		p[last] = value
+	case []any:
+		i, err := arrayIndex(last, len(p)-1)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = value
+	}
+	return root, nil
+}
+
+// 数组下标不能有前导 0，且不能超过 limit
+func arrayIndex(token string, limit int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: 无效的数组下标 %q", ErrInvalidPatch, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%w: 无效的数组下标 %q", ErrInvalidPatch, token)
+	}
+	if i > limit {
+		return 0, ErrPathNotFound
+	}
+	return i, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[key] = deepCopy(item)
+		}
+		return m
+	case []any:
+		arr := make([]any, len(v))
+		for i, item := range v {
+			arr[i] = deepCopy(item)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+// 比较时数字按数值比较，1 和 1.0 相等
+func normalize(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[key] = normalize(item)
+		}
+		return m
+	case []any:
+		arr := make([]any, len(v))
+		for i, item := range v {
+			arr[i] = normalize(item)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+// 数字保留原始写法，避免大整数精度丢失
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("JSON 后有多余内容")
+	}
+	return value, nil
+}
@@ -0,0 +1,332 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 按 JSON 语义比较，忽略字段顺序和空白
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	g, err := decode(got)
+	if err != nil {
+		t.Fatalf("结果不是有效的 JSON: %s", got)
+	}
+	w, err := decode([]byte(want))
+	if err != nil {
+		t.Fatalf("期望值不是有效的 JSON: %s", want)
+	}
+	return reflect.DeepEqual(normalize(g), normalize(w))
+}
+
+type patchTest struct {
+	name    string
+	doc     string
+	patch   string
+	want    string
+	wantErr error
+}
+
+func runPatchTests(t *testing.T, apply func(doc, patch []byte) ([]byte, error), tests []patchTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(t, got, tt.want) {
+				t.Errorf("结果 %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// RFC 6902 附录 A 的示例
+func TestApplyRFC6902Examples(t *testing.T) {
+	runPatchTests(t, Apply, []patchTest{
+		{
+			name:  "A.1 添加对象成员",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "A.2 添加数组元素",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "A.3 删除对象成员",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "A.4 删除数组元素",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "A.5 替换值",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "A.6 移动值",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "A.7 移动数组元素",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "A.8 test 通过",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:    "A.9 test 未通过",
+			doc:     `{"baz":"qux"}`,
+			patch:   `[{"op":"test","path":"/baz","value":"bar"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:  "A.10 添加嵌套对象",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			want:  `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:  "A.11 忽略无法识别的字段",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			want:  `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:    "A.12 添加到不存在的位置",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			wantErr: ErrPathNotFound,
+		},
+		{
+			// 重复的 op 取最后一个，按 remove 执行时 /baz 不存在
+			name:    "A.13 无效的补丁",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"add","path":"/baz","value":"qux","op":"remove"}]`,
+			wantErr: ErrPathNotFound,
+		},
+		{
+			name:  "A.14 ~ 转义的顺序",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10}]`,
+			want:  `{"/":9,"~1":10}`,
+		},
+		{
+			name:    "A.15 字符串和数字不相等",
+			doc:     `{"/":9,"~1":10}`,
+			patch:   `[{"op":"test","path":"/~01","value":"10"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:  "A.16 添加数组值",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+	})
+}
+
+func TestApplyEdgeCases(t *testing.T) {
+	runPatchTests(t, Apply, []patchTest{
+		{
+			name:  "添加到数组末尾的下标",
+			doc:   `{"a":[1,2]}`,
+			patch: `[{"op":"add","path":"/a/2","value":3}]`,
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:    "添加时下标超出数组长度",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"add","path":"/a/3","value":3}]`,
+			wantErr: ErrPathNotFound,
+		},
+		{
+			name:    "删除时下标等于数组长度",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"remove","path":"/a/2"}]`,
+			wantErr: ErrPathNotFound,
+		},
+		{
+			name:    "替换时下标超出数组长度",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"replace","path":"/a/2","value":3}]`,
+			wantErr: ErrPathNotFound,
+		},
+		{
+			name:    "下标有前导 0",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"remove","path":"/a/01"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "负数下标",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"remove","path":"/a/-1"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "删除时不能使用 -",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"remove","path":"/a/-"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:  "添加到嵌套数组末尾",
+			doc:   `{"a":[[1]]}`,
+			patch: `[{"op":"add","path":"/a/0/-","value":2}]`,
+			want:  `{"a":[[1,2]]}`,
+		},
+		{
+			name:    "移动到自身的子路径",
+			doc:     `{"a":{"b":{}}}`,
+			patch:   `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:  "移动到自身",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"move","from":"/a","path":"/a"}]`,
+			want:  `{"a":{"b":1}}`,
+		},
+		{
+			name:  "移动到名称以自身开头的兄弟字段",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"move","from":"/a","path":"/ab"}]`,
+			want:  `{"ab":1}`,
+		},
+		{
+			name:  "复制的值与原值互不影响",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			want:  `{"a":{"b":1},"c":{"b":2}}`,
+		},
+		{
+			name:  "添加显式的 null",
+			doc:   `{}`,
+			patch: `[{"op":"add","path":"/a","value":null}]`,
+			want:  `{"a":null}`,
+		},
+		{
+			name:  "替换为 null",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"/a","value":null}]`,
+			want:  `{"a":null}`,
+		},
+		{
+			name:  "test null",
+			doc:   `{"a":null}`,
+			patch: `[{"op":"test","path":"/a","value":null}]`,
+			want:  `{"a":null}`,
+		},
+		{
+			name:    "缺少 value",
+			doc:     `{}`,
+			patch:   `[{"op":"add","path":"/a"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:  "test 按数值比较数字",
+			doc:   `{"a":1,"b":[100]}`,
+			patch: `[{"op":"test","path":"/a","value":1.0},{"op":"test","path":"/b","value":[1e2]}]`,
+			want:  `{"a":1,"b":[100]}`,
+		},
+		{
+			name:    "test 数值不同",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"test","path":"/a","value":1.5}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:  "替换根节点",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"","value":[1]}]`,
+			want:  `[1]`,
+		},
+		{
+			name:    "不能删除根节点",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"remove","path":""}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "路径不以 / 开头",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"remove","path":"a"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "不支持的操作",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"increment","path":"/a"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "任一操作失败时不生效",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`,
+			wantErr: ErrTestFailed,
+		},
+	})
+}
+
+// 大整数保持原始写法，不经过 float64 丢失精度
+func TestApplyKeepsLargeNumbers(t *testing.T) {
+	got, err := Apply([]byte(`{"id":12345678901234567890}`), []byte(`[{"op":"add","path":"/n","value":9007199254740993}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"12345678901234567890", "9007199254740993"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("结果 %s 中缺少 %s", got, want)
+		}
+	}
+}
+
+// RFC 7396 附录 A 的示例
+func TestMergePatchRFC7396Examples(t *testing.T) {
+	runPatchTests(t, MergePatch, []patchTest{
+		{name: "替换字段", doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "添加字段", doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "删除字段", doc: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "只删除指定字段", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "数组替换为字符串", doc: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "字符串替换为数组", doc: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "递归合并对象", doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "数组整体替换", doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "根节点为数组", doc: `["a","b"]`, patch: `["c","d"]`, want: `["c","d"]`},
+		{name: "对象替换为数组", doc: `{"a":"b"}`, patch: `["c"]`, want: `["c"]`},
+		{name: "补丁为 null", doc: `{"a":"foo"}`, patch: `null`, want: `null`},
+		{name: "补丁为字符串", doc: `{"a":"foo"}`, patch: `"bar"`, want: `"bar"`},
+		{name: "文档中的 null 保留", doc: `{"e":null}`, patch: `{"a":1}`, want: `{"e":null,"a":1}`},
+		{name: "数组替换为对象", doc: `[1,2]`, patch: `{"a":"b","c":null}`, want: `{"a":"b"}`},
+		{name: "嵌套对象中的 null", doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+		{name: "无效的补丁", doc: `{}`, patch: `{"a":`, wantErr: ErrInvalidPatch},
+	})
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"os"
+
 	"server/config"
+	"server/events"
 	"server/handlers"
+	"server/repository"
+	"server/storage"
 	"server/utils"
 
 	"github.com/gin-contrib/cors"
@@ -19,8 +24,26 @@ func main() {
 	if err := config.Init(); err != nil {
 		utils.Logger.Fatal(err)
 	}
+	if err := storage.Init(); err != nil {
+		utils.Logger.Fatal(err)
+	}
+	if err := repository.Init(); err != nil {
+		utils.Logger.Fatal(err)
+	}
+	events.Init()
+
+	// 命令行子命令
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			utils.Logger.Fatal(err)
+		}
+		return
+	}
 
 	r := gin.Default()
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		utils.Logger.Fatal(err)
+	}
 
 	// 使用配置的CORS设置
 	r.Use(cors.New(cors.Config{
@@ -32,28 +55,75 @@ func main() {
 		MaxAge:           config.MaxAge,
 	}))
 
-	// 使用配置的静态文件路径
-	r.Static("/content", config.ContentDir)
+	// 静态文件，图片由存储后端提供
+	r.GET("/content/*filepath", handlers.HandleServeContent)
+	r.HEAD("/content/*filepath", handlers.HandleServeContent)
 
 	api := r.Group("/api")
 	{
 		api.POST("/validate-passphrase", handlers.ValidatePassphrase)
+		api.GET("/events", handlers.HandleEvents)
 		api.POST("/upload", handlers.HandleImageUpload)
+		api.POST("/upload/batch", handlers.HandleBatchUpload)
+		api.POST("/uploads", handlers.HandleCreateUpload)
+		api.HEAD("/uploads/:id", handlers.HandleUploadProgress)
+		api.PATCH("/uploads/:id", handlers.HandleUploadChunk)
+		api.POST("/uploads/:id/finalize", handlers.HandleFinalizeUpload)
+		api.DELETE("/uploads/:id", handlers.HandleCancelUpload)
 		api.POST("/posts", handlers.HandleSavePost)
 		api.GET("/posts", handlers.HandleGetPosts)
 		api.GET("/posts/:id", handlers.HandleGetPostById)
 		api.PUT("/posts/:id", handlers.HandleUpdatePost)
+		api.PATCH("/posts/:id", handlers.HandlePatchPost)
 		api.DELETE("/posts/:id", handlers.HandleSoftDeletePost)
 		api.GET("/trash", handlers.HandleGetTrashPosts)
+		api.DELETE("/trash", handlers.HandleEmptyTrash)
 		api.POST("/posts/:id/restore", handlers.HandleRestorePost)
 		api.DELETE("/posts/:id/permanent", handlers.HandlePermanentDelete)
+		api.GET("/posts/:id/lock", handlers.HandleGetEditLock)
+		api.POST("/posts/:id/lock", handlers.HandleAcquireEditLock)
+		api.PUT("/posts/:id/lock", handlers.HandleRenewEditLock)
+		api.DELETE("/posts/:id/lock", handlers.HandleReleaseEditLock)
 		api.POST("/photos", handlers.HandleSavePhotos)
 		api.GET("/photos", handlers.HandleGetPhotos)
 		api.DELETE("/photos/:id", handlers.HandleDeletePhoto)
+		api.GET("/photos/trash", handlers.HandleGetTrashPhotos)
+		api.DELETE("/photos/trash", handlers.HandleEmptyPhotoTrash)
+		api.POST("/photos/:id/restore", handlers.HandleRestorePhoto)
+		api.DELETE("/photos/:id/permanent", handlers.HandlePermanentDeletePhoto)
 		api.GET("/photos/:id", handlers.HandleGetPhotoById)
 		api.PUT("/photos/:id", handlers.HandleUpdatePhoto)
+		api.PATCH("/photos/:id", handlers.HandlePatchPhoto)
+		api.PUT("/photos/:id/images/order", handlers.HandleReorderPhotoImages)
+		api.PUT("/photos/:id/images/:index", handlers.HandleUpdatePhotoImage)
+		api.GET("/albums", handlers.HandleGetAlbums)
+		api.POST("/albums", handlers.HandleCreateAlbum)
+		api.PUT("/albums/order", handlers.HandleReorderAlbums)
+		api.GET("/albums/:id", handlers.HandleGetAlbumById)
+		api.PUT("/albums/:id", handlers.HandleUpdateAlbum)
+		api.DELETE("/albums/:id", handlers.HandleDeleteAlbum)
+		api.PUT("/albums/:id/photos", handlers.HandleSetAlbumPhotos)
+		api.POST("/albums/:id/photos", handlers.HandleAddAlbumPhotos)
+		api.DELETE("/albums/:id/photos/:photoId", handlers.HandleRemoveAlbumPhoto)
+		api.POST("/images/gc", handlers.HandleImageGC)
+		api.GET("/media", handlers.HandleGetMedia)
+		api.GET("/media/:id", handlers.HandleGetMediaById)
+		api.PUT("/media/:id", handlers.HandleUpdateMedia)
+		api.DELETE("/media/:id", handlers.HandleDeleteMedia)
+		api.GET("/webhooks", handlers.HandleGetWebhooks)
+		api.POST("/webhooks", handlers.HandleCreateWebhook)
+		api.GET("/webhooks/:id", handlers.HandleGetWebhookById)
+		api.PUT("/webhooks/:id", handlers.HandleUpdateWebhook)
+		api.DELETE("/webhooks/:id", handlers.HandleDeleteWebhook)
+		api.GET("/webhooks/:id/deliveries", handlers.HandleGetWebhookDeliveries)
+		api.POST("/webhooks/:id/test", handlers.HandleTestWebhook)
 	}
 
+	// 后台清理回收站中过期的内容
+	handlers.StartTrashPurger()
+	// 后台发送 Webhook
+	handlers.StartWebhookDispatcher()
+
 	utils.Logger.Printf("服务器启动在 %s 端口...", config.Port)
 	r.Run(config.Port)
 }
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// 相册可见性
+const (
+	AlbumPublic   = "public"
+	AlbumUnlisted = "unlisted"
+	AlbumPrivate  = "private"
+)
+
+type Album struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	CoverPhotoID string    `json:"cover_photo_id"`
+	ParentID     string    `json:"parent_id"`
+	SortOrder    int       `json:"sort_order"`
+	Visibility   string    `json:"visibility"`
+	PhotoIDs     []string  `json:"photo_ids"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type AlbumsData struct {
+	Albums []Album `json:"albums"`
+}
+
+type AlbumRequest struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	CoverPhotoID string `json:"cover_photo_id"`
+	ParentID     string `json:"parent_id"`
+	SortOrder    *int   `json:"sort_order"`
+	Visibility   string `json:"visibility"`
+}
+
+// 设置相册中的照片及其顺序
+type AlbumPhotosRequest struct {
+	PhotoIDs []string `json:"photo_ids"`
+}
+
+// 调整同一父相册下子相册的顺序
+type AlbumOrderRequest struct {
+	ParentID string   `json:"parent_id"`
+	AlbumIDs []string `json:"album_ids"`
+}
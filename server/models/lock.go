@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// 文章的编辑锁，只用于提示，到期未续期自动失效；Session 不返回给其他编辑者
+type EditLock struct {
+	PostID     string    `json:"post_id"`
+	Session    string    `json:"-"`
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// 获取编辑锁的请求，Holder 为显示给其他编辑者的名称，Force 为 true 时强制接管
+type EditLockRequest struct {
+	Holder string `json:"holder"`
+	Force  bool   `json:"force"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type MediaMeta struct {
+	Alt         string            `json:"alt"`
+	Caption     string            `json:"caption"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Placeholder *ImagePlaceholder `json:"placeholder,omitempty"`
+	// 已应用的水印配置指纹，为空表示未加水印
+	Watermark string `json:"watermark,omitempty"`
+}
+
+type MediaData struct {
+	Items map[string]MediaMeta `json:"items"`
+}
+
+type MediaRequest struct {
+	Alt     string `json:"alt"`
+	Caption string `json:"caption"`
+}
+
+// 图片加载完成前显示的占位信息，上传时生成
+type ImagePlaceholder struct {
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	BlurHash      string `json:"blurhash"`
+	LQIP          string `json:"lqip"`
+	DominantColor string `json:"dominant_color"`
+}
@@ -1,17 +1,102 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Photo struct {
-	ID          string    `json:"id"`
-	URLs        []string  `json:"urls"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Category    string    `json:"category"`
-	Created     string    `json:"created"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string               `json:"id"`
+	Images      []PhotoImage         `json:"images"`
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	Category    string               `json:"category"`
+	Tags        []string             `json:"tags,omitempty"`
+	Created     string               `json:"created"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	Deleted     bool                 `json:"deleted"`
+	DeletedAt   *time.Time           `json:"deleted_at,omitempty"`
+	Exif        map[string]PhotoExif `json:"exif,omitempty"`
+	// 仅在输出时根据媒体元数据填充，不保存
+	Placeholders map[string]ImagePlaceholder `json:"placeholders,omitempty"`
+	// 所在相册的 ID，同样只在输出时填充
+	Albums []string `json:"albums,omitempty"`
+	// 图片地址列表，只在输出时按 Images 填充，兼容旧客户端
+	URLs []string `json:"urls,omitempty"`
+	// 回收站中的照片被自动清理的时间和剩余秒数，只在输出时填充
+	PurgeAt          *time.Time `json:"purge_at,omitempty"`
+	RemainingSeconds *int64     `json:"remaining_seconds,omitempty"`
+}
+
+// 照片中的一张图片
+type PhotoImage struct {
+	URL        string      `json:"url"`
+	Caption    string      `json:"caption,omitempty"`
+	Alt        string      `json:"alt,omitempty"`
+	Width      int         `json:"width,omitempty"`
+	Height     int         `json:"height,omitempty"`
+	FocalPoint *FocalPoint `json:"focal_point,omitempty"`
+	IsCover    bool        `json:"is_cover,omitempty"`
+}
+
+// 裁剪图片时保留的焦点，坐标为相对宽高的比例，取值 0 到 1
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// 旧数据只保存了图片地址列表 urls，读取时转换为 images
+func (p *Photo) UnmarshalJSON(data []byte) error {
+	type photo Photo
+	if err := json.Unmarshal(data, (*photo)(p)); err != nil {
+		return err
+	}
+	if len(p.Images) == 0 {
+		for _, u := range p.URLs {
+			p.Images = append(p.Images, PhotoImage{URL: u})
+		}
+	}
+	p.URLs = nil
+	return nil
+}
+
+// 调整照片中图片顺序的请求，Order 为当前图片序号的新排列
+type PhotoImageOrderRequest struct {
+	Order []int `json:"order"`
+}
+
+// 修改照片中单张图片的请求，未提交的字段保持不变
+type PhotoImageUpdate struct {
+	Caption    *string     `json:"caption"`
+	Alt        *string     `json:"alt"`
+	FocalPoint *FocalPoint `json:"focal_point"`
+	IsCover    *bool       `json:"is_cover"`
 }
 
 type PhotosData struct {
 	Photos []Photo `json:"photos"`
-} 
\ No newline at end of file
+}
+
+// 照片列表的一页，Total 为符合筛选条件的照片总数
+type PhotoPage struct {
+	Photos     []Photo `json:"photos"`
+	Total      int     `json:"total"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// 照片的拍摄信息，以图片地址为键保存在 Photo.Exif 中
+type PhotoExif struct {
+	Make            string   `json:"make,omitempty"`
+	Model           string   `json:"model,omitempty"`
+	Lens            string   `json:"lens,omitempty"`
+	FocalLength     float64  `json:"focal_length,omitempty"`
+	FocalLength35mm int      `json:"focal_length_35mm,omitempty"`
+	Aperture        float64  `json:"aperture,omitempty"`
+	ShutterSpeed    string   `json:"shutter_speed,omitempty"`
+	ISO             int      `json:"iso,omitempty"`
+	DateTaken       string   `json:"date_taken,omitempty"`
+	Latitude        *float64 `json:"latitude,omitempty"`
+	Longitude       *float64 `json:"longitude,omitempty"`
+	Altitude        *float64 `json:"altitude,omitempty"`
+}
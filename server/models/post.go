@@ -1,14 +1,17 @@
 package models
 
 type Post struct {
-	Title    string   `json:"title"`
-	Category string   `json:"category"`
-	Summary  string   `json:"summary"`
-	Content  string   `json:"content"`
-	Tags     []string `json:"tags"`
-	Created  string   `json:"created"`
-	Updated  string   `json:"updated"`
-	Deleted  bool     `json:"deleted"`
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	Category  string   `json:"category"`
+	Summary   string   `json:"summary"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	Created   string   `json:"created"`
+	Updated   string   `json:"updated"`
+	Deleted   bool     `json:"deleted"`
+	DeletedAt string   `json:"deleted_at,omitempty"` // RFC3339，移入回收站的时间
+	Extra     string   `json:"-"`                    // frontmatter 中无法识别的字段，按原样写回文件
 }
 
 type PassphraseRequest struct {
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// 分片上传会话，已上传的字节数以暂存文件大小为准
+type UploadSession struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Length    int64     `json:"length"`
+	CreatedAt time.Time `json:"created_at"`
+}
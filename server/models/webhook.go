@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook 订阅，Events 为空时接收全部事件；Secret 用于签名，不在列表中返回
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 一个事件对一个 Webhook 的投递，失败后按指数退避重试
+type WebhookDelivery struct {
+	ID          string            `json:"id"`
+	WebhookID   string            `json:"webhook_id"`
+	EventID     string            `json:"event_id"`
+	EventType   string            `json:"event_type"`
+	Payload     json.RawMessage   `json:"payload"`
+	Status      string            `json:"status"`
+	Attempts    []DeliveryAttempt `json:"attempts"`
+	NextAttempt *time.Time        `json:"next_attempt,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// 一次发送尝试，StatusCode 为 0 表示没有收到响应
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	Duration   int64     `json:"duration_ms"`
+}
+
+type WebhooksData struct {
+	Webhooks   []Webhook         `json:"webhooks"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// 创建或修改 Webhook，修改时 Secret 为空表示不变，Active 为空表示不变
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+	Active *bool    `json:"active"`
+}
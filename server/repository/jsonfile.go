@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 保存在单个 JSON 文件中的数据。读写串行执行，写入时先写临时文件再替换，
+// 替换前把上一版本保存为 .bak；文件无法解析时拒绝写入，避免覆盖掉原有数据
+type JSONFile[T any] struct {
+	path  string
+	empty func() T
+	mu    sync.Mutex
+}
+
+func NewJSONFile[T any](path string, empty func() T) *JSONFile[T] {
+	return &JSONFile[T]{path: path, empty: empty}
+}
+
+// 读取数据，文件不存在时返回空数据
+func (f *JSONFile[T]) Read() (T, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	value, _, err := f.read()
+	return value, err
+}
+
+// 在锁内读取、修改并保存数据，fn 返回错误时不保存
+func (f *JSONFile[T]) Update(fn func(*T) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	value, raw, err := f.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(&value); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(raw, data) {
+		return nil
+	}
+	if raw != nil {
+		if err := writeFileAtomic(f.path+".bak", raw); err != nil {
+			return fmt.Errorf("备份 %s 失败: %w", f.path, err)
+		}
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+func (f *JSONFile[T]) read() (T, []byte, error) {
+	value := f.empty()
+	raw, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return value, nil, nil
+	}
+	if err != nil {
+		return value, nil, err
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return f.empty(), raw, fmt.Errorf("%w: %s: %v", ErrCorrupt, f.path, err)
+	}
+	return value, raw, nil
+}
+
+// 写入临时文件并 fsync 后替换目标文件，中途崩溃时目标文件保持原样
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// 同步目录，确保重命名本身也已落盘
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import "server/models"
+
+// 照片存储
+type PhotoRepository interface {
+	// 所有照片，保持保存时的顺序
+	List() ([]models.Photo, error)
+	Get(id string) (models.Photo, error)
+	Create(photo models.Photo) error
+	// 修改单张照片，返回修改后的照片
+	Update(id string, fn func(*models.Photo) error) (models.Photo, error)
+	// 删除照片，返回被删除的照片；check 不为 nil 时先在同一个锁内用当前内容检查，返回错误时不删除
+	Delete(id string, check func(models.Photo) error) (models.Photo, error)
+}
+
+// 保存在 photos.json 中的照片
+type JSONPhotoRepository struct {
+	file *JSONFile[models.PhotosData]
+}
+
+func NewJSONPhotoRepository(path string) *JSONPhotoRepository {
+	return &JSONPhotoRepository{file: NewJSONFile(path, func() models.PhotosData {
+		return models.PhotosData{Photos: []models.Photo{}}
+	})}
+}
+
+func (r *JSONPhotoRepository) List() ([]models.Photo, error) {
+	data, err := r.file.Read()
+	if err != nil {
+		return nil, err
+	}
+	if data.Photos == nil {
+		return []models.Photo{}, nil
+	}
+	return data.Photos, nil
+}
+
+func (r *JSONPhotoRepository) Get(id string) (models.Photo, error) {
+	photos, err := r.List()
+	if err != nil {
+		return models.Photo{}, err
+	}
+	for _, photo := range photos {
+		if photo.ID == id {
+			return photo, nil
+		}
+	}
+	return models.Photo{}, ErrNotFound
+}
+
+func (r *JSONPhotoRepository) Create(photo models.Photo) error {
+	return r.file.Update(func(data *models.PhotosData) error {
+		data.Photos = append(data.Photos, photo)
+		return nil
+	})
+}
+
+// 在锁内修改单张照片
+func (r *JSONPhotoRepository) Update(id string, fn func(*models.Photo) error) (models.Photo, error) {
+	var updated models.Photo
+	err := r.file.Update(func(data *models.PhotosData) error {
+		for i := range data.Photos {
+			if data.Photos[i].ID != id {
+				continue
+			}
+			if err := fn(&data.Photos[i]); err != nil {
+				return err
+			}
+			updated = data.Photos[i]
+			return nil
+		}
+		return ErrNotFound
+	})
+	return updated, err
+}
+
+func (r *JSONPhotoRepository) Delete(id string, check func(models.Photo) error) (models.Photo, error) {
+	var deleted models.Photo
+	err := r.file.Update(func(data *models.PhotosData) error {
+		for i, photo := range data.Photos {
+			if photo.ID == id {
+				if check != nil {
+					if err := check(photo); err != nil {
+						return err
+					}
+				}
+				deleted = photo
+				data.Photos = append(data.Photos[:i], data.Photos[i+1:]...)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return deleted, err
+}
@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"server/models"
+	"server/utils"
+)
+
+// 文章存储
+type PostRepository interface {
+	// 按创建时间倒序列出文章，deleted 为 true 时列出回收站中的文章
+	List(deleted bool) ([]models.Post, error)
+	Get(id string) (models.Post, error)
+	// 新建文章，ID 已存在时返回 ErrExists
+	Create(post models.Post) error
+	// 修改文章并返回保存后的内容，与之后 Get 读到的一致
+	Update(id string, fn func(*models.Post) error) (models.Post, error)
+	// 永久删除文章；check 不为 nil 时先在同一个锁内用当前内容检查，返回错误时不删除
+	Delete(id string, check func(models.Post) error) error
+}
+
+var (
+	frontmatterRegex = regexp.MustCompile(`(?s)^---\n(.*?)\n---\n`)
+	mainContentRegex = regexp.MustCompile(`(?s)^---\n.*?\n---\n\s*([\s\S]*)$`)
+	tagRegex         = regexp.MustCompile(`(?m)^  - (.+)$`)
+	fieldRegex       = regexp.MustCompile(`^([A-Za-z0-9_-]+):`)
+)
+
+// FormatPost 写出的 frontmatter 字段，其他字段保存在 Post.Extra 中
+var postFields = map[string]bool{
+	"title": true, "created": true, "updated": true, "category": true, "summary": true,
+	"tags": true, "deleted": true, "deleted_at": true,
+}
+
+// 以 markdown 文件保存的文章，文件名即文章 ID
+type MarkdownPostRepository struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewMarkdownPostRepository(dir string) *MarkdownPostRepository {
+	return &MarkdownPostRepository{dir: dir}
+}
+
+func (r *MarkdownPostRepository) List(deleted bool) ([]models.Post, error) {
+	posts, err := r.all()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.Post{}
+	for _, post := range posts {
+		if post.Deleted == deleted {
+			result = append(result, post)
+		}
+	}
+	sortPosts(result)
+	return result, nil
+}
+
+func (r *MarkdownPostRepository) Get(id string) (models.Post, error) {
+	path, err := r.path(id)
+	if err != nil {
+		return models.Post{}, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return models.Post{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Post{}, err
+	}
+	return ParsePost(id, content)
+}
+
+func (r *MarkdownPostRepository) Create(post models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path, err := r.path(post.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return ErrExists
+	}
+	return r.write(post)
+}
+
+func (r *MarkdownPostRepository) Update(id string, fn func(*models.Post) error) (models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, err := r.Get(id)
+	if err != nil {
+		return post, err
+	}
+	if err := fn(&post); err != nil {
+		return post, err
+	}
+	post.ID = id
+	if err := r.write(post); err != nil {
+		return post, err
+	}
+	return ParsePost(id, []byte(FormatPost(post)))
+}
+
+func (r *MarkdownPostRepository) Delete(id string, check func(models.Post) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path, err := r.path(id)
+	if err != nil {
+		return err
+	}
+	if check != nil {
+		post, err := r.Get(id)
+		if err != nil {
+			return err
+		}
+		if err := check(post); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// 读取目录中的所有文章，无法解析的文件跳过
+func (r *MarkdownPostRepository) all() ([]models.Post, error) {
+	files, err := os.ReadDir(r.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取文章目录失败: %w", err)
+	}
+
+	var posts []models.Post
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".md") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(r.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		post, err := ParsePost(strings.TrimSuffix(file.Name(), ".md"), content)
+		if err != nil {
+			utils.Logger.Printf("跳过无法解析的文章 %s: %v", file.Name(), err)
+			continue
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (r *MarkdownPostRepository) write(post models.Post) error {
+	path, err := r.path(post.ID)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(FormatPost(post)))
+}
+
+func (r *MarkdownPostRepository) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", ErrNotFound
+	}
+	return filepath.Join(r.dir, id+".md"), nil
+}
+
+// 解析带 frontmatter 的 markdown 文章
+func ParsePost(id string, content []byte) (models.Post, error) {
+	matches := frontmatterRegex.FindSubmatch(content)
+	if len(matches) < 2 {
+		return models.Post{}, fmt.Errorf("无效的文章格式")
+	}
+
+	frontmatter := string(matches[1])
+	tags, extra := splitFrontmatter(frontmatter)
+	post := models.Post{
+		ID:       id,
+		Title:    utils.ExtractField(frontmatter, "title"),
+		Created:  utils.ExtractField(frontmatter, "created"),
+		Updated:  utils.ExtractField(frontmatter, "updated"),
+		Category: utils.ExtractField(frontmatter, "category"),
+		Summary:  utils.ExtractField(frontmatter, "summary"),
+		Deleted:  utils.ExtractField(frontmatter, "deleted") == "true",
+		Content:  ExtractMainContent(string(content)),
+		Extra:    extra,
+	}
+	if post.Deleted {
+		post.DeletedAt = utils.ExtractField(frontmatter, "deleted_at")
+	}
+	for _, match := range tagRegex.FindAllStringSubmatch(tags, -1) {
+		post.Tags = append(post.Tags, match[1])
+	}
+	return post, nil
+}
+
+// 按顶层字段拆分 frontmatter，返回 tags 下的行，以及无法识别的字段连同其下缩进的行
+func splitFrontmatter(frontmatter string) (tags, extra string) {
+	var tagLines, extraLines []string
+	field := ""
+	for _, line := range strings.Split(frontmatter, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' && !strings.HasPrefix(line, "- ") {
+			field = ""
+			if match := fieldRegex.FindStringSubmatch(line); match != nil {
+				field = match[1]
+			}
+			if postFields[field] {
+				continue
+			}
+		}
+		if field == "tags" {
+			tagLines = append(tagLines, line)
+		} else if !postFields[field] {
+			extraLines = append(extraLines, line)
+		}
+	}
+	return strings.Join(tagLines, "\n"), strings.Join(extraLines, "\n")
+}
+
+// 生成带 frontmatter 的 markdown 文件内容
+func FormatPost(post models.Post) string {
+	frontmatter := []string{
+		"---",
+		fmt.Sprintf("title:    %s", post.Title),
+		fmt.Sprintf("created:  %s", post.Created),
+		fmt.Sprintf("updated:  %s", post.Updated),
+		fmt.Sprintf("category: %s", post.Category),
+		fmt.Sprintf("summary:  %s", post.Summary),
+		"tags:",
+	}
+
+	for _, tag := range post.Tags {
+		frontmatter = append(frontmatter, fmt.Sprintf("  - %s", tag))
+	}
+	if post.Deleted {
+		frontmatter = append(frontmatter, "deleted: true")
+		if post.DeletedAt != "" {
+			frontmatter = append(frontmatter, fmt.Sprintf("deleted_at: %s", post.DeletedAt))
+		}
+	}
+	if post.Extra != "" {
+		frontmatter = append(frontmatter, strings.TrimRight(post.Extra, "\n"))
+	}
+	frontmatter = append(frontmatter, "---")
+
+	return strings.Join(frontmatter, "\n") + "\n\n" + ExtractMainContent(post.Content)
+}
+
+// 草稿在 frontmatter 中记为 draft: true，保存在 Post.Extra 中，只有作者可以看到
+func IsDraft(post models.Post) bool {
+	return utils.ExtractField(post.Extra, "draft") == "true"
+}
+
+// 设置或去掉草稿标记
+func SetDraft(post *models.Post, draft bool) {
+	var lines []string
+	for _, line := range strings.Split(post.Extra, "\n") {
+		if line != "" && fieldRegex.FindString(line) != "draft:" {
+			lines = append(lines, line)
+		}
+	}
+	if draft {
+		lines = append(lines, "draft: true")
+	}
+	post.Extra = strings.Join(lines, "\n")
+}
+
+// 去掉内容中的 frontmatter，只保留正文
+func ExtractMainContent(content string) string {
+	matches := mainContentRegex.FindStringSubmatch(content)
+	if len(matches) > 1 {
+		return strings.TrimSpace(matches[1])
+	}
+	return strings.TrimSpace(content)
+}
+
+// 由创建时间和标题生成文章 ID，同时也是 markdown 文件名；标题中的特殊字符替换为 -
+func NewPostID(created time.Time, title string) string {
+	sanitizedTitle := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsNumber(r):
+			return r
+		default:
+			return '-'
+		}
+	}, title)
+	return fmt.Sprintf("%sT%s-%s", created.Format("2006-01-02"), created.Format("15-04"), sanitizedTitle)
+}
+
+// 按创建时间倒序
+func sortPosts(posts []models.Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Created > posts[j].Created
+	})
+}
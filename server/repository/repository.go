@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+
+	"server/config"
+	"server/models"
+)
+
+var (
+	ErrNotFound = errors.New("记录不存在")
+	ErrExists   = errors.New("记录已存在")
+	ErrCorrupt  = errors.New("数据文件已损坏")
+)
+
+var (
+	Posts  PostRepository
+	Photos PhotoRepository
+	Media  *JSONFile[models.MediaData]
+	Albums *JSONFile[models.AlbumsData]
+	// Webhook 订阅和投递记录
+	Webhooks *JSONFile[models.WebhooksData]
+)
+
+// 按配置初始化文章和照片的存储
+func Init() error {
+	switch config.DataBackend {
+	case config.DataBackendSQLite:
+		db, err := OpenSQLite(config.SQLiteFile)
+		if err != nil {
+			return err
+		}
+		mirror := ""
+		if config.SQLiteMirrorMarkdown {
+			mirror = config.PostsDir
+		}
+		Posts = NewSQLitePostRepository(db, mirror)
+		Photos = NewSQLitePhotoRepository(db)
+	default:
+		Posts = NewMarkdownPostRepository(config.PostsDir)
+		Photos = NewJSONPhotoRepository(config.PhotosFile)
+	}
+
+	Media = NewJSONFile(config.MediaFile, func() models.MediaData {
+		return models.MediaData{Items: map[string]models.MediaMeta{}}
+	})
+	Albums = NewJSONFile(config.AlbumsFile, func() models.AlbumsData {
+		return models.AlbumsData{Albums: []models.Album{}}
+	})
+
+	Webhooks = NewJSONFile(config.WebhooksFile, func() models.WebhooksData {
+		return models.WebhooksData{Webhooks: []models.Webhook{}, Deliveries: []models.WebhookDelivery{}}
+	})
+
+	// 启动时检查数据文件，损坏时直接报错而不是在之后的写入中覆盖
+	if _, err := Photos.List(); err != nil {
+		return err
+	}
+	if _, err := Media.Read(); err != nil {
+		return err
+	}
+	if _, err := Albums.Read(); err != nil {
+		return err
+	}
+	if _, err := Webhooks.Read(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"server/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// 数据库结构的变更按顺序追加，已执行的版本记录在 schema_migrations 中
+var migrations = []string{
+	`CREATE TABLE posts (
+		id       TEXT PRIMARY KEY,
+		title    TEXT NOT NULL,
+		category TEXT NOT NULL DEFAULT '',
+		summary  TEXT NOT NULL DEFAULT '',
+		content  TEXT NOT NULL DEFAULT '',
+		tags     TEXT NOT NULL DEFAULT '[]',
+		created  TEXT NOT NULL DEFAULT '',
+		updated  TEXT NOT NULL DEFAULT '',
+		deleted  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX posts_deleted_created ON posts (deleted, created);`,
+
+	// 照片的完整内容以 JSON 保存，常用于查询的字段单独成列
+	`CREATE TABLE photos (
+		id       TEXT PRIMARY KEY,
+		position INTEGER NOT NULL,
+		category TEXT NOT NULL DEFAULT '',
+		created  TEXT NOT NULL DEFAULT '',
+		data     TEXT NOT NULL
+	);
+	CREATE INDEX photos_position ON photos (position);`,
+
+	`ALTER TABLE posts ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';`,
+
+	// 上次同步时两侧一致的内容摘要，用于判断哪一侧在之后有改动
+	`CREATE TABLE sync_state (
+		kind TEXT NOT NULL,
+		id   TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		PRIMARY KEY (kind, id)
+	);`,
+
+	// markdown 文件 frontmatter 中无法识别的字段
+	`ALTER TABLE posts ADD COLUMN extra TEXT NOT NULL DEFAULT '';`,
+}
+
+// 打开数据库并执行未应用的迁移
+func OpenSQLite(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, err
+	}
+	// 只使用一个连接，写操作天然串行
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("数据库迁移失败: %w", err)
+	}
+	return db, nil
+}
+
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		err := withTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[version-1]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+				version, time.Now().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("版本 %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 可以在事务内外执行的查询
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// 保存在 SQLite 中的文章，mirrorDir 不为空时同时写出 markdown 文件；
+// 文件在事务提交前写出，写文件失败时数据库的修改回滚
+type SQLitePostRepository struct {
+	db     *sql.DB
+	mirror *MarkdownPostRepository
+}
+
+func NewSQLitePostRepository(db *sql.DB, mirrorDir string) *SQLitePostRepository {
+	r := &SQLitePostRepository{db: db}
+	if mirrorDir != "" {
+		r.mirror = NewMarkdownPostRepository(mirrorDir)
+	}
+	return r
+}
+
+const postColumns = `id, title, category, summary, content, tags, created, updated, deleted, deleted_at, extra`
+
+func (r *SQLitePostRepository) List(deleted bool) ([]models.Post, error) {
+	rows, err := r.db.Query(`SELECT `+postColumns+` FROM posts WHERE deleted = ? ORDER BY created DESC`, deleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (r *SQLitePostRepository) Get(id string) (models.Post, error) {
+	return getPost(r.db, id)
+}
+
+func (r *SQLitePostRepository) Create(post models.Post) error {
+	err := withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := getPost(tx, post.ID); err == nil {
+			return ErrExists
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err := putPost(tx, post); err != nil {
+			return err
+		}
+		return r.mirrorWrite(post)
+	})
+	return err
+}
+
+func (r *SQLitePostRepository) Update(id string, fn func(*models.Post) error) (models.Post, error) {
+	var post models.Post
+	err := withTx(r.db, func(tx *sql.Tx) error {
+		var err error
+		if post, err = getPost(tx, id); err != nil {
+			return err
+		}
+		if err := fn(&post); err != nil {
+			return err
+		}
+		post.ID = id
+		if err := putPost(tx, post); err != nil {
+			return err
+		}
+		if post, err = getPost(tx, id); err != nil {
+			return err
+		}
+		return r.mirrorWrite(post)
+	})
+	return post, err
+}
+
+func (r *SQLitePostRepository) Delete(id string, check func(models.Post) error) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if check != nil {
+			post, err := getPost(tx, id)
+			if err != nil {
+				return err
+			}
+			if err := check(post); err != nil {
+				return err
+			}
+		}
+		result, err := tx.Exec(`DELETE FROM posts WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		if r.mirror != nil {
+			if err := r.mirror.Delete(id, nil); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 写入或覆盖文章，用于同步
+func (r *SQLitePostRepository) Put(post models.Post) error {
+	return putPost(r.db, post)
+}
+
+func (r *SQLitePostRepository) mirrorWrite(post models.Post) error {
+	if r.mirror == nil {
+		return nil
+	}
+	r.mirror.mu.Lock()
+	defer r.mirror.mu.Unlock()
+	return r.mirror.write(post)
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func putPost(db execer, post models.Post) error {
+	tags, err := json.Marshal(post.Tags)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO posts (`+postColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, category = excluded.category,
+			summary = excluded.summary, content = excluded.content, tags = excluded.tags,
+			created = excluded.created, updated = excluded.updated, deleted = excluded.deleted,
+			deleted_at = excluded.deleted_at, extra = excluded.extra`,
+		post.ID, post.Title, post.Category, post.Summary, ExtractMainContent(post.Content),
+		string(tags), post.Created, post.Updated, post.Deleted, post.DeletedAt, post.Extra)
+	return err
+}
+
+func getPost(db queryer, id string) (models.Post, error) {
+	post, err := scanPost(db.QueryRow(`SELECT `+postColumns+` FROM posts WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return post, ErrNotFound
+	}
+	return post, err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPost(row scanner) (models.Post, error) {
+	var post models.Post
+	var tags string
+	if err := row.Scan(&post.ID, &post.Title, &post.Category, &post.Summary, &post.Content,
+		&tags, &post.Created, &post.Updated, &post.Deleted, &post.DeletedAt, &post.Extra); err != nil {
+		return post, err
+	}
+	if err := json.Unmarshal([]byte(tags), &post.Tags); err != nil {
+		return post, fmt.Errorf("解析文章 %s 的标签失败: %w", post.ID, err)
+	}
+	return post, nil
+}
+
+// 保存在 SQLite 中的照片
+type SQLitePhotoRepository struct {
+	db *sql.DB
+}
+
+func NewSQLitePhotoRepository(db *sql.DB) *SQLitePhotoRepository {
+	return &SQLitePhotoRepository{db: db}
+}
+
+func (r *SQLitePhotoRepository) List() ([]models.Photo, error) {
+	rows, err := r.db.Query(`SELECT data FROM photos ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []models.Photo{}
+	for rows.Next() {
+		photo, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	return photos, rows.Err()
+}
+
+func (r *SQLitePhotoRepository) Get(id string) (models.Photo, error) {
+	return getPhoto(r.db, id)
+}
+
+func (r *SQLitePhotoRepository) Create(photo models.Photo) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := getPhoto(tx, photo.ID); err == nil {
+			return ErrExists
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return putPhoto(tx, photo)
+	})
+}
+
+func (r *SQLitePhotoRepository) Update(id string, fn func(*models.Photo) error) (models.Photo, error) {
+	var photo models.Photo
+	err := withTx(r.db, func(tx *sql.Tx) error {
+		var err error
+		if photo, err = getPhoto(tx, id); err != nil {
+			return err
+		}
+		if err := fn(&photo); err != nil {
+			return err
+		}
+		photo.ID = id
+		return putPhoto(tx, photo)
+	})
+	return photo, err
+}
+
+func (r *SQLitePhotoRepository) Delete(id string, check func(models.Photo) error) (models.Photo, error) {
+	var photo models.Photo
+	err := withTx(r.db, func(tx *sql.Tx) error {
+		var err error
+		if photo, err = getPhoto(tx, id); err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(photo); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`DELETE FROM photos WHERE id = ?`, id)
+		return err
+	})
+	return photo, err
+}
+
+// 写入或覆盖照片，新照片排在最后，用于同步
+func (r *SQLitePhotoRepository) Put(photo models.Photo) error {
+	return putPhoto(r.db, photo)
+}
+
+func putPhoto(db execer, photo models.Photo) error {
+	data, err := json.Marshal(photo)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO photos (id, position, category, created, data)
+		VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM photos), ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET category = excluded.category, created = excluded.created, data = excluded.data`,
+		photo.ID, photo.Category, photo.Created, string(data))
+	return err
+}
+
+func getPhoto(db queryer, id string) (models.Photo, error) {
+	photo, err := scanPhoto(db.QueryRow(`SELECT data FROM photos WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return photo, ErrNotFound
+	}
+	return photo, err
+}
+
+func scanPhoto(row scanner) (models.Photo, error) {
+	var photo models.Photo
+	var data string
+	if err := row.Scan(&data); err != nil {
+		return photo, err
+	}
+	if err := json.Unmarshal([]byte(data), &photo); err != nil {
+		return photo, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return photo, nil
+}
@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"server/config"
+	"server/models"
+	"server/utils"
+)
+
+// 同步方向
+const (
+	SyncImport = "import"
+	SyncExport = "export"
+	SyncBoth   = "both"
+)
+
+type SyncResult struct {
+	PostsImported  int
+	PostsExported  int
+	PhotosImported int
+	PhotosExported int
+	// 删除操作同样计入导入和导出的数量，这里单独列出
+	PostsRemoved  int
+	PhotosRemoved int
+	// 两侧都有改动、没有同步的内容
+	Conflicts []string
+}
+
+// 在 SQLite 与 markdown 文件、photos.json 之间同步。
+// 每次同步记录两侧一致时的内容摘要，之后只有一侧改动的内容按改动的一侧同步，删除也会同步到另一侧。
+// import 只把文件的改动写入数据库，export 只把数据库的改动写回文件，两侧都有改动时以同步来源为准；
+// both 双向同步，两侧都有改动（包括第一次同步时两侧内容不同）的内容不做修改，需要指定方向再同步一次
+func Sync(direction string) (SyncResult, error) {
+	var result SyncResult
+	if config.DataBackend != config.DataBackendSQLite {
+		return result, errors.New("只有 DATA_BACKEND=sqlite 时才需要同步")
+	}
+	switch direction {
+	case SyncImport, SyncExport, SyncBoth:
+	default:
+		return result, fmt.Errorf("未知的同步方向: %s", direction)
+	}
+
+	db, err := OpenSQLite(config.SQLiteFile)
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+
+	s := &syncer{
+		db:         db,
+		direction:  direction,
+		posts:      NewSQLitePostRepository(db, ""),
+		photos:     NewSQLitePhotoRepository(db),
+		markdown:   NewMarkdownPostRepository(config.PostsDir),
+		photosFile: NewJSONPhotoRepository(config.PhotosFile),
+		result:     &result,
+	}
+	if err := s.syncPosts(); err != nil {
+		return result, err
+	}
+	if err := s.syncPhotos(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+type syncer struct {
+	db         *sql.DB
+	direction  string
+	posts      *SQLitePostRepository
+	photos     *SQLitePhotoRepository
+	markdown   *MarkdownPostRepository
+	photosFile *JSONPhotoRepository
+	result     *SyncResult
+}
+
+// 一项内容的同步操作
+type syncAction int
+
+const (
+	syncNone     syncAction = iota
+	syncImport              // 文件写入数据库
+	syncExport              // 数据库写回文件
+	syncConflict            // 两侧都有改动，不做修改
+)
+
+// 比较文件、数据库和上次同步时的摘要，决定同步方向；摘要为空表示这一侧没有这项内容
+func (s *syncer) decide(file, db, base string) syncAction {
+	if file == db {
+		return syncNone
+	}
+	fileChanged, dbChanged := file != base, db != base
+	if base == "" {
+		// 第一次同步时只存在于一侧的内容复制到另一侧
+		fileChanged, dbChanged = file != "", db != ""
+	}
+
+	action := syncConflict
+	switch {
+	case fileChanged && !dbChanged:
+		action = syncImport
+	case dbChanged && !fileChanged:
+		action = syncExport
+	case s.direction == SyncImport:
+		action = syncImport
+	case s.direction == SyncExport:
+		action = syncExport
+	}
+	if (action == syncImport && s.direction == SyncExport) || (action == syncExport && s.direction == SyncImport) {
+		return syncNone
+	}
+	return action
+}
+
+func (s *syncer) syncPosts() error {
+	files, err := s.markdown.all()
+	if err != nil {
+		return err
+	}
+	filePosts := make(map[string]models.Post, len(files))
+	for _, post := range files {
+		filePosts[post.ID] = post
+	}
+	dbPosts := make(map[string]models.Post)
+	for _, deleted := range []bool{false, true} {
+		posts, err := s.posts.List(deleted)
+		if err != nil {
+			return err
+		}
+		for _, post := range posts {
+			dbPosts[post.ID] = post
+		}
+	}
+	base, err := loadSyncState(s.db, "post")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range syncIDs(filePosts, dbPosts, base) {
+		file, inFile := filePosts[id]
+		dbPost, inDB := dbPosts[id]
+		fileHash, dbHash := "", ""
+		if inFile {
+			fileHash = postHash(file)
+		}
+		if inDB {
+			dbHash = postHash(dbPost)
+		}
+
+		switch s.decide(fileHash, dbHash, base[id]) {
+		case syncNone:
+			if fileHash != dbHash {
+				continue
+			}
+		case syncConflict:
+			utils.Logger.Printf("文章 %s 在文件和数据库中都有改动，未同步", id)
+			s.result.Conflicts = append(s.result.Conflicts, "文章 "+id)
+			continue
+		case syncImport:
+			if inFile {
+				err = s.posts.Put(file)
+			} else if err = s.posts.Delete(id, nil); errors.Is(err, ErrNotFound) {
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("导入文章 %s 失败: %w", id, err)
+			}
+			logSync("导入文章", id, inFile, &s.result.PostsImported, &s.result.PostsRemoved)
+			dbHash = fileHash
+		case syncExport:
+			if inDB {
+				s.markdown.mu.Lock()
+				err = s.markdown.write(dbPost)
+				s.markdown.mu.Unlock()
+			} else if err = s.markdown.Delete(id, nil); errors.Is(err, ErrNotFound) {
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("导出文章 %s 失败: %w", id, err)
+			}
+			logSync("导出文章", id, inDB, &s.result.PostsExported, &s.result.PostsRemoved)
+		}
+		if err := saveSyncState(s.db, "post", id, dbHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncer) syncPhotos() error {
+	files, err := s.photosFile.List()
+	if err != nil {
+		return err
+	}
+	filePhotos := make(map[string]models.Photo, len(files))
+	for _, photo := range files {
+		filePhotos[photo.ID] = photo
+	}
+	photos, err := s.photos.List()
+	if err != nil {
+		return err
+	}
+	dbPhotos := make(map[string]models.Photo, len(photos))
+	for _, photo := range photos {
+		dbPhotos[photo.ID] = photo
+	}
+	base, err := loadSyncState(s.db, "photo")
+	if err != nil {
+		return err
+	}
+
+	// photos.json 的修改集中在最后一次写入
+	exports := make(map[string]*models.Photo)
+	states := make(map[string]string)
+	for _, id := range syncIDs(filePhotos, dbPhotos, base) {
+		file, inFile := filePhotos[id]
+		dbPhoto, inDB := dbPhotos[id]
+		fileHash, dbHash := "", ""
+		if inFile {
+			fileHash = photoHash(file)
+		}
+		if inDB {
+			dbHash = photoHash(dbPhoto)
+		}
+
+		switch s.decide(fileHash, dbHash, base[id]) {
+		case syncNone:
+			if fileHash != dbHash {
+				continue
+			}
+		case syncConflict:
+			utils.Logger.Printf("照片 %s 在 photos.json 和数据库中都有改动，未同步", id)
+			s.result.Conflicts = append(s.result.Conflicts, "照片 "+id)
+			continue
+		case syncImport:
+			if inFile {
+				err = s.photos.Put(file)
+			} else if _, err = s.photos.Delete(id, nil); errors.Is(err, ErrNotFound) {
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("导入照片 %s 失败: %w", id, err)
+			}
+			logSync("导入照片", id, inFile, &s.result.PhotosImported, &s.result.PhotosRemoved)
+			dbHash = fileHash
+		case syncExport:
+			if inDB {
+				photo := dbPhoto
+				exports[id] = &photo
+			} else {
+				exports[id] = nil
+			}
+			states[id] = dbHash
+			continue
+		}
+		if err := saveSyncState(s.db, "photo", id, dbHash); err != nil {
+			return err
+		}
+	}
+	if len(exports) == 0 {
+		return nil
+	}
+
+	// 修改的照片保持原位置，新照片按数据库中的顺序排在最后
+	err = s.photosFile.file.Update(func(data *models.PhotosData) error {
+		kept := make([]models.Photo, 0, len(data.Photos))
+		for _, photo := range data.Photos {
+			if export, ok := exports[photo.ID]; ok {
+				if export == nil {
+					continue
+				}
+				photo = *export
+				delete(exports, photo.ID)
+			}
+			kept = append(kept, photo)
+		}
+		for _, photo := range photos {
+			if export := exports[photo.ID]; export != nil {
+				kept = append(kept, *export)
+			}
+		}
+		data.Photos = kept
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("导出照片失败: %w", err)
+	}
+	for id, hash := range states {
+		logSync("导出照片", id, hash != "", &s.result.PhotosExported, &s.result.PhotosRemoved)
+		if err := saveSyncState(s.db, "photo", id, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logSync(action, id string, written bool, count, removed *int) {
+	*count++
+	if written {
+		utils.Logger.Printf("已%s: %s", action, id)
+		return
+	}
+	*removed++
+	utils.Logger.Printf("已%s（删除）: %s", action, id)
+}
+
+// 两侧和上次同步记录中出现过的所有 ID
+func syncIDs[T any](file, db map[string]T, base map[string]string) []string {
+	seen := make(map[string]bool)
+	for id := range file {
+		seen[id] = true
+	}
+	for id := range db {
+		seen[id] = true
+	}
+	for id := range base {
+		seen[id] = true
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func loadSyncState(db *sql.DB, kind string) (map[string]string, error) {
+	rows, err := db.Query(`SELECT id, hash FROM sync_state WHERE kind = ?`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	state := make(map[string]string)
+	for rows.Next() {
+		var id, hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, err
+		}
+		state[id] = hash
+	}
+	return state, rows.Err()
+}
+
+// 记录两侧一致时的摘要，hash 为空表示两侧都已删除
+func saveSyncState(db *sql.DB, kind, id, hash string) error {
+	var err error
+	if hash == "" {
+		_, err = db.Exec(`DELETE FROM sync_state WHERE kind = ? AND id = ?`, kind, id)
+	} else {
+		_, err = db.Exec(`INSERT INTO sync_state (kind, id, hash) VALUES (?, ?, ?)
+			ON CONFLICT (kind, id) DO UPDATE SET hash = excluded.hash`, kind, id, hash)
+	}
+	return err
+}
+
+func postHash(post models.Post) string {
+	sum := sha256.Sum256([]byte(FormatPost(post)))
+	return hex.EncodeToString(sum[:])
+}
+
+func photoHash(photo models.Photo) string {
+	data, _ := json.Marshal(photo)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
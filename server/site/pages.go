@@ -0,0 +1,710 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"server/config"
+	"server/models"
+	"server/repository"
+	"server/utils"
+)
+
+// 首页每页显示的文章数和订阅源中的文章数
+const (
+	postsPerPage = 10
+	feedSize     = 20
+)
+
+type siteContent struct {
+	posts  []models.Post
+	photos []models.Photo
+	albums []models.Album
+}
+
+// 读取未删除的文章和照片、公开和不公开列出的相册，文章和照片按时间倒序；
+// 草稿和只在私密相册中的照片不生成
+func loadContent() (siteContent, error) {
+	var content siteContent
+	all, err := repository.Posts.List(false)
+	if err != nil {
+		return content, fmt.Errorf("读取文章失败: %w", err)
+	}
+	var posts []models.Post
+	for _, post := range all {
+		if !repository.IsDraft(post) {
+			posts = append(posts, post)
+		}
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		if posts[i].Created != posts[j].Created {
+			return posts[i].Created > posts[j].Created
+		}
+		return posts[i].ID > posts[j].ID
+	})
+	content.posts = posts
+
+	photos, err := repository.Photos.List()
+	if err != nil {
+		return content, fmt.Errorf("读取照片失败: %w", err)
+	}
+	for _, photo := range photos {
+		if !photo.Deleted {
+			content.photos = append(content.photos, photo)
+		}
+	}
+	sort.SliceStable(content.photos, func(i, j int) bool {
+		a, b := content.photos[i], content.photos[j]
+		if a.Created != b.Created {
+			return a.Created > b.Created
+		}
+		return a.UpdatedAt.After(b.UpdatedAt)
+	})
+
+	albumsData, err := repository.Albums.Read()
+	if err != nil {
+		return content, fmt.Errorf("读取相册失败: %w", err)
+	}
+	// 上级相册不公开时子相册同样不公开
+	visibility := albumVisibility(albumsData.Albums)
+	private, visible := map[string]bool{}, map[string]bool{}
+	for _, album := range albumsData.Albums {
+		album.Visibility = visibility[album.ID]
+		if album.Visibility != models.AlbumPrivate {
+			content.albums = append(content.albums, album)
+		}
+		for _, id := range album.PhotoIDs {
+			if album.Visibility == models.AlbumPrivate {
+				private[id] = true
+			} else {
+				visible[id] = true
+			}
+		}
+	}
+	photos = content.photos[:0]
+	for _, photo := range content.photos {
+		if !private[photo.ID] || visible[photo.ID] {
+			photos = append(photos, photo)
+		}
+	}
+	content.photos = photos
+	sort.SliceStable(content.albums, func(i, j int) bool {
+		return content.albums[i].SortOrder < content.albums[j].SortOrder
+	})
+	return content, nil
+}
+
+type builder struct {
+	opts    Options
+	content siteContent
+	// 页面引用的图片文件名
+	images map[string]bool
+	// 内容中指向本站图片的地址，见 imageRefRegex
+	imageRefs *regexp.Regexp
+}
+
+// 一个输出文件。key 包含页面依赖的全部数据，用于判断是否需要重新生成
+type page struct {
+	path   string
+	key    any
+	images []string
+	render func() ([]byte, error)
+}
+
+// 页面模板使用的数据，Root 为从页面到站点根目录的相对路径
+type view struct {
+	Site  siteView
+	Root  string
+	Path  string
+	Title string
+	Data  any
+}
+
+type siteView struct {
+	Title       string
+	Description string
+	Feeds       bool
+}
+
+type link struct {
+	Name string
+	URL  string
+}
+
+type postSummary struct {
+	Title    string
+	URL      string
+	Date     string
+	Summary  string
+	Category *link
+	Tags     []link
+}
+
+type listView struct {
+	Heading string
+	Posts   []postSummary
+	Page    int
+	Pages   int
+	Prev    string
+	Next    string
+}
+
+type postView struct {
+	Title    string
+	Date     string
+	Updated  string
+	Category *link
+	Tags     []link
+	Markdown string
+	Content  template.HTML `json:"-"`
+	Prev     *link
+	Next     *link
+}
+
+type termView struct {
+	Name  string
+	URL   string
+	Count int
+}
+
+type archiveGroup struct {
+	Label string
+	Posts []postSummary
+}
+
+type imageView struct {
+	Src     string
+	Alt     string
+	Caption string
+	Width   int
+	Height  int
+}
+
+type photoSummary struct {
+	Title string
+	URL   string
+	Date  string
+	Cover *imageView
+	Count int
+}
+
+type photoView struct {
+	Title       string
+	Description string
+	Date        string
+	Images      []imageView
+	Tags        []string
+	Albums      []link
+}
+
+type albumSummary struct {
+	Title       string
+	Description string
+	URL         string
+	Cover       *imageView
+	Count       int
+}
+
+type albumView struct {
+	Title       string
+	Description string
+	Photos      []photoSummary
+}
+
+// 站点的所有输出文件
+func (b *builder) pages() ([]*page, error) {
+	var pages []*page
+	posts := b.content.posts
+
+	// 首页分页
+	pageCount := (len(posts) + postsPerPage - 1) / postsPerPage
+	if pageCount == 0 {
+		pageCount = 1
+	}
+	for n := 1; n <= pageCount; n++ {
+		path := indexPath(n)
+		root := rootOf(path)
+		end := n * postsPerPage
+		if end > len(posts) {
+			end = len(posts)
+		}
+		list := listView{Posts: b.summaries(root, posts[(n-1)*postsPerPage:end]), Page: n, Pages: pageCount}
+		if n > 1 {
+			list.Prev = root + indexPath(n-1)
+		}
+		if n < pageCount {
+			list.Next = root + indexPath(n+1)
+		}
+		title := ""
+		if n > 1 {
+			title = fmt.Sprintf("第 %d 页", n)
+		}
+		pages = append(pages, b.templatePage(path, "list.html", title, list))
+	}
+
+	// 文章
+	for i, post := range posts {
+		path := postPath(post)
+		root := rootOf(path)
+		markdown, images := b.rewriteImages(post.Content, root)
+		v := postView{
+			Title:    post.Title,
+			Date:     post.Created,
+			Updated:  post.Updated,
+			Category: categoryLink(root, post.Category),
+			Tags:     tagLinks(root, post.Tags),
+			Markdown: markdown,
+		}
+		// 列表按时间倒序，上一篇是更早的文章
+		if i+1 < len(posts) {
+			v.Prev = &link{Name: posts[i+1].Title, URL: root + postPath(posts[i+1])}
+		}
+		if i > 0 {
+			v.Next = &link{Name: posts[i-1].Title, URL: root + postPath(posts[i-1])}
+		}
+		p := b.templatePage(path, "post.html", post.Title, &v)
+		p.images = images
+		render := p.render
+		p.render = func() ([]byte, error) {
+			html, err := renderMarkdown(v.Markdown)
+			if err != nil {
+				return nil, err
+			}
+			v.Content = html
+			return render()
+		}
+		pages = append(pages, p)
+	}
+
+	// 分类和标签
+	categories, tags := groupTerms(posts)
+	pages = append(pages, b.termPages("categories", "分类", categories)...)
+	pages = append(pages, b.termPages("tags", "标签", tags)...)
+
+	// 归档
+	archivePath := "archive/index.html"
+	pages = append(pages, b.templatePage(archivePath, "archive.html", "归档", b.archive(rootOf(archivePath))))
+
+	// 照片和相册
+	pages = append(pages, b.photoPages()...)
+
+	pages = append(pages, &page{path: "style.css", key: styleSheet, render: func() ([]byte, error) {
+		return []byte(styleSheet), nil
+	}})
+
+	if b.opts.BaseURL != "" {
+		pages = append(pages, b.feedPages()...)
+		pages = append(pages, b.sitemapPage(pages))
+	}
+	return pages, nil
+}
+
+// 使用模板渲染的页面
+func (b *builder) templatePage(path, name, title string, data any) *page {
+	v := view{
+		Site:  siteView{Title: b.opts.Title, Description: b.opts.Description, Feeds: b.opts.BaseURL != ""},
+		Root:  rootOf(path),
+		Path:  path,
+		Title: title,
+		Data:  data,
+	}
+	return &page{
+		path: path,
+		key:  []any{name, v},
+		render: func() ([]byte, error) {
+			return renderTemplate(name, v)
+		},
+	}
+}
+
+// 分类或标签的索引页和每个分类、标签的文章列表
+func (b *builder) termPages(dir, heading string, terms map[string][]models.Post) []*page {
+	names := make([]string, 0, len(terms))
+	for name := range terms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indexFile := dir + "/index.html"
+	root := rootOf(indexFile)
+	items := []termView{}
+	var pages []*page
+	for _, name := range names {
+		path := dir + "/" + slugify(name) + "/index.html"
+		items = append(items, termView{Name: name, URL: root + path, Count: len(terms[name])})
+		list := listView{
+			Heading: heading + ": " + name,
+			Posts:   b.summaries(rootOf(path), terms[name]),
+			Page:    1,
+			Pages:   1,
+		}
+		pages = append(pages, b.templatePage(path, "list.html", name, list))
+	}
+	return append(pages, b.templatePage(indexFile, "terms.html", heading, struct {
+		Heading string
+		Terms   []termView
+	}{heading, items}))
+}
+
+// 按年月分组的全部文章
+func (b *builder) archive(root string) []archiveGroup {
+	groups := []archiveGroup{}
+	for _, post := range b.content.posts {
+		label := "未注明日期"
+		if t, ok := parseDate(post.Created); ok {
+			label = t.Format("2006 年 01 月")
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Label != label {
+			groups = append(groups, archiveGroup{Label: label})
+		}
+		group := &groups[len(groups)-1]
+		group.Posts = append(group.Posts, b.summary(root, post))
+	}
+	return groups
+}
+
+func (b *builder) photoPages() []*page {
+	var pages []*page
+	albumsOf := map[string][]models.Album{}
+	for _, album := range b.content.albums {
+		for _, id := range album.PhotoIDs {
+			albumsOf[id] = append(albumsOf[id], album)
+		}
+	}
+	photos := map[string]models.Photo{}
+	for _, photo := range b.content.photos {
+		photos[photo.ID] = photo
+	}
+
+	galleryPath := "photos/index.html"
+	gallery := []photoSummary{}
+	for _, photo := range b.content.photos {
+		gallery = append(gallery, b.photoSummary(rootOf(galleryPath), photo))
+
+		path := photoPath(photo)
+		root := rootOf(path)
+		v := photoView{
+			Title:       photo.Title,
+			Description: photo.Description,
+			Date:        photo.Created,
+			Tags:        photo.Tags,
+		}
+		var images []string
+		for _, image := range photo.Images {
+			iv, name := b.imageOf(root, image)
+			v.Images = append(v.Images, iv)
+			if name != "" {
+				images = append(images, name)
+			}
+		}
+		for _, album := range albumsOf[photo.ID] {
+			v.Albums = append(v.Albums, link{Name: album.Title, URL: root + albumPath(album)})
+		}
+		p := b.templatePage(path, "photo.html", photoTitle(photo), v)
+		p.images = images
+		pages = append(pages, p)
+	}
+	galleryPage := b.templatePage(galleryPath, "photos.html", "照片", gallery)
+	galleryPage.images = b.coverImages(b.content.photos)
+	pages = append(pages, galleryPage)
+
+	albumsPath := "albums/index.html"
+	listed := []albumSummary{}
+	var listedPhotos []models.Photo
+	for _, album := range b.content.albums {
+		var albumPhotos []models.Photo
+		for _, id := range album.PhotoIDs {
+			if photo, ok := photos[id]; ok {
+				albumPhotos = append(albumPhotos, photo)
+			}
+		}
+		path := albumPath(album)
+		root := rootOf(path)
+		v := albumView{Title: album.Title, Description: album.Description, Photos: []photoSummary{}}
+		for _, photo := range albumPhotos {
+			v.Photos = append(v.Photos, b.photoSummary(root, photo))
+		}
+		p := b.templatePage(path, "album.html", album.Title, v)
+		p.images = b.coverImages(albumPhotos)
+		pages = append(pages, p)
+
+		// 不公开列出的相册只能通过链接访问
+		if album.Visibility != models.AlbumPublic {
+			continue
+		}
+		summary := albumSummary{
+			Title:       album.Title,
+			Description: album.Description,
+			URL:         rootOf(albumsPath) + path,
+			Count:       len(albumPhotos),
+		}
+		if cover, ok := albumCover(album, photos, albumPhotos); ok {
+			image, _ := b.imageOf(rootOf(albumsPath), coverImage(cover))
+			summary.Cover = &image
+			listedPhotos = append(listedPhotos, cover)
+		}
+		listed = append(listed, summary)
+	}
+	albumsPage := b.templatePage(albumsPath, "albums.html", "相册", listed)
+	albumsPage.images = b.coverImages(listedPhotos)
+	return append(pages, albumsPage)
+}
+
+func (b *builder) summaries(root string, posts []models.Post) []postSummary {
+	list := []postSummary{}
+	for _, post := range posts {
+		list = append(list, b.summary(root, post))
+	}
+	return list
+}
+
+func (b *builder) summary(root string, post models.Post) postSummary {
+	return postSummary{
+		Title:    post.Title,
+		URL:      root + postPath(post),
+		Date:     post.Created,
+		Summary:  post.Summary,
+		Category: categoryLink(root, post.Category),
+		Tags:     tagLinks(root, post.Tags),
+	}
+}
+
+func (b *builder) photoSummary(root string, photo models.Photo) photoSummary {
+	s := photoSummary{
+		Title: photoTitle(photo),
+		URL:   root + photoPath(photo),
+		Date:  photo.Created,
+		Count: len(photo.Images),
+	}
+	if len(photo.Images) > 0 {
+		image, _ := b.imageOf(root, coverImage(photo))
+		s.Cover = &image
+	}
+	return s
+}
+
+// 列表页只引用照片的封面
+func (b *builder) coverImages(photos []models.Photo) []string {
+	var names []string
+	for _, photo := range photos {
+		if len(photo.Images) == 0 {
+			continue
+		}
+		if _, name := b.imageOf("", coverImage(photo)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// 输入摘要包含页面数据、模板和站点配置，任一变化都会重新生成
+func (b *builder) inputHash(p *page) string {
+	data, _ := json.Marshal([]any{manifestVersion, templatesHash, b.opts.BaseURL, b.opts.Title, b.opts.Description, p.key})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 内容中指向本站图片的地址：根相对路径，以及旧数据中本站域名和站点地址下的完整地址。
+// 第一个分组是根相对路径前的字符，第二个分组是文件名
+func imageRefRegex(baseURL string) *regexp.Regexp {
+	prefix := `(^|[\s("'=])`
+	if hosts := utils.HostPattern(utils.OwnImageHosts(baseURL)); hosts != "" {
+		prefix = `(?:(?:https?:)?//` + hosts + `|` + prefix + `)`
+	}
+	return regexp.MustCompile(`(?m)` + prefix + `/content/images/([^\s"'()<>?#]+)`)
+}
+
+// 把内容中本站图片的地址改为相对于 root 的地址，返回修改后的内容和引用的图片，代码中的地址保持原样
+func (b *builder) rewriteImages(content, root string) (string, []string) {
+	var names []string
+	rewritten := utils.ReplaceOutsideCode(content, func(text string) string {
+		return b.imageRefs.ReplaceAllStringFunc(text, func(match string) string {
+			m := b.imageRefs.FindStringSubmatch(match)
+			names = append(names, m[2])
+			return m[1] + root + imageOutputPath(m[2])
+		})
+	})
+	return rewritten, names
+}
+
+// 图片的展示信息，本站图片同时返回文件名
+func (b *builder) imageOf(root string, image models.PhotoImage) (imageView, string) {
+	v := imageView{Src: image.URL, Alt: image.Alt, Caption: image.Caption, Width: image.Width, Height: image.Height}
+	if v.Alt == "" {
+		v.Alt = image.Caption
+	}
+	name := ""
+	if m := b.imageRefs.FindStringSubmatchIndex(image.URL); m != nil && m[0] == 0 {
+		name = image.URL[m[4]:m[5]]
+		v.Src = root + imageOutputPath(name)
+	}
+	return v, name
+}
+
+func coverImage(photo models.Photo) models.PhotoImage {
+	for _, image := range photo.Images {
+		if image.IsCover {
+			return image
+		}
+	}
+	return photo.Images[0]
+}
+
+// 相册封面照片，未设置或已删除时使用相册中的第一张
+func albumCover(album models.Album, photos map[string]models.Photo, albumPhotos []models.Photo) (models.Photo, bool) {
+	if photo, ok := photos[album.CoverPhotoID]; ok && len(photo.Images) > 0 {
+		return photo, true
+	}
+	for _, photo := range albumPhotos {
+		if len(photo.Images) > 0 {
+			return photo, true
+		}
+	}
+	return models.Photo{}, false
+}
+
+// 相册的实际可见性，取相册和所有上级相册中最严格的一个
+func albumVisibility(albums []models.Album) map[string]string {
+	rank := map[string]int{models.AlbumPublic: 0, models.AlbumUnlisted: 1, models.AlbumPrivate: 2}
+	byID := make(map[string]models.Album, len(albums))
+	for _, album := range albums {
+		byID[album.ID] = album
+	}
+
+	result := make(map[string]string, len(albums))
+	for _, album := range albums {
+		visibility := album.Visibility
+		seen := map[string]bool{album.ID: true}
+		for parentID := album.ParentID; parentID != "" && !seen[parentID]; {
+			parent, ok := byID[parentID]
+			if !ok {
+				break
+			}
+			seen[parentID] = true
+			if rank[parent.Visibility] > rank[visibility] {
+				visibility = parent.Visibility
+			}
+			parentID = parent.ParentID
+		}
+		result[album.ID] = visibility
+	}
+	return result
+}
+
+func photoTitle(photo models.Photo) string {
+	if photo.Title != "" {
+		return photo.Title
+	}
+	return "无标题"
+}
+
+func groupTerms(posts []models.Post) (categories, tags map[string][]models.Post) {
+	categories = map[string][]models.Post{}
+	tags = map[string][]models.Post{}
+	for _, post := range posts {
+		if post.Category != "" {
+			categories[post.Category] = append(categories[post.Category], post)
+		}
+		seen := map[string]bool{}
+		for _, tag := range post.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags[tag] = append(tags[tag], post)
+			}
+		}
+	}
+	return categories, tags
+}
+
+func categoryLink(root, category string) *link {
+	if category == "" {
+		return nil
+	}
+	return &link{Name: category, URL: root + "categories/" + slugify(category) + "/index.html"}
+}
+
+func tagLinks(root string, tags []string) []link {
+	var links []link
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			links = append(links, link{Name: tag, URL: root + "tags/" + slugify(tag) + "/index.html"})
+		}
+	}
+	return links
+}
+
+// 输出路径，均以 / 分隔且不以 / 开头
+func indexPath(n int) string {
+	if n <= 1 {
+		return "index.html"
+	}
+	return fmt.Sprintf("page/%d/index.html", n)
+}
+
+func postPath(post models.Post) string {
+	return "posts/" + slugify(post.ID) + "/index.html"
+}
+
+func photoPath(photo models.Photo) string {
+	return "photos/" + slugify(photo.ID) + "/index.html"
+}
+
+func albumPath(album models.Album) string {
+	return "albums/" + slugify(album.ID) + "/index.html"
+}
+
+// 从输出文件到站点根目录的相对路径，如 "posts/a/index.html" 对应 "../../"
+func rootOf(path string) string {
+	return strings.Repeat("../", strings.Count(path, "/"))
+}
+
+// 文件名中不能出现的字符替换为 -，保留中文等字符；链接中的字符由模板转义
+func slugify(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsNumber(r), r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.TrimSpace(name))
+	slug = strings.Trim(slug, ".")
+	if slug == "" {
+		sum := sha256.Sum256([]byte(name))
+		slug = hex.EncodeToString(sum[:4])
+	}
+	return slug
+}
+
+// 文章和照片的时间按配置的时区解析
+func parseDate(value string) (time.Time, bool) {
+	loc, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		loc = time.FixedZone("CST", 8*3600)
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(value), loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 站点地址加上输出路径，目录首页省略 index.html
+func absoluteURL(baseURL, path string) string {
+	path = strings.TrimSuffix(path, "index.html")
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return baseURL + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,292 @@
+package site
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/xml"
+	"html/template"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	templates     = map[string]*template.Template{}
+	templatesHash string
+	styleSheet    string
+)
+
+// 每个页面模板与 layout.html 组成独立的模板集合
+func init() {
+	hash := sha256.New()
+	names, err := fs.Glob(templateFS, "templates/*")
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := templateFS.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		hash.Write([]byte(name))
+		hash.Write(data)
+	}
+	templatesHash = hex.EncodeToString(hash.Sum(nil))
+
+	css, err := templateFS.ReadFile("templates/style.css")
+	if err != nil {
+		panic(err)
+	}
+	styleSheet = string(css)
+
+	pageNames, err := fs.Glob(templateFS, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range pageNames {
+		base := name[len("templates/"):]
+		if base == "layout.html" {
+			continue
+		}
+		templates[base] = template.Must(template.ParseFS(templateFS, "templates/layout.html", name))
+	}
+}
+
+func renderTemplate(name string, v view) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := templates[name].ExecuteTemplate(&buf, "layout", v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 文章由作者本人编写，允许其中的 HTML
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+func renderMarkdown(source string) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+type feedPost struct {
+	Title    string
+	URL      string
+	Date     string
+	Updated  string
+	Summary  string
+	Category string
+	Markdown string
+}
+
+// RSS 2.0 和 Atom 订阅源，包含最近的文章全文，图片使用完整地址
+func (b *builder) feedPages() []*page {
+	posts := b.content.posts
+	if len(posts) > feedSize {
+		posts = posts[:feedSize]
+	}
+	items := []feedPost{}
+	var images []string
+	for _, post := range posts {
+		content, names := b.rewriteImages(post.Content, b.opts.BaseURL+"/")
+		images = append(images, names...)
+		items = append(items, feedPost{
+			Title:    post.Title,
+			URL:      absoluteURL(b.opts.BaseURL, postPath(post)),
+			Date:     post.Created,
+			Updated:  post.Updated,
+			Summary:  post.Summary,
+			Category: post.Category,
+			Markdown: content,
+		})
+	}
+
+	rss := &page{path: "feed.xml", key: items, images: images, render: func() ([]byte, error) {
+		return b.renderRSS(items)
+	}}
+	atom := &page{path: "atom.xml", key: items, images: images, render: func() ([]byte, error) {
+		return b.renderAtom(items)
+	}}
+	return []*page{rss, atom}
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate,omitempty"`
+	Category    string `xml:"category,omitempty"`
+	Description string `xml:"description"`
+}
+
+func (b *builder) renderRSS(items []feedPost) ([]byte, error) {
+	feed := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       b.opts.Title,
+		Link:        b.opts.BaseURL + "/",
+		Description: b.opts.Description,
+	}}
+	for i, item := range items {
+		content, err := renderMarkdown(item.Markdown)
+		if err != nil {
+			return nil, err
+		}
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        item.URL,
+			Category:    item.Category,
+			Description: string(content),
+		}
+		if t, ok := parseDate(item.Date); ok {
+			entry.PubDate = t.Format(time.RFC1123Z)
+			if i == 0 {
+				feed.Channel.LastBuildDate = entry.PubDate
+			}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, entry)
+	}
+	return marshalXML(feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published,omitempty"`
+	Updated   string      `xml:"updated"`
+	Summary   string      `xml:"summary,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (b *builder) renderAtom(items []feedPost) ([]byte, error) {
+	feed := atomFeed{
+		Title: b.opts.Title,
+		ID:    b.opts.BaseURL + "/",
+		Link: []atomLink{
+			{Href: b.opts.BaseURL + "/"},
+			{Href: b.opts.BaseURL + "/atom.xml", Rel: "self"},
+		},
+	}
+	// Atom 要求 updated，没有可用日期时使用固定值，避免每次生成内容都不同
+	latest := time.Unix(0, 0).UTC()
+	for _, item := range items {
+		content, err := renderMarkdown(item.Markdown)
+		if err != nil {
+			return nil, err
+		}
+		entry := atomEntry{
+			Title:   item.Title,
+			ID:      item.URL,
+			Link:    atomLink{Href: item.URL},
+			Summary: item.Summary,
+			Content: atomContent{Type: "html", Body: string(content)},
+		}
+		updated := latest
+		if t, ok := parseDate(item.Date); ok {
+			entry.Published = t.Format(time.RFC3339)
+			updated = t
+		}
+		if t, ok := parseDate(item.Updated); ok {
+			updated = t
+		}
+		entry.Updated = updated.Format(time.RFC3339)
+		if updated.After(latest) {
+			latest = updated
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	feed.Updated = latest.Format(time.RFC3339)
+	return marshalXML(feed)
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// 站点地图包含所有 HTML 页面，文章附带最后修改日期
+func (b *builder) sitemapPage(pages []*page) *page {
+	lastMod := map[string]string{}
+	for _, post := range b.content.posts {
+		date := post.Updated
+		if date == "" {
+			date = post.Created
+		}
+		if t, ok := parseDate(date); ok {
+			lastMod[postPath(post)] = t.Format("2006-01-02")
+		}
+	}
+
+	set := sitemapURLSet{}
+	for _, p := range pages {
+		if !strings.HasSuffix(p.path, ".html") {
+			continue
+		}
+		set.URLs = append(set.URLs, sitemapURL{Loc: absoluteURL(b.opts.BaseURL, p.path), LastMod: lastMod[p.path]})
+	}
+	return &page{path: "sitemap.xml", key: set, render: func() ([]byte, error) {
+		return marshalXML(set)
+	}}
+}
+
+func marshalXML(v any) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
@@ -0,0 +1,242 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"server/storage"
+	"server/utils"
+)
+
+// 清单文件记录上次生成的每个文件及其输入，用于增量生成
+const (
+	manifestName    = ".build-manifest.json"
+	manifestVersion = 1
+)
+
+// 生成静态站点的选项
+type Options struct {
+	// 输出目录
+	OutDir string
+	// 站点的完整地址，用于订阅源和站点地图；为空时不生成这两类文件
+	BaseURL     string
+	Title       string
+	Description string
+	// 忽略上次的生成结果，重新生成所有文件
+	Full bool
+}
+
+// 生成结果
+type Result struct {
+	Written       int
+	Unchanged     int
+	Removed       int
+	ImagesCopied  int
+	ImagesSkipped int
+	// 被引用但在存储中找不到的图片
+	MissingImages []string
+}
+
+type manifest struct {
+	Version int `json:"version"`
+	// 输出文件的输入摘要和内容摘要
+	Files map[string]manifestFile `json:"files"`
+	// 已复制图片的大小和修改时间
+	Images map[string]string `json:"images"`
+}
+
+type manifestFile struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// 生成静态站点：页面的输入未变化且文件仍在时跳过渲染，内容未变化时不重写文件，
+// 只复制被页面引用的图片，删除上次生成但这次不再需要的文件
+func Build(opts Options) (Result, error) {
+	var result Result
+	if opts.OutDir == "" {
+		return result, errors.New("未指定输出目录")
+	}
+	if err := os.MkdirAll(opts.OutDir, 0755); err != nil {
+		return result, err
+	}
+
+	previous := loadManifest(opts.OutDir)
+	if opts.Full || previous.Version != manifestVersion {
+		previous = manifest{Files: map[string]manifestFile{}, Images: map[string]string{}}
+	}
+	current := manifest{Version: manifestVersion, Files: map[string]manifestFile{}, Images: map[string]string{}}
+
+	content, err := loadContent()
+	if err != nil {
+		return result, err
+	}
+	b := &builder{opts: opts, content: content, images: map[string]bool{}, imageRefs: imageRefRegex(opts.BaseURL)}
+	pages, err := b.pages()
+	if err != nil {
+		return result, err
+	}
+
+	for _, p := range pages {
+		for _, name := range p.images {
+			b.images[name] = true
+		}
+		input := b.inputHash(p)
+		old, ok := previous.Files[p.path]
+		if ok && old.Input == input && fileExists(opts.OutDir, p.path) {
+			current.Files[p.path] = old
+			result.Unchanged++
+			continue
+		}
+
+		data, err := p.render()
+		if err != nil {
+			return result, fmt.Errorf("生成 %s 失败: %w", p.path, err)
+		}
+		sum := sha256.Sum256(data)
+		output := hex.EncodeToString(sum[:])
+		current.Files[p.path] = manifestFile{Input: input, Output: output}
+		if ok && old.Output == output && fileExists(opts.OutDir, p.path) {
+			result.Unchanged++
+			continue
+		}
+		if err := writeFile(opts.OutDir, p.path, data); err != nil {
+			return result, err
+		}
+		result.Written++
+	}
+
+	if err := b.copyImages(previous, &current, &result); err != nil {
+		return result, err
+	}
+
+	// 只删除由生成过程创建的文件，输出目录中的其他文件保持不变
+	for path := range previous.Files {
+		if _, ok := current.Files[path]; !ok {
+			removeFile(opts.OutDir, path, &result)
+		}
+	}
+	for name := range previous.Images {
+		if _, ok := current.Images[name]; !ok {
+			removeFile(opts.OutDir, imageOutputPath(name), &result)
+		}
+	}
+
+	data, err := json.MarshalIndent(current, "", "    ")
+	if err != nil {
+		return result, err
+	}
+	if err := os.WriteFile(filepath.Join(opts.OutDir, manifestName), data, 0644); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// 复制页面引用的图片，大小和修改时间与上次相同时跳过
+func (b *builder) copyImages(previous manifest, current *manifest, result *Result) error {
+	names := make([]string, 0, len(b.images))
+	for name := range b.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		obj, err := storage.Images.Stat(name)
+		if errors.Is(err, storage.ErrNotExist) {
+			utils.Logger.Printf("图片不存在: %s", name)
+			result.MissingImages = append(result.MissingImages, name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		stamp := strconv.FormatInt(obj.Size, 10) + "-" + strconv.FormatInt(obj.ModTime.UnixNano(), 10)
+		current.Images[name] = stamp
+		if previous.Images[name] == stamp && fileExists(b.opts.OutDir, imageOutputPath(name)) {
+			result.ImagesSkipped++
+			continue
+		}
+		if err := copyImage(b.opts.OutDir, name); err != nil {
+			return fmt.Errorf("复制图片 %s 失败: %w", name, err)
+		}
+		result.ImagesCopied++
+	}
+	return nil
+}
+
+func copyImage(outDir, name string) error {
+	src, err := storage.Images.Get(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	path := filepath.Join(outDir, filepath.FromSlash(imageOutputPath(name)))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func imageOutputPath(name string) string {
+	return "images/" + name
+}
+
+func loadManifest(outDir string) manifest {
+	var m manifest
+	data, err := os.ReadFile(filepath.Join(outDir, manifestName))
+	if err != nil {
+		return m
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		utils.Logger.Printf("生成清单无法解析，将重新生成所有文件: %v", err)
+		return manifest{}
+	}
+	return m
+}
+
+func fileExists(outDir, path string) bool {
+	info, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(path)))
+	return err == nil && info.Mode().IsRegular()
+}
+
+func writeFile(outDir, path string, data []byte) error {
+	full := filepath.Join(outDir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(full, data, 0644)
+}
+
+// 删除文件，并删除因此变空的上级目录
+func removeFile(outDir, path string, result *Result) {
+	full := filepath.Join(outDir, filepath.FromSlash(path))
+	if err := os.Remove(full); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		utils.Logger.Printf("删除 %s 失败: %v", path, err)
+		return
+	}
+	result.Removed++
+	root := filepath.Clean(outDir)
+	for dir := filepath.Dir(full); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 本地目录存储
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir}, nil
+}
+
+// 本地文件路径，用于直接提供文件
+func (l *Local) Path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.dir, key), nil
+}
+
+// 先写入临时文件再重命名，避免读到写了一半的图片
+func (l *Local) Put(key string, r io.Reader, size int64, contentType string) error {
+	p, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	p, err := l.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+func (l *Local) Stat(key string) (Object, error) {
+	p, err := l.Path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return Object{}, ErrNotExist
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) Delete(key string) error {
+	p, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) List() ([]Object, error) {
+	files, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	objects := []Object{}
+	for _, file := range files {
+		// 跳过子目录和写入中的临时文件
+		if file.IsDir() || file.Name()[0] == '.' {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, Object{Key: file.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+func (l *Local) URL(key string, expires time.Duration) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,541 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试用的 S3 替身，只实现本项目用到的接口：对象的增删查、ListObjectsV2 分页和签名地址。
+// 签名按 AWS 文档独立校验，不复用 S3 客户端的签名代码；数据只保存在内存中
+type fakeS3 struct {
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	pageSize  int // ListObjectsV2 每页最多返回的数量
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	now     func() time.Time
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// S3 的错误响应
+type fakeS3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		bucket:    "photos",
+		region:    "us-east-1",
+		accessKey: "AKIDTEST",
+		secretKey: "secret/test+key",
+		pageSize:  1000,
+		objects:   make(map[string]fakeObject),
+		now:       time.Now,
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if code, message := f.verify(r); code != "" {
+		f.fail(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	// 同时支持路径风格和虚拟主机风格
+	rawPath, _, _ := strings.Cut(r.RequestURI, "?")
+	p, err := url.PathUnescape(rawPath)
+	if err != nil {
+		f.fail(w, http.StatusBadRequest, "InvalidURI", err.Error())
+		return
+	}
+	p = strings.TrimPrefix(p, "/")
+	if host, _, _ := strings.Cut(r.Host, ":"); !strings.HasPrefix(host, f.bucket+".") {
+		bucket, rest, _ := strings.Cut(p, "/")
+		if bucket != f.bucket {
+			f.fail(w, http.StatusNotFound, "NoSuchBucket", "存储桶不存在")
+			return
+		}
+		p = rest
+	}
+
+	if p == "" {
+		if r.Method != http.MethodGet || r.URL.Query().Get("list-type") != "2" {
+			f.fail(w, http.StatusNotImplemented, "NotImplemented", "只支持 ListObjectsV2")
+			return
+		}
+		f.list(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if r.ContentLength >= 0 && int64(len(data)) != r.ContentLength {
+			f.fail(w, http.StatusBadRequest, "IncompleteBody", "请求体长度与 Content-Length 不一致")
+			return
+		}
+		f.mu.Lock()
+		f.objects[p] = fakeObject{data: data, contentType: r.Header.Get("Content-Type"), modTime: f.now().UTC().Truncate(time.Second)}
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		f.mu.Lock()
+		obj, ok := f.objects[p]
+		f.mu.Unlock()
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchKey", "文件不存在")
+			return
+		}
+		if obj.contentType != "" {
+			w.Header().Set("Content-Type", obj.contentType)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		f.mu.Lock()
+		delete(f.objects, p)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// ListObjectsV2，continuation-token 是上一页最后一个文件名的 base64
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	after := ""
+	if token := query.Get("continuation-token"); token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "InvalidArgument", "无效的 continuation-token")
+			return
+		}
+		after = string(decoded)
+	}
+
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type content struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		Size         int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Name                  string    `xml:"Name"`
+		Prefix                string    `xml:"Prefix"`
+		KeyCount              int       `xml:"KeyCount"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+		Contents              []content `xml:"Contents"`
+	}{Name: f.bucket, Prefix: prefix}
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(keys[len(keys)-1]))
+	}
+	for _, key := range keys {
+		obj := f.objects[key]
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: obj.modTime.Format("2006-01-02T15:04:05.000Z"),
+			Size:         len(obj.data),
+		})
+	}
+	f.mu.Unlock()
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(fakeS3Error{Code: code, Message: message})
+}
+
+// 校验请求头签名或签名地址，返回 S3 的错误码
+func (f *fakeS3) verify(r *http.Request) (string, string) {
+	query := r.URL.Query()
+	var (
+		credential, signedHeaders, signature, amzDate, payloadHash string
+		expires                                                    time.Duration
+	)
+	if query.Get("X-Amz-Algorithm") != "" {
+		if query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+			return "AuthorizationQueryParametersError", "不支持的签名算法"
+		}
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		signature = query.Get("X-Amz-Signature")
+		amzDate = query.Get("X-Amz-Date")
+		payloadHash = unsignedPayload
+		seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || seconds <= 0 || seconds > 7*24*3600 {
+			return "AuthorizationQueryParametersError", "无效的 X-Amz-Expires"
+		}
+		expires = time.Duration(seconds) * time.Second
+		query.Del("X-Amz-Signature")
+	} else {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+			return "AccessDenied", "缺少签名"
+		}
+		for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch name {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				signature = value
+			}
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+		payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash == "" {
+			return "InvalidRequest", "缺少 X-Amz-Content-Sha256"
+		}
+	}
+
+	t, err := time.Parse(amzDateLayout, amzDate)
+	if err != nil {
+		return "AccessDenied", "无效的 X-Amz-Date"
+	}
+	now := f.now()
+	if expires > 0 {
+		if now.After(t.Add(expires)) {
+			return "AccessDenied", "签名地址已过期"
+		}
+	} else if d := now.Sub(t); d > 15*time.Minute || d < -15*time.Minute {
+		return "RequestTimeTooSkewed", "请求时间与服务器相差过大"
+	}
+
+	scope := strings.Join([]string{t.Format("20060102"), f.region, "s3", "aws4_request"}, "/")
+	if credential != f.accessKey+"/"+scope {
+		return "InvalidAccessKeyId", "访问密钥或签名范围不正确"
+	}
+	headerNames := strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(headerNames) || !containsString(headerNames, "host") {
+		return "AccessDenied", "SignedHeaders 必须排序且包含 host"
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	// 规范路径就是客户端发送的编码后路径
+	rawPath, _, _ := strings.Cut(r.RequestURI, "?")
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		rawPath,
+		awsQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + f.secretKey)
+	for _, part := range []string{t.Format("20060102"), f.region, "s3", "aws4_request"} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+		return "SignatureDoesNotMatch", "签名不正确"
+	}
+	return "", ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 按 AWS 规则编码查询参数: 空格编码为 %20，~ 不编码
+func awsQuery(query url.Values) string {
+	escape := func(s string) string {
+		s = url.QueryEscape(s)
+		s = strings.ReplaceAll(s, "+", "%20")
+		s = strings.ReplaceAll(s, "*", "%2A")
+		return strings.ReplaceAll(s, "%7E", "~")
+	}
+	var parts []string
+	for key, values := range query {
+		for _, value := range values {
+			parts = append(parts, escape(key)+"="+escape(value))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// 启动替身并返回连接它的 S3 客户端；虚拟主机风格的请求通过自定义拨号发到替身
+func newTestS3(t *testing.T, fake *fakeS3, cfg S3Config) *S3 {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg.Endpoint = server.URL
+	cfg.Region = fake.region
+	cfg.Bucket = fake.bucket
+	if cfg.AccessKey == "" {
+		cfg.AccessKey = fake.accessKey
+	}
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = fake.secretKey
+	}
+	s, err := NewS3(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := server.Listener.Addr().String()
+	s.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	return s
+}
+
+func putString(t *testing.T, s *S3, key, content string) {
+	t.Helper()
+	if err := s.Put(key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+}
+
+func httpGet(t *testing.T, client *http.Client, u string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	keys := []string{"a.jpg", "空格 名称.jpg", "special~(a+b)*.png", "100%.webp"}
+	for _, cfg := range []S3Config{
+		{PathStyle: true},
+		{PathStyle: true, Prefix: "images/"},
+		{Prefix: "originals/"},
+	} {
+		t.Run(fmt.Sprintf("path=%v prefix=%q", cfg.PathStyle, cfg.Prefix), func(t *testing.T) {
+			fake := newFakeS3()
+			s := newTestS3(t, fake, cfg)
+
+			for _, key := range keys {
+				putString(t, s, key, "内容 "+key)
+			}
+			for _, key := range keys {
+				want := "内容 " + key
+				if _, ok := fake.objects[cfg.Prefix+key]; !ok {
+					t.Errorf("替身中没有 %q", cfg.Prefix+key)
+				}
+				obj, err := s.Stat(key)
+				if err != nil {
+					t.Fatalf("Stat(%q): %v", key, err)
+				}
+				if obj.Key != key || obj.Size != int64(len(want)) || obj.ModTime.IsZero() {
+					t.Errorf("Stat(%q) = %+v", key, obj)
+				}
+				data, err := ReadAll(s, key)
+				if err != nil {
+					t.Fatalf("Get(%q): %v", key, err)
+				}
+				if string(data) != want {
+					t.Errorf("Get(%q) = %q, want %q", key, data, want)
+				}
+			}
+
+			if _, err := s.Stat("missing.jpg"); !errors.Is(err, ErrNotExist) {
+				t.Errorf("Stat(missing) err = %v, want ErrNotExist", err)
+			}
+			if _, err := s.Get("missing.jpg"); !errors.Is(err, ErrNotExist) {
+				t.Errorf("Get(missing) err = %v, want ErrNotExist", err)
+			}
+
+			for _, key := range keys {
+				if err := s.Delete(key); err != nil {
+					t.Fatalf("Delete(%q): %v", key, err)
+				}
+				if _, err := s.Stat(key); !errors.Is(err, ErrNotExist) {
+					t.Errorf("Delete(%q) 后 Stat err = %v", key, err)
+				}
+			}
+			if err := s.Delete(keys[0]); err != nil {
+				t.Errorf("删除不存在的文件: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3InvalidKey(t *testing.T) {
+	s := newTestS3(t, newFakeS3(), S3Config{PathStyle: true})
+	for _, key := range []string{"", "..", "../a.jpg", "2024/a.jpg", `a\b.jpg`} {
+		if err := s.Put(key, bytes.NewReader(nil), 0, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestS3ListPagination(t *testing.T) {
+	fake := newFakeS3()
+	fake.pageSize = 2
+	s := newTestS3(t, fake, S3Config{PathStyle: true, Prefix: "images/"})
+
+	want := []string{"a.jpg", "b.jpg", "c d.jpg", "e.jpg", "f.jpg"}
+	for _, key := range want {
+		putString(t, s, key, key)
+	}
+	// 前缀以外的文件不应列出
+	fake.objects["other/x.jpg"] = fakeObject{data: []byte("x")}
+
+	objects, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, obj := range objects {
+		got = append(got, obj.Key)
+		if obj.Size != int64(len(obj.Key)) || obj.ModTime.IsZero() {
+			t.Errorf("List 中 %q 的大小或修改时间不正确: %+v", obj.Key, obj)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+}
+
+func TestS3Signature(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    S3Config
+		offset time.Duration
+		want   string
+	}{
+		{name: "正确签名", cfg: S3Config{PathStyle: true}},
+		{name: "密钥错误", cfg: S3Config{PathStyle: true, SecretKey: "wrong"}, want: "SignatureDoesNotMatch"},
+		{name: "访问密钥错误", cfg: S3Config{PathStyle: true, AccessKey: "AKIDOTHER"}, want: "InvalidAccessKeyId"},
+		{name: "时间偏差过大", cfg: S3Config{PathStyle: true}, offset: time.Hour, want: "RequestTimeTooSkewed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestS3(t, newFakeS3(), tt.cfg)
+			s.now = func() time.Time { return time.Now().Add(tt.offset) }
+			err := s.Put("a.jpg", strings.NewReader("x"), 1, "image/jpeg")
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Put: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Put err = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3PresignedURL(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3(t, fake, S3Config{PathStyle: true, Prefix: "images/"})
+	key := "空格 (1)~.jpg"
+	putString(t, s, key, "图片")
+
+	signed, err := s.URL(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := httpGet(t, s.client, signed); status != http.StatusOK || body != "图片" {
+		t.Errorf("签名地址: %d %q", status, body)
+	}
+
+	tampered := signed[:len(signed)-1] + "0"
+	if strings.HasSuffix(signed, "0") {
+		tampered = signed[:len(signed)-1] + "1"
+	}
+	if status, _ := httpGet(t, s.client, tampered); status != http.StatusForbidden {
+		t.Errorf("篡改的签名地址返回 %d, want 403", status)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	expired, _ := s.URL(key, time.Minute)
+	if status, _ := httpGet(t, s.client, expired); status != http.StatusForbidden {
+		t.Errorf("过期的签名地址返回 %d, want 403", status)
+	}
+
+	public := newTestS3(t, fake, S3Config{PathStyle: true, Prefix: "images/", PublicURL: "https://cdn.example.com/"})
+	u, err := public.URL(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://cdn.example.com/images/%E7%A9%BA%E6%A0%BC%20%281%29~.jpg"; u != want {
+		t.Errorf("公开地址 = %q, want %q", u, want)
+	}
+}
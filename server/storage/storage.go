@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"server/config"
+)
+
+var (
+	ErrNotExist   = errors.New("文件不存在")
+	ErrInvalidKey = errors.New("无效的文件名")
+)
+
+// 存储中的文件
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// 图片存储后端
+type Backend interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Stat(key string) (Object, error)
+	Delete(key string) error
+	List() ([]Object, error)
+	// 文件的直接访问地址，返回空字符串表示由服务器自己提供文件
+	URL(key string, expires time.Duration) (string, error)
+}
+
+// 公开图片和保留原始元数据的私有图片
+var (
+	Images    Backend
+	Originals Backend
+)
+
+// 按配置初始化存储后端
+func Init() error {
+	var err error
+	if Images, err = New(config.StorageBackend, "images"); err != nil {
+		return err
+	}
+	if Originals, err = New(config.StorageBackend, "originals"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 创建指定类型的存储后端，bucket 为 images 或 originals
+func New(kind, bucket string) (Backend, error) {
+	switch kind {
+	case "local":
+		dir := config.ImagesDir
+		if bucket == "originals" {
+			dir = config.OriginalsDir
+		}
+		return NewLocal(dir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  config.S3Endpoint,
+			Region:    config.S3Region,
+			Bucket:    config.S3Bucket,
+			AccessKey: config.S3AccessKey,
+			SecretKey: config.S3SecretKey,
+			PathStyle: config.S3PathStyle,
+			Prefix:    bucket + "/",
+			PublicURL: publicURLFor(bucket),
+		})
+	}
+	return nil, fmt.Errorf("未知的存储类型: %s", kind)
+}
+
+// 只有公开图片可以使用公开地址，私有图片始终使用签名地址
+func publicURLFor(bucket string) string {
+	if bucket == "images" {
+		return config.S3PublicURL
+	}
+	return ""
+}
+
+// 读取整个文件
+func ReadAll(b Backend, key string) ([]byte, error) {
+	r, err := b.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// 文件名只能是单层，不能包含路径
+func validKey(key string) bool {
+	return key != "" && key != "." && key != ".." &&
+		!strings.ContainsAny(key, `/\`) && path.Base(key) == key
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"server/config"
+)
+
+// 本站图片可能使用的域名：PUBLIC_BASE_URL 和 IMAGE_CDN_PREFIX 的域名，以及 extra 中的地址或域名
+func OwnImageHosts(extra ...string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, value := range append([]string{config.PublicBaseURL, config.ImageCDNPrefix}, extra...) {
+		host := value
+		if strings.Contains(value, "//") {
+			u, err := url.Parse(value)
+			if err != nil {
+				continue
+			}
+			host = u.Host
+		}
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// 匹配任意一个域名的正则片段，没有域名时返回空字符串
+func HostPattern(hosts []string) string {
+	if len(hosts) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(hosts))
+	for i, host := range hosts {
+		quoted[i] = regexp.QuoteMeta(host)
+	}
+	return `(?i:` + strings.Join(quoted, "|") + `)`
+}
+
+// 只替换 markdown 中围栏代码块和行内代码以外的内容，代码中的地址等保持原样
+func ReplaceOutsideCode(content string, replace func(string) string) string {
+	var b strings.Builder
+	text := 0
+	flush := func(end int) {
+		if end > text {
+			b.WriteString(replace(content[text:end]))
+		}
+	}
+	for i, lineStart := 0, true; i < len(content); {
+		if lineStart {
+			if end := fencedCodeEnd(content, i); end > i {
+				flush(i)
+				b.WriteString(content[i:end])
+				i, text = end, end
+				continue
+			}
+		}
+		if content[i] == '`' {
+			run := backtickRun(content, i)
+			if end := codeSpanEnd(content, i+run, run); end > 0 {
+				flush(i)
+				b.WriteString(content[i:end])
+				i, text, lineStart = end, end, false
+				continue
+			}
+			i += run
+			lineStart = false
+			continue
+		}
+		lineStart = content[i] == '\n'
+		i++
+	}
+	flush(len(content))
+	return b.String()
+}
+
+// start 处是围栏代码块时返回代码块结束的位置，否则返回 start；没有结束围栏时代码块延续到末尾
+func fencedCodeEnd(content string, start int) int {
+	line, next := lineAt(content, start)
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent > 3 {
+		return start
+	}
+	line = line[indent:]
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return start
+	}
+	fence := line[0]
+	n := len(line) - len(strings.TrimLeft(line, string(fence)))
+	if n < 3 || (fence == '`' && strings.Contains(line[n:], "`")) {
+		return start
+	}
+	for i := next; i < len(content); {
+		line, next := lineAt(content, i)
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) <= 3 {
+			closing := len(trimmed) - len(strings.TrimLeft(trimmed, string(fence)))
+			if closing >= n && strings.TrimSpace(trimmed[closing:]) == "" {
+				return next
+			}
+		}
+		i = next
+	}
+	return len(content)
+}
+
+// start 所在行的内容（不含换行符）和下一行的开始位置
+func lineAt(content string, start int) (string, int) {
+	end := strings.IndexByte(content[start:], '\n')
+	if end < 0 {
+		return strings.TrimSuffix(content[start:], "\r"), len(content)
+	}
+	return strings.TrimSuffix(content[start:start+end], "\r"), start + end + 1
+}
+
+func backtickRun(content string, start int) int {
+	n := 0
+	for start+n < len(content) && content[start+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// 行内代码以同样长度的反引号结束，返回结束位置，找不到时返回 0
+func codeSpanEnd(content string, start, run int) int {
+	for i := start; i < len(content); {
+		j := strings.IndexByte(content[i:], '`')
+		if j < 0 {
+			return 0
+		}
+		i += j
+		n := backtickRun(content, i)
+		if n == run {
+			return i + n
+		}
+		i += n
+	}
+	return 0
+}
@@ -37,7 +37,7 @@ func EnsureDirectories() {
 }
 
 func ExtractField(frontmatter string, field string) string {
-	re := regexp.MustCompile(fmt.Sprintf(`(?m)^%s:\s*(.+)$`, field))
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)^%s:[ \t]*(.*)$`, field))
 	matches := re.FindStringSubmatch(frontmatter)
 	if len(matches) > 1 {
 		return strings.TrimSpace(matches[1])